@@ -0,0 +1,257 @@
+package dpo
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrAuditUnsupported is returned by client.AuditHistory when the AuditSink of the client cannot look up records.
+var ErrAuditUnsupported = errors.New("dpo: audit sink does not support lookups")
+
+// AuditRecord is the raw exchange of a single attempt of a request to DPO.
+// Card numbers are masked to their last four digits, CVVs, CAVVs, PARes messages and the company token are replaced by "***".
+type AuditRecord struct {
+	Op         string    `json:"op"`
+	CompanyRef string    `json:"company_ref,omitempty"`
+	TransToken string    `json:"trans_token,omitempty"`
+	Attempt    int       `json:"attempt"`               // Attempt 0 for the first attempt, 1 for the first retry and so on
+	Request    string    `json:"request"`               // Request the XML sent to DPO
+	Response   string    `json:"response,omitempty"`    // Response the body received from DPO
+	HTTPStatus int       `json:"http_status,omitempty"` // HTTPStatus 0 when no response was received
+	Error      string    `json:"error,omitempty"`       // Error the transport error when no response was received
+	SentAt     time.Time `json:"sent_at"`
+	ReceivedAt time.Time `json:"received_at"` // ReceivedAt when the response was read or the attempt failed
+}
+
+// AuditSink receives an AuditRecord for every attempt of a request the Client sends to DPO.
+type AuditSink interface {
+	WriteAudit(ctx context.Context, record AuditRecord) error
+}
+
+// AuditLog is an AuditSink which can look up the records of a token.
+// FileAuditLog and SQLStore implement AuditLog.
+type AuditLog interface {
+	AuditSink
+	// AuditHistory returns the records for transToken, oldest first.
+	AuditHistory(ctx context.Context, transToken string) ([]AuditRecord, error)
+}
+
+// SetAuditSink makes the client write every request and response to sink.
+// Errors writing a record do not fail the request, which has already been sent, they are passed to onError
+// if it is not nil. Passing a nil sink disables the audit trail.
+func (c *Client) SetAuditSink(sink AuditSink, onError func(err error)) {
+	c.auditSink = sink
+	c.onAuditError = onError
+}
+
+// AuditHistory returns every exchange with DPO recorded for transToken, oldest first.
+// It returns ErrAuditUnsupported when the sink of the client is not an AuditLog.
+func (c *Client) AuditHistory(ctx context.Context, transToken string) ([]AuditRecord, error) {
+	log, ok := c.auditSink.(AuditLog)
+	if !ok {
+		return nil, ErrAuditUnsupported
+	}
+	return log.AuditHistory(ctx, transToken)
+}
+
+// audit writes the record of an attempt to the audit sink of the client.
+func (c *Client) audit(ctx context.Context, record AuditRecord, request any) {
+	record.CompanyRef, record.TransToken = requestRefs(request)
+	if record.TransToken == "" && record.Response != "" {
+		var response struct {
+			TransToken string `xml:"TransToken"`
+		}
+		if xml.Unmarshal([]byte(record.Response), &response) == nil {
+			record.TransToken = response.TransToken
+		}
+	}
+	record.Response = maskXML([]byte(record.Response))
+	if err := c.auditSink.WriteAudit(ctx, record); err != nil && c.onAuditError != nil {
+		c.onAuditError(fmt.Errorf("failed to write audit record for %s: %w", record.Op, err))
+	}
+}
+
+var (
+	auditCardNumber = regexp.MustCompile(`(<CreditCardNumber>)\s*([^<]*?)\s*(</CreditCardNumber>)`)
+	auditSecrets    = regexp.MustCompile(`(<(CreditCardCVV|Cavv|Pares|CompanyToken)>)[^<]*(</(CreditCardCVV|Cavv|Pares|CompanyToken)>)`)
+)
+
+// maskXML masks the card number and replaces the CVV, CAVV, PARes and company token in an API3G message.
+func maskXML(data []byte) string {
+	data = auditCardNumber.ReplaceAllFunc(data, func(match []byte) []byte {
+		parts := auditCardNumber.FindSubmatch(match)
+		return []byte(string(parts[1]) + MaskCardNumber(string(parts[2])) + string(parts[3]))
+	})
+	data = auditSecrets.ReplaceAll(data, []byte("${1}***${3}"))
+	return string(data)
+}
+
+// FileAuditLog is an AuditLog appending records as JSON lines to a file.
+// When a record would grow the file beyond the size given to OpenFileAuditLog it is renamed with the time of the rotation appended, e.g.
+// "audit.jsonl.20240115T103000.000000000", and a new file is started. Rotated files are never deleted.
+type FileAuditLog struct {
+	mu       sync.Mutex
+	path     string
+	file     *os.File
+	size     int64
+	maxBytes int64
+}
+
+// OpenFileAuditLog opens or creates the audit file at path, which is rotated once it is larger than maxBytes.
+// A maxBytes of 0 disables rotation.
+func OpenFileAuditLog(path string, maxBytes int64) (*FileAuditLog, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &FileAuditLog{path: path, file: file, size: info.Size(), maxBytes: maxBytes}, nil
+}
+
+// WriteAudit implements AuditSink.
+func (f *FileAuditLog) WriteAudit(ctx context.Context, record AuditRecord) error {
+	data, err := json.Marshal(&record)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.maxBytes > 0 && f.size > 0 && f.size+int64(len(data)) > f.maxBytes {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := f.file.Write(data)
+	f.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return f.file.Sync()
+}
+
+// rotate renames the current file and starts a new one. f.mu must be held.
+// When the rename or the new file fails, the current file is reopened so that later writes can still succeed.
+func (f *FileAuditLog) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	rotated := f.path + "." + time.Now().UTC().Format("20060102T150405.000000000")
+	if err := os.Rename(f.path, rotated); err != nil {
+		return f.reopen(err)
+	}
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		// move the records back, should that fail too they are still read from the rotated file
+		os.Rename(rotated, f.path)
+		return f.reopen(err)
+	}
+	f.file = file
+	f.size = 0
+	return nil
+}
+
+// reopen opens the current file again after a failed rotation and returns cause. f.mu must be held.
+func (f *FileAuditLog) reopen(cause error) error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to rotate audit file: %v, and to reopen it: %w", cause, err)
+	}
+	info, err := file.Stat()
+	if err == nil {
+		f.size = info.Size()
+	}
+	f.file = file
+	return fmt.Errorf("failed to rotate audit file: %w", cause)
+}
+
+// AuditHistory implements AuditLog, it reads the rotated files and the current one.
+// The lock is only held to list the files and open the current one, so writes are not blocked while reading.
+func (f *FileAuditLog) AuditHistory(ctx context.Context, transToken string) ([]AuditRecord, error) {
+	files, current, size, err := f.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer current.Close()
+
+	records := make([]AuditRecord, 0)
+	for _, path := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		records, err = readAuditFile(file, path, transToken, records)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	// the current file is read up to its size at the time of the snapshot, it may be rotated or written to meanwhile
+	return readAuditFile(io.LimitReader(current, size), f.path, transToken, records)
+}
+
+// snapshot returns the sorted rotated files, the current file opened for reading and its size.
+// Rotated files are never written again, and the opened current file keeps its contents even if it is rotated later.
+func (f *FileAuditLog) snapshot() ([]string, *os.File, int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	files, err := filepath.Glob(f.path + ".[0-9]*T[0-9]*")
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	sort.Strings(files)
+	current, err := os.Open(f.path)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	return files, current, f.size, nil
+}
+
+// readAuditFile appends the records for transToken read from r to records, name is the file used in errors.
+func readAuditFile(r io.Reader, name, transToken string, records []AuditRecord) ([]AuditRecord, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, line, err)
+		}
+		if record.TransToken == transToken {
+			records = append(records, record)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// Close closes the current file.
+func (f *FileAuditLog) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
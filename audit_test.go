@@ -0,0 +1,174 @@
+package dpo_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/golang-malawi/go-dpo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditTrail(t *testing.T) {
+	assert := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log, err := dpo.OpenFileAuditLog(path, 600)
+	assert.Nil(err)
+	defer log.Close()
+
+	calls := 0
+	client := newStubClientFunc(func(string) (int, string) {
+		calls++
+		if calls == 1 {
+			return http.StatusServiceUnavailable, "try again"
+		}
+		return http.StatusOK, `<API3G><Result>000</Result><ResultExplanation>Transaction charged</ResultExplanation></API3G>`
+	})
+	var auditErrors []error
+	client.SetAuditSink(log, func(err error) { auditErrors = append(auditErrors, err) })
+
+	_, err = client.VerifyToken(&dpo.CreateTokenResponse{TransToken: "T1"})
+	assert.Nil(err)
+	_, err = client.ChargeCard(context.Background(), &dpo.CreateTokenResponse{TransToken: "T1"}, dpo.CreditCardCharge{Card: newTestCard(t)})
+	assert.Nil(err)
+	_, err = client.VerifyToken(&dpo.CreateTokenResponse{TransToken: "T2"})
+	assert.Nil(err)
+	assert.Empty(auditErrors)
+
+	rotated, err := filepath.Glob(path + ".*")
+	assert.Nil(err)
+	assert.NotEmpty(rotated, "the log should have been rotated")
+
+	records, err := client.AuditHistory(context.Background(), "T1")
+	assert.Nil(err)
+	assert.Len(records, 3)
+	assert.Equal("verifyToken", records[0].Op)
+	assert.Equal(0, records[0].Attempt)
+	assert.Equal(http.StatusServiceUnavailable, records[0].HTTPStatus)
+	assert.Equal("try again", records[0].Response)
+	assert.Equal(1, records[1].Attempt)
+	assert.Contains(records[1].Response, "<Result>000</Result>")
+	assert.False(records[1].SentAt.After(records[1].ReceivedAt))
+
+	charge := records[2]
+	assert.Equal("chargeTokenCreditCard", charge.Op)
+	assert.Contains(charge.Request, "<CreditCardNumber>************1111</CreditCardNumber>")
+	assert.Contains(charge.Request, "<CreditCardCVV>***</CreditCardCVV>")
+	assert.Contains(charge.Request, "<CompanyToken>***</CompanyToken>")
+	assert.NotContains(charge.Request, "4111111111111111")
+	assert.NotContains(charge.Request, "TOKEN")
+}
+
+func TestAuditRotateFailure(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log, err := dpo.OpenFileAuditLog(path, 200)
+	assert.Nil(err)
+	defer log.Close()
+
+	record := dpo.AuditRecord{Op: "verifyToken", TransToken: "T1", Request: strings.Repeat("x", 100)}
+	assert.Nil(log.WriteAudit(ctx, record))
+	// the rename of the next rotation fails
+	assert.Nil(os.Remove(path))
+	assert.NotNil(log.WriteAudit(ctx, record))
+
+	assert.Nil(log.WriteAudit(ctx, record), "the log must stay usable after a failed rotation")
+	records, err := log.AuditHistory(ctx, "T1")
+	assert.Nil(err)
+	assert.Len(records, 1)
+}
+
+func TestAuditHistoryWhileWriting(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	log, err := dpo.OpenFileAuditLog(filepath.Join(t.TempDir(), "audit.jsonl"), 1000)
+	assert.Nil(err)
+	defer log.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			assert.Nil(log.WriteAudit(ctx, dpo.AuditRecord{Op: "verifyToken", TransToken: "T1", Attempt: i}))
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		_, err := log.AuditHistory(ctx, "T1")
+		assert.Nil(err)
+	}
+	wg.Wait()
+
+	records, err := log.AuditHistory(ctx, "T1")
+	assert.Nil(err)
+	if assert.Len(records, 200) {
+		for i, record := range records {
+			assert.Equal(i, record.Attempt)
+		}
+	}
+}
+
+type writeOnlySink struct{ records []dpo.AuditRecord }
+
+func (s *writeOnlySink) WriteAudit(ctx context.Context, record dpo.AuditRecord) error {
+	s.records = append(s.records, record)
+	return nil
+}
+
+func TestAuditCreateToken(t *testing.T) {
+	assert := assert.New(t)
+
+	client := newStubClient(http.StatusOK, `<API3G><Result>000</Result><ResultExplanation>Created</ResultExplanation><TransToken>T9</TransToken></API3G>`, nil)
+	sink := &writeOnlySink{}
+	client.SetAuditSink(sink, nil)
+
+	request := &dpo.CreateTokenRequest{}
+	request.Transaction.CompanyRef = "REF9"
+	_, err := client.CreateToken(request)
+	assert.Nil(err)
+	assert.Len(sink.records, 1)
+	assert.Equal("REF9", sink.records[0].CompanyRef)
+	assert.Equal("T9", sink.records[0].TransToken)
+
+	_, err = client.AuditHistory(context.Background(), "T9")
+	assert.True(errors.Is(err, dpo.ErrAuditUnsupported))
+}
+
+func TestAuditMasksThreeD(t *testing.T) {
+	assert := assert.New(t)
+
+	client := newStubClient(http.StatusOK, `<API3G><Result>000</Result><ResultExplanation>Transaction charged</ResultExplanation></API3G>`, nil)
+	sink := &writeOnlySink{}
+	client.SetAuditSink(sink, nil)
+
+	_, err := client.ChargeCard(context.Background(), &dpo.CreateTokenResponse{TransToken: "T1"}, dpo.CreditCardCharge{
+		Card: newTestCard(t),
+		ThreeD: &dpo.ThreeDRequest{
+			Enrolled:    "Y",
+			Paresstatus: "Y",
+			Eci:         "05",
+			Xid:         "XID1",
+			Cavv:        "AAABBEg0VhI0VniQEjRWAAAAAAA=",
+			Pares:       "eJzVWNmSo0iS/ZW0=",
+		},
+	})
+	assert.Nil(err)
+	if assert.Len(sink.records, 1) {
+		request := sink.records[0].Request
+		assert.Contains(request, "<Eci>05</Eci>")
+		assert.Contains(request, "<Xid>XID1</Xid>")
+		assert.Contains(request, "<Cavv>***</Cavv>")
+		assert.Contains(request, "<Pares>***</Pares>")
+		assert.NotContains(request, "AAABBEg0VhI0VniQEjRWAAAAAAA=")
+		assert.NotContains(request, "eJzVWNmSo0iS/ZW0=")
+	}
+}
@@ -0,0 +1,121 @@
+package dpo
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	opGetBalance = "getBalance"
+)
+
+// dpoTimeLayouts are the date formats seen in DPO API responses.
+var dpoTimeLayouts = []string{
+	"2006/01/02 15:04:05",
+	"2006/01/02 15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006/01/02",
+	"2006-01-02",
+	time.RFC3339,
+}
+
+// parseDPOTime parses a date returned by the DPO API.
+func parseDPOTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range dpoTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", value)
+}
+
+// BalanceRequest is a request for the balance of the company account.
+type BalanceRequest struct {
+	XMLName xml.Name `xml:"API3G"`
+
+	CompanyToken string `xml:"CompanyToken"`
+	Request      string `xml:"Request"`
+	Currency     string `xml:"Currency,omitempty"` // Currency limits the result to a single currency, all currencies are returned if empty
+}
+
+// BalanceResponse is returned after processing a BalanceRequest and depending on the Result may be an error response or not.
+type BalanceResponse struct {
+	XMLName xml.Name `xml:"API3G"`
+
+	Result            string          `xml:"Result"`
+	ResultExplanation string          `xml:"ResultExplanation"`
+	BalanceDate       string          `xml:"BalanceDate,omitempty"`
+	Balances          []CurrencyValue `xml:"Balances>Balance"`
+}
+
+// CurrencyValue is the balance held in one currency.
+type CurrencyValue struct {
+	Currency string `xml:"Currency"`
+	Amount   string `xml:"Amount"`
+}
+
+// IsError determines whether the BalanceResponse is an error or not.
+func (b *BalanceResponse) IsError() bool {
+	return b.Result != "000"
+}
+
+// Balance is the balance of the company account with DPO.
+type Balance struct {
+	AsOf    time.Time // AsOf is the time the balance was reported for
+	Amounts []Money   // Amounts holds the balance of each currency
+}
+
+// Amount returns the balance held in currency and whether the account holds that currency at all.
+func (b *Balance) Amount(currency string) (Money, bool) {
+	for _, m := range b.Amounts {
+		if strings.EqualFold(m.Currency, currency) {
+			return m, true
+		}
+	}
+	return Money{}, false
+}
+
+// Balance fetches the balance of the company account.
+// currency limits the result to a single currency, pass an empty string to get the balance for every currency.
+// When DPO does not report the date of the balance AsOf is set to the time the response was received.
+func (c *Client) Balance(ctx context.Context, currency string) (*Balance, error) {
+	request := &BalanceRequest{
+		CompanyToken: c.Token,
+		Request:      opGetBalance,
+		Currency:     strings.ToUpper(currency),
+	}
+
+	var response BalanceResponse
+	if err := c.post(ctx, opGetBalance, request, &response); err != nil {
+		return nil, err
+	}
+	if response.IsError() {
+		return nil, &Error{Op: opGetBalance, Code: response.Result, Explanation: response.ResultExplanation}
+	}
+
+	balance := &Balance{
+		AsOf:    time.Now(),
+		Amounts: make([]Money, 0, len(response.Balances)),
+	}
+	if response.BalanceDate != "" {
+		asOf, err := parseDPOTime(response.BalanceDate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse balance date: %v", err)
+		}
+		balance.AsOf = asOf
+	}
+	for _, value := range response.Balances {
+		amount, err := ParseMoney(value.Amount, value.Currency)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s balance: %v", value.Currency, err)
+		}
+		balance.Amounts = append(balance.Amounts, amount)
+	}
+
+	return balance, nil
+}
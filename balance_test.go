@@ -0,0 +1,40 @@
+package dpo_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-malawi/go-dpo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBalance(t *testing.T) {
+	assert := assert.New(t)
+
+	var requests []string
+	client := newStubClient(http.StatusOK, `<API3G><Result>000</Result><ResultExplanation>OK</ResultExplanation>
+<BalanceDate>2024/03/01 10:00:00</BalanceDate>
+<Balances><Balance><Currency>USD</Currency><Amount>1250.75</Amount></Balance></Balances></API3G>`, &requests)
+
+	balance, err := client.Balance(context.Background(), "usd")
+	assert.Nil(err)
+	assert.Equal(time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC), balance.AsOf)
+
+	usd, ok := balance.Amount("USD")
+	assert.True(ok)
+	assert.Equal(int64(125075), usd.Cents)
+	assert.Contains(requests[0], "<Currency>USD</Currency>")
+}
+
+func TestBalanceError(t *testing.T) {
+	assert := assert.New(t)
+
+	client := newStubClient(http.StatusOK, `<API3G><Result>801</Result><ResultExplanation>Request missing company token</ResultExplanation></API3G>`, nil)
+
+	_, err := client.Balance(context.Background(), "")
+	var dpoErr *dpo.Error
+	assert.ErrorAs(err, &dpoErr)
+	assert.Equal("getBalance", dpoErr.Op)
+}
@@ -0,0 +1,207 @@
+package dpo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrGatewayUnavailable is returned without contacting DPO while the CircuitBreaker of the client is open.
+var ErrGatewayUnavailable = errors.New("dpo: gateway unavailable")
+
+// BreakerState is the state of a CircuitBreaker.
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // BreakerClosed requests are sent to DPO
+	BreakerOpen                         // BreakerOpen requests fail with ErrGatewayUnavailable
+	BreakerHalfOpen                     // BreakerHalfOpen a limited number of probe requests are sent to find out whether DPO is back
+)
+
+// String implements fmt.Stringer.
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("BreakerState(%d)", int(s))
+	}
+}
+
+// CircuitBreaker stops a Client from sending requests to DPO after consecutive failures, so that callers fail
+// fast with ErrGatewayUnavailable instead of waiting for timeouts and retries during an outage.
+//
+// A failure is an attempt without a response, other than because its context was done, or with a 5xx status.
+// After FailureThreshold consecutive failures the breaker opens. Once OpenTimeout has passed it lets up to
+// HalfOpenProbes requests through: the first success closes it again, a failed probe opens it for another
+// OpenTimeout.
+//
+//	breaker := dpo.NewCircuitBreaker()
+//	breaker.OnStateChange = func(from, to dpo.BreakerState) { ... }
+//	client.SetCircuitBreaker(breaker)
+type CircuitBreaker struct {
+	FailureThreshold int           // FailureThreshold consecutive failures which open the breaker, 5 by default
+	OpenTimeout      time.Duration // OpenTimeout how long the breaker stays open before probing, 30 seconds by default
+	HalfOpenProbes   int           // HalfOpenProbes number of concurrent probe requests when half-open, 1 by default
+
+	// OnStateChange is called after the state changed, from the goroutine of the request which changed it.
+	OnStateChange func(from, to BreakerState)
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int       // failures consecutive failures while closed
+	openedAt time.Time // openedAt when the breaker opened the last time
+	probes   int       // probes number of probe requests in flight
+	now      func() time.Time
+}
+
+// NewCircuitBreaker creates a closed CircuitBreaker with the default settings.
+func NewCircuitBreaker() *CircuitBreaker {
+	return &CircuitBreaker{
+		FailureThreshold: 5,
+		OpenTimeout:      30 * time.Second,
+		HalfOpenProbes:   1,
+		now:              time.Now,
+	}
+}
+
+// SetCircuitBreaker makes the client fail fast with ErrGatewayUnavailable while breaker is open.
+// A breaker may be shared by several clients talking to the same DPO environment. Passing nil removes it.
+func (c *Client) SetCircuitBreaker(breaker *CircuitBreaker) {
+	c.breaker = breaker
+}
+
+// State returns the current state of the breaker. An open breaker is reported as open until a request
+// finds that OpenTimeout has passed.
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// breakerOutcome is the result of a request as far as the breaker is concerned.
+type breakerOutcome int
+
+const (
+	breakerSuccess breakerOutcome = iota
+	breakerFailure
+	breakerIgnored // breakerIgnored the request was given up by the caller, it says nothing about DPO
+)
+
+// allow reports whether a request may be sent and whether it is a probe of a half-open breaker.
+func (b *CircuitBreaker) allow() (probe bool, err error) {
+	b.mu.Lock()
+	var changes []BreakerState
+	defer func() {
+		b.mu.Unlock()
+		b.notify(changes)
+	}()
+
+	switch b.state {
+	case BreakerClosed:
+		return false, nil
+	case BreakerOpen:
+		if b.clock().Sub(b.openedAt) < b.openTimeout() {
+			return false, ErrGatewayUnavailable
+		}
+		changes = b.setState(BreakerHalfOpen, changes)
+	}
+
+	maxProbes := b.HalfOpenProbes
+	if maxProbes < 1 {
+		maxProbes = 1
+	}
+	if b.probes >= maxProbes {
+		return false, ErrGatewayUnavailable
+	}
+	b.probes++
+	return true, nil
+}
+
+// done records the outcome of a request allowed by allow.
+func (b *CircuitBreaker) done(probe bool, outcome breakerOutcome) {
+	b.mu.Lock()
+	var changes []BreakerState
+	defer func() {
+		b.mu.Unlock()
+		b.notify(changes)
+	}()
+
+	if probe {
+		b.probes--
+	}
+	switch outcome {
+	case breakerSuccess:
+		b.failures = 0
+		if b.state != BreakerClosed {
+			changes = b.setState(BreakerClosed, changes)
+		}
+	case breakerFailure:
+		b.failures++
+		threshold := b.FailureThreshold
+		if threshold < 1 {
+			threshold = 5
+		}
+		if (b.state == BreakerClosed && b.failures >= threshold) || (b.state == BreakerHalfOpen && probe) {
+			b.openedAt = b.clock()
+			changes = b.setState(BreakerOpen, changes)
+		}
+	}
+}
+
+// setState changes the state and appends the old and the new state to changes. b.mu must be held.
+func (b *CircuitBreaker) setState(state BreakerState, changes []BreakerState) []BreakerState {
+	changes = append(changes, b.state, state)
+	b.state = state
+	b.failures = 0
+	return changes
+}
+
+// notify calls OnStateChange for the pairs of states in changes. b.mu must not be held.
+func (b *CircuitBreaker) notify(changes []BreakerState) {
+	if b.OnStateChange == nil {
+		return
+	}
+	for i := 0; i+1 < len(changes); i += 2 {
+		b.OnStateChange(changes[i], changes[i+1])
+	}
+}
+
+func (b *CircuitBreaker) openTimeout() time.Duration {
+	if b.OpenTimeout <= 0 {
+		return 30 * time.Second
+	}
+	return b.OpenTimeout
+}
+
+func (b *CircuitBreaker) clock() time.Time {
+	if b.now == nil {
+		return time.Now()
+	}
+	return b.now()
+}
+
+// allowRequest checks the circuit breaker of the client before an attempt of op. The returned function must be
+// called with the outcome of the attempt.
+func (c *Client) allowRequest(ctx context.Context, op string) (func(outcome breakerOutcome), error) {
+	breaker := c.breaker
+	if breaker == nil {
+		return func(breakerOutcome) {}, nil
+	}
+	probe, err := breaker.allow()
+	if err != nil {
+		return nil, fmt.Errorf("%s request not sent: %w", op, err)
+	}
+	return func(outcome breakerOutcome) {
+		if outcome == breakerFailure && ctx.Err() != nil {
+			outcome = breakerIgnored
+		}
+		breaker.done(probe, outcome)
+	}, nil
+}
@@ -0,0 +1,95 @@
+package dpo_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-malawi/go-dpo"
+	"github.com/stretchr/testify/assert"
+)
+
+type stateChanges struct {
+	mu      sync.Mutex
+	changes []string
+}
+
+func (s *stateChanges) record(from, to dpo.BreakerState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.changes = append(s.changes, from.String()+">"+to.String())
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	assert := assert.New(t)
+
+	var mu sync.Mutex
+	status, calls := http.StatusServiceUnavailable, 0
+	client := newStubClientFunc(func(string) (int, string) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		return status, verifyNotPaid
+	})
+	changes := &stateChanges{}
+	breaker := dpo.NewCircuitBreaker()
+	breaker.FailureThreshold = 3
+	breaker.OpenTimeout = 20 * time.Millisecond
+	breaker.OnStateChange = changes.record
+	client.SetCircuitBreaker(breaker)
+	token := &dpo.CreateTokenResponse{TransToken: "T1"}
+
+	// the breaker opens during the retries of the first request
+	_, err := client.VerifyToken(token)
+	assert.True(errors.Is(err, dpo.ErrGatewayUnavailable))
+	assert.Equal(3, calls)
+	assert.Equal(dpo.BreakerOpen, breaker.State())
+
+	_, err = client.VerifyToken(token)
+	assert.True(errors.Is(err, dpo.ErrGatewayUnavailable))
+	assert.Equal(3, calls)
+
+	// a failed probe opens the breaker again
+	time.Sleep(30 * time.Millisecond)
+	_, err = client.VerifyToken(token)
+	assert.True(errors.Is(err, dpo.ErrGatewayUnavailable))
+	assert.Equal(4, calls)
+	assert.Equal(dpo.BreakerOpen, breaker.State())
+
+	// a successful probe closes it
+	time.Sleep(30 * time.Millisecond)
+	mu.Lock()
+	status = http.StatusOK
+	mu.Unlock()
+	_, err = client.VerifyToken(token)
+	assert.Nil(err)
+	assert.Equal(dpo.BreakerClosed, breaker.State())
+	assert.Equal([]string{"closed>open", "open>half-open", "half-open>open", "open>half-open", "half-open>closed"}, changes.changes)
+}
+
+func TestCircuitBreakerIgnoresClientErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	client := newStubClient(http.StatusBadRequest, "bad request", nil)
+	breaker := dpo.NewCircuitBreaker()
+	breaker.FailureThreshold = 1
+	client.SetCircuitBreaker(breaker)
+
+	_, err := client.CancelToken("T1")
+	assert.NotNil(err)
+	assert.Equal(dpo.BreakerClosed, breaker.State())
+
+	client.SetHTTPClient(&http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			return nil, req.Context().Err()
+		}),
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = client.CancelTokenContext(ctx, "T1")
+	assert.True(errors.Is(err, context.Canceled))
+	assert.Equal(dpo.BreakerClosed, breaker.State())
+}
@@ -1,6 +1,12 @@
 package dpo
 
-import "encoding/xml"
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"time"
+)
 
 type chargeTokenResponseCode string
 
@@ -54,42 +60,168 @@ func (v chargeTokenResponseCode) Description() string {
 
 // ChargeCreditCardRequest is a request to charge a users card directly.
 type ChargeCreditCardRequest struct {
-	XMLName xml.Name `xml:"API3G"`
-
-	CompanyToken     string        `xml:"CompanyToken"`
-	Request          string        `xml:"Request"`
-	TransactionToken string        `xml:"TransactionToken"`
-	CreditCardNumber string        `xml:"CreditCardNumber"`
-	CreditCardExpiry string        `xml:"CreditCardExpiry"`
-	CreditCardCVV    string        `xml:"CreditCardCVV"`
-	CardHolderName   string        `xml:"CardHolderName"`
-	ThreeD           ThreeDRequest `xml:"ThreeD"`
+	XMLName xml.Name `xml:"API3G" json:"-"`
+
+	CompanyToken     string         `xml:"CompanyToken" json:"-"`
+	Request          string         `xml:"Request" json:"request"`
+	TransactionToken string         `xml:"TransactionToken" json:"trans_token"`
+	CreditCardNumber string         `xml:"CreditCardNumber" json:"credit_card_number"`
+	CreditCardExpiry string         `xml:"CreditCardExpiry" json:"credit_card_expiry"`
+	CreditCardCVV    string         `xml:"CreditCardCVV" json:"-"`
+	CardHolderName   string         `xml:"CardHolderName" json:"card_holder_name"`
+	ThreeD           *ThreeDRequest `xml:"ThreeD,omitempty" json:"three_d,omitempty"` // ThreeD results of a 3-D Secure authentication, omitted when nil
 }
 
 // ThreeDRequest request data for 3D systems.
+// The values are the results of a 3-D Secure authentication performed by your own 3DS server (MPI).
 type ThreeDRequest struct {
-	Enrolled    string `xml:"Enrolled"`
-	Paresstatus string `xml:"Paresstatus"`
-	Eci         string `xml:"Eci"`
-	Xid         string `xml:"Xid"`
-	Cavv        string `xml:"Cavv"`
-	Signature   string `xml:"Signature"`
-	Veres       string `xml:"Veres"`
-	Pares       string `xml:"Pares"`
+	Enrolled    string `xml:"Enrolled" json:"enrolled"`        // Enrolled whether the card is enrolled for 3-D Secure: "Y", "N" or "U"
+	Paresstatus string `xml:"Paresstatus" json:"pares_status"` // Paresstatus authentication status from the PARes: "Y", "N", "U" or "A"
+	Eci         string `xml:"Eci" json:"eci"`                  // Eci electronic commerce indicator, e.g. "05" for Visa or "02" for Mastercard
+	Xid         string `xml:"Xid" json:"xid"`                  // Xid transaction identifier of the authentication
+	Cavv        string `xml:"Cavv" json:"-"`                   // Cavv cardholder authentication verification value
+	Signature   string `xml:"Signature" json:"signature"`      // Signature verification result of the PARes signature
+	Veres       string `xml:"Veres" json:"veres"`              // Veres enrolment verification status
+	Pares       string `xml:"Pares" json:"-"`                  // Pares payer authentication response message
+}
+
+// Validate checks that the fields DPO requires for a 3-D Secure authenticated charge are present.
+func (t *ThreeDRequest) Validate() error {
+	switch t.Enrolled {
+	case "Y", "N", "U":
+	default:
+		return fmt.Errorf("invalid 3-D Secure enrolled value %q", t.Enrolled)
+	}
+	if t.Enrolled != "Y" {
+		return nil
+	}
+
+	switch t.Paresstatus {
+	case "Y", "A":
+	case "N", "U":
+		return fmt.Errorf("3-D Secure authentication was not successful: status %q", t.Paresstatus)
+	default:
+		return fmt.Errorf("invalid 3-D Secure PARes status %q", t.Paresstatus)
+	}
+	if t.Eci == "" {
+		return fmt.Errorf("3-D Secure ECI must not be empty")
+	}
+	if t.Cavv == "" {
+		return fmt.Errorf("3-D Secure CAVV must not be empty")
+	}
+	return nil
 }
 
 // ChargeCreditCardResponse response returned from after processing a credit card charge directly.
 type ChargeCreditCardResponse struct {
-	XMLName xml.Name `xml:"API3G"`
+	XMLName xml.Name `xml:"API3G" json:"-"`
 
-	Result      string `xml:"Result"`
-	Explanation string `xml:"ResultExplanation"`
-	RedirectURL string `xml:"RedirectUrl,omitempty"`
-	BackURL     string `xml:"BackUrl,omitempty"`
-	DeclinedURL string `xml:"declinedUrl,omitempty"`
+	Result      string `xml:"Result" json:"result"`
+	Explanation string `xml:"ResultExplanation" json:"result_explanation"`
+	RedirectURL string `xml:"RedirectUrl,omitempty" json:"redirect_url,omitempty"`
+	BackURL     string `xml:"BackUrl,omitempty" json:"back_url,omitempty"`
+	DeclinedURL string `xml:"declinedUrl,omitempty" json:"declined_url,omitempty"`
 }
 
 // IsError determines whether the card response is an error or not.
 func (c *ChargeCreditCardResponse) IsError() bool {
 	return c.Result != "000"
 }
+
+// RequiresChallenge determines whether DPO asks for the card holder to complete a 3-D Secure challenge.
+func (c *ChargeCreditCardResponse) RequiresChallenge() bool {
+	return c.RedirectURL != ""
+}
+
+// CreditCardCharge holds the card details for a direct card charge.
+type CreditCardCharge struct {
+	Card *Card `json:"card"` // Card the validated card to charge, see NewCard
+
+	// ThreeD holds the results of a 3-D Secure authentication done before the charge.
+	// Leave it nil to let DPO authenticate the card holder, which may result in a challenge.
+	ThreeD *ThreeDRequest `json:"three_d"`
+}
+
+// CardChargeStatus is the outcome of a direct card charge.
+type CardChargeStatus string
+
+const (
+	CardChargeApproved          CardChargeStatus = "approved"           // CardChargeApproved the card was charged
+	CardChargeChallengeRequired CardChargeStatus = "challenge_required" // CardChargeChallengeRequired the card holder must complete a 3-D Secure challenge
+)
+
+// ChargeCreditCardResult is the outcome of client.ChargeCard.
+type ChargeCreditCardResult struct {
+	Status       CardChargeStatus `json:"status"`
+	ChallengeURL string           `json:"challenge_url"` // ChallengeURL the URL to send the card holder to when Status is CardChargeChallengeRequired
+	DeclinedURL  string           `json:"declined_url"`  // DeclinedURL the URL DPO sends the card holder to when the challenge fails
+
+	Response *ChargeCreditCardResponse `json:"response"`
+}
+
+// RedirectToChallenge redirects the browser of the card holder to the 3-D Secure challenge.
+// It returns an error without writing to w when no challenge is required.
+func (r *ChargeCreditCardResult) RedirectToChallenge(w http.ResponseWriter, req *http.Request) error {
+	if r.Status != CardChargeChallengeRequired || r.ChallengeURL == "" {
+		return fmt.Errorf("no 3-D Secure challenge required")
+	}
+	http.Redirect(w, req, r.ChallengeURL, http.StatusSeeOther)
+	return nil
+}
+
+// ChargeCard charges a card directly against a token created with client.CreateToken.
+// When DPO needs the card holder to complete a 3-D Secure challenge the result has Status CardChargeChallengeRequired,
+// use result.RedirectToChallenge to send the browser there and client.VerifyRedirect when it returns to the RedirectURL.
+func (c *Client) ChargeCard(ctx context.Context, token *CreateTokenResponse, charge CreditCardCharge) (*ChargeCreditCardResult, error) {
+	if token == nil {
+		return nil, fmt.Errorf("failed to get token: nil value passed as 'token'")
+	}
+	if token.TransToken == "" {
+		return nil, fmt.Errorf("failed to get token")
+	}
+	if charge.Card == nil {
+		return nil, fmt.Errorf("card must not be nil")
+	}
+	if charge.Card.IsExpired(time.Now()) {
+		return nil, fmt.Errorf("card has expired")
+	}
+	if charge.ThreeD != nil {
+		if err := charge.ThreeD.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	cardRequest := &ChargeCreditCardRequest{
+		CompanyToken:     c.Token,
+		Request:          opChargeTokenCreditCard,
+		TransactionToken: token.TransToken,
+		CreditCardNumber: charge.Card.number,
+		// The API doesn't accept  an expiry with MM/YY it requires MMYY
+		CreditCardExpiry: charge.Card.expiryMMYY(),
+		CreditCardCVV:    charge.Card.cvv,
+		CardHolderName:   charge.Card.Holder,
+		ThreeD:           charge.ThreeD,
+	}
+
+	var cardResponse ChargeCreditCardResponse
+	if err := c.post(ctx, opChargeTokenCreditCard, cardRequest, &cardResponse); err != nil {
+		return nil, err
+	}
+
+	if cardResponse.RequiresChallenge() {
+		return &ChargeCreditCardResult{
+			Status:       CardChargeChallengeRequired,
+			ChallengeURL: cardResponse.RedirectURL,
+			DeclinedURL:  cardResponse.DeclinedURL,
+			Response:     &cardResponse,
+		}, nil
+	}
+	if cardResponse.IsError() {
+		return nil, &Error{Op: opChargeTokenCreditCard, Code: cardResponse.Result, Explanation: cardResponse.Explanation}
+	}
+
+	return &ChargeCreditCardResult{
+		Status:   CardChargeApproved,
+		Response: &cardResponse,
+	}, nil
+}
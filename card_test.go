@@ -0,0 +1,86 @@
+package dpo_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-malawi/go-dpo"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCard(t *testing.T) *dpo.Card {
+	card, err := dpo.NewCard("John Banda", "4111 1111 1111 1111", "123", "12/99")
+	assert.Nil(t, err)
+	return card
+}
+
+func TestChargeCardWithoutThreeD(t *testing.T) {
+	assert := assert.New(t)
+
+	var requests []string
+	client := newStubClient(http.StatusOK, `<API3G><Result>000</Result><ResultExplanation>Transaction charged</ResultExplanation></API3G>`, &requests)
+
+	result, err := client.ChargeCard(context.Background(), &dpo.CreateTokenResponse{TransToken: "T1"}, dpo.CreditCardCharge{
+		Card: newTestCard(t),
+	})
+	assert.Nil(err)
+	assert.Equal(dpo.CardChargeApproved, result.Status)
+	assert.NotContains(requests[0], "<ThreeD>")
+	assert.Contains(requests[0], "<CreditCardExpiry>1299</CreditCardExpiry>")
+}
+
+func TestChargeCardWithThreeD(t *testing.T) {
+	assert := assert.New(t)
+
+	var requests []string
+	client := newStubClient(http.StatusOK, `<API3G><Result>000</Result></API3G>`, &requests)
+
+	_, err := client.ChargeCard(context.Background(), &dpo.CreateTokenResponse{TransToken: "T1"}, dpo.CreditCardCharge{
+		Card:   newTestCard(t),
+		ThreeD: &dpo.ThreeDRequest{Enrolled: "Y", Paresstatus: "Y", Eci: "05", Cavv: "AAABBEg0VhI0VniQEjRWAAAAAAA="},
+	})
+	assert.Nil(err)
+	assert.Contains(requests[0], "<Eci>05</Eci>")
+
+	_, err = client.ChargeCard(context.Background(), &dpo.CreateTokenResponse{TransToken: "T1"}, dpo.CreditCardCharge{
+		Card:   newTestCard(t),
+		ThreeD: &dpo.ThreeDRequest{Enrolled: "Y", Paresstatus: "N", Eci: "07"},
+	})
+	assert.NotNil(err)
+	assert.Len(requests, 1)
+}
+
+func TestChargeCardChallenge(t *testing.T) {
+	assert := assert.New(t)
+
+	client := newStubClient(http.StatusOK, `<API3G><Result>000</Result><RedirectUrl>https://acs.example/challenge</RedirectUrl>
+<declinedUrl>https://acs.example/declined</declinedUrl></API3G>`, nil)
+
+	result, err := client.ChargeCard(context.Background(), &dpo.CreateTokenResponse{TransToken: "T1"}, dpo.CreditCardCharge{Card: newTestCard(t)})
+	assert.Nil(err)
+	assert.Equal(dpo.CardChargeChallengeRequired, result.Status)
+
+	recorder := httptest.NewRecorder()
+	assert.Nil(result.RedirectToChallenge(recorder, httptest.NewRequest("POST", "/pay", nil)))
+	assert.Equal(http.StatusSeeOther, recorder.Code)
+	assert.Equal("https://acs.example/challenge", recorder.Header().Get("Location"))
+}
+
+func TestVerifyRedirect(t *testing.T) {
+	assert := assert.New(t)
+
+	var requests []string
+	client := newStubClient(http.StatusOK, `<API3G><Result>000</Result><ResultExplanation>Transaction Paid</ResultExplanation></API3G>`, &requests)
+
+	req := httptest.NewRequest("GET", "/payment/verify?TransID=1&CCDapproval=2&TransactionToken=T1&CompanyRef=REF", nil)
+	redirect, verifyResponse, err := client.VerifyRedirect(context.Background(), req)
+	assert.Nil(err)
+	assert.Equal("REF", redirect.CompanyRef)
+	assert.Equal(dpo.StatusPaid, verifyResponse.Result)
+	assert.Contains(requests[0], "<TransactionToken>T1</TransactionToken>")
+
+	_, _, err = client.VerifyRedirect(context.Background(), httptest.NewRequest("GET", "/payment/verify", nil))
+	assert.NotNil(err)
+}
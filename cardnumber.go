@@ -0,0 +1,253 @@
+package dpo
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CardBrand is the scheme of a payment card, detected from the card number.
+type CardBrand string
+
+const (
+	BrandVisa       CardBrand = "visa"
+	BrandMastercard CardBrand = "mastercard"
+	BrandAmex       CardBrand = "amex"
+	BrandDiscover   CardBrand = "discover"
+	BrandDinersClub CardBrand = "diners"
+	BrandJCB        CardBrand = "jcb"
+	BrandUnionPay   CardBrand = "unionpay"
+	BrandMaestro    CardBrand = "maestro"
+	BrandUnknown    CardBrand = "unknown"
+)
+
+// cardBrandRule describes the number prefixes, lengths and CVV length of a card brand.
+type cardBrandRule struct {
+	brand     CardBrand
+	prefixes  [][2]int // prefixes inclusive ranges of number prefixes, compared on the number of digits of the bound
+	lengths   []int
+	cvvLength int
+}
+
+// cardBrandRules are checked in order, the first matching prefix wins.
+var cardBrandRules = []cardBrandRule{
+	{BrandAmex, [][2]int{{34, 34}, {37, 37}}, []int{15}, 4},
+	{BrandVisa, [][2]int{{4, 4}}, []int{13, 16, 19}, 3},
+	{BrandMastercard, [][2]int{{51, 55}, {2221, 2720}}, []int{16}, 3},
+	{BrandDiscover, [][2]int{{6011, 6011}, {644, 649}, {65, 65}, {622126, 622925}}, []int{16, 17, 18, 19}, 3},
+	{BrandJCB, [][2]int{{3528, 3589}}, []int{16, 17, 18, 19}, 3},
+	{BrandDinersClub, [][2]int{{300, 305}, {36, 36}, {38, 39}}, []int{14, 15, 16, 17, 18, 19}, 3},
+	{BrandUnionPay, [][2]int{{62, 62}}, []int{16, 17, 18, 19}, 3},
+	{BrandMaestro, [][2]int{{50, 50}, {56, 69}}, []int{12, 13, 14, 15, 16, 17, 18, 19}, 3},
+}
+
+// detectCardBrand returns the rule for the brand of number, or nil if the brand is unknown.
+func detectCardBrand(number string) *cardBrandRule {
+	for i := range cardBrandRules {
+		rule := &cardBrandRules[i]
+		for _, prefix := range rule.prefixes {
+			digits := len(strconv.Itoa(prefix[0]))
+			if len(number) < digits {
+				continue
+			}
+			value, err := strconv.Atoi(number[:digits])
+			if err != nil {
+				continue
+			}
+			if value >= prefix[0] && value <= prefix[1] {
+				return rule
+			}
+		}
+	}
+	return nil
+}
+
+// luhnValid checks the Luhn (mod 10) check digit of number, which must only contain digits.
+func luhnValid(number string) bool {
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		d := int(number[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// Card is a validated payment card.
+// The card number and CVV are kept unexported and are never printed or marshalled, only the last four digits are.
+type Card struct {
+	Holder string
+
+	number      string
+	cvv         string
+	brand       CardBrand
+	expiryMonth time.Month
+	expiryYear  int
+}
+
+// NewCard validates the card details and creates a Card.
+// number may contain spaces or dashes. expiry may be given as MM/YY, MMYY, MM/YYYY or MMYYYY.
+// The card must pass the Luhn check, have a valid length and CVV length for its brand and must not be expired.
+func NewCard(holder, number, cvv, expiry string) (*Card, error) {
+	month, year, err := ParseCardExpiry(expiry)
+	if err != nil {
+		return nil, err
+	}
+	return newCard(holder, number, cvv, month, year, time.Now())
+}
+
+// NewCardWithExpiry is like NewCard but takes the expiry as a time.Time, only its month and year are used.
+func NewCardWithExpiry(holder, number, cvv string, expiry time.Time) (*Card, error) {
+	return newCard(holder, number, cvv, expiry.Month(), expiry.Year(), time.Now())
+}
+
+func newCard(holder, number, cvv string, month time.Month, year int, now time.Time) (*Card, error) {
+	number = strings.NewReplacer(" ", "", "-", "").Replace(number)
+	if number == "" {
+		return nil, fmt.Errorf("card number must not be empty")
+	}
+	for _, r := range number {
+		if r < '0' || r > '9' {
+			return nil, fmt.Errorf("card number must only contain digits")
+		}
+	}
+	if len(number) < 12 || len(number) > 19 {
+		return nil, fmt.Errorf("card number must have between 12 and 19 digits")
+	}
+	if !luhnValid(number) {
+		return nil, fmt.Errorf("card number failed the Luhn check")
+	}
+
+	card := &Card{
+		Holder:      strings.TrimSpace(holder),
+		number:      number,
+		cvv:         strings.TrimSpace(cvv),
+		brand:       BrandUnknown,
+		expiryMonth: month,
+		expiryYear:  year,
+	}
+
+	cvvLengths := []int{3, 4}
+	if rule := detectCardBrand(number); rule != nil {
+		card.brand = rule.brand
+		cvvLengths = []int{rule.cvvLength}
+		if !containsInt(rule.lengths, len(number)) {
+			return nil, fmt.Errorf("invalid card number length %d for %s", len(number), rule.brand)
+		}
+	}
+
+	for _, r := range card.cvv {
+		if r < '0' || r > '9' {
+			return nil, fmt.Errorf("card CVV must only contain digits")
+		}
+	}
+	if !containsInt(cvvLengths, len(card.cvv)) {
+		return nil, fmt.Errorf("invalid CVV length %d for %s card", len(card.cvv), card.brand)
+	}
+
+	if card.IsExpired(now) {
+		return nil, fmt.Errorf("card expired at the end of %02d/%d", month, year)
+	}
+	return card, nil
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCardExpiry parses a card expiry in MM/YY, MMYY, MM/YYYY or MMYYYY format.
+func ParseCardExpiry(expiry string) (time.Month, int, error) {
+	value := strings.ReplaceAll(strings.TrimSpace(expiry), " ", "")
+	value = strings.ReplaceAll(value, "/", "")
+	if len(value) != 4 && len(value) != 6 {
+		return 0, 0, fmt.Errorf("invalid card expiry %q: use MM/YY or MM/YYYY", expiry)
+	}
+
+	month, err := strconv.Atoi(value[:2])
+	if err != nil || month < 1 || month > 12 {
+		return 0, 0, fmt.Errorf("invalid card expiry month in %q", expiry)
+	}
+	year, err := strconv.Atoi(value[2:])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid card expiry year in %q", expiry)
+	}
+	if len(value) == 4 {
+		year += 2000
+	}
+	return time.Month(month), year, nil
+}
+
+// Brand returns the detected brand of the card.
+func (c Card) Brand() CardBrand {
+	return c.brand
+}
+
+// Last4 returns the last four digits of the card number, or "" for a Card not created with NewCard.
+func (c Card) Last4() string {
+	if len(c.number) < 4 {
+		return ""
+	}
+	return c.number[len(c.number)-4:]
+}
+
+// MaskedNumber returns the card number with all but the last four digits replaced by '*'.
+func (c Card) MaskedNumber() string {
+	return MaskCardNumber(c.number)
+}
+
+// Expiry returns the expiry month and year of the card.
+func (c Card) Expiry() (time.Month, int) {
+	return c.expiryMonth, c.expiryYear
+}
+
+// IsExpired reports whether the card has expired at now. Cards are valid until the end of their expiry month.
+func (c Card) IsExpired(now time.Time) bool {
+	firstInvalid := time.Date(c.expiryYear, c.expiryMonth+1, 1, 0, 0, 0, 0, now.Location())
+	return !now.Before(firstInvalid)
+}
+
+// expiryMMYY formats the expiry in the MMYY format expected by DPO.
+func (c Card) expiryMMYY() string {
+	return fmt.Sprintf("%02d%02d", int(c.expiryMonth), c.expiryYear%100)
+}
+
+// String implements fmt.Stringer without revealing the card number or CVV.
+func (c Card) String() string {
+	return fmt.Sprintf("%s %s exp %02d/%d", c.brand, c.MaskedNumber(), int(c.expiryMonth), c.expiryYear)
+}
+
+// GoString implements fmt.GoStringer so that %#v does not reveal the card number or CVV.
+func (c Card) GoString() string {
+	return fmt.Sprintf("dpo.Card{Holder:%q, Brand:%q, Number:%q, Expiry:\"%02d/%d\"}", c.Holder, c.brand, c.MaskedNumber(), int(c.expiryMonth), c.expiryYear)
+}
+
+// MarshalJSON implements json.Marshaler, only the last four digits of the card number are included.
+func (c Card) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Holder      string    `json:"holder"`
+		Brand       CardBrand `json:"brand"`
+		Last4       string    `json:"last4"`
+		ExpiryMonth int       `json:"expiry_month"`
+		ExpiryYear  int       `json:"expiry_year"`
+	}{
+		Holder:      c.Holder,
+		Brand:       c.brand,
+		Last4:       c.Last4(),
+		ExpiryMonth: int(c.expiryMonth),
+		ExpiryYear:  c.expiryYear,
+	})
+}
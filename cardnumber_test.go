@@ -0,0 +1,102 @@
+package dpo_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang-malawi/go-dpo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCardBrands(t *testing.T) {
+	assert := assert.New(t)
+
+	cases := []struct {
+		number string
+		cvv    string
+		brand  dpo.CardBrand
+	}{
+		{"4111111111111111", "123", dpo.BrandVisa},
+		{"5555 5555 5555 4444", "123", dpo.BrandMastercard},
+		{"2223003122003222", "123", dpo.BrandMastercard},
+		{"3782-822463-10005", "1234", dpo.BrandAmex},
+		{"6011111111111117", "123", dpo.BrandDiscover},
+		{"3530111333300000", "123", dpo.BrandJCB},
+		{"30569309025904", "123", dpo.BrandDinersClub},
+	}
+	for _, c := range cases {
+		card, err := dpo.NewCard("Holder", c.number, c.cvv, "01/2099")
+		if assert.Nil(err, c.number) {
+			assert.Equal(c.brand, card.Brand(), c.number)
+		}
+	}
+}
+
+func TestNewCardValidation(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := dpo.NewCard("Holder", "4111111111111112", "123", "12/99")
+	assert.ErrorContains(err, "Luhn")
+
+	_, err = dpo.NewCard("Holder", "378282246310005", "123", "12/99")
+	assert.ErrorContains(err, "CVV")
+
+	_, err = dpo.NewCard("Holder", "4111111111111111", "123", "01/20")
+	assert.ErrorContains(err, "expired")
+
+	_, err = dpo.NewCard("Holder", "4111111111111111", "123", "13/30")
+	assert.NotNil(err)
+}
+
+func TestParseCardExpiry(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, expiry := range []string{"07/31", "0731", "07/2031", "072031"} {
+		month, year, err := dpo.ParseCardExpiry(expiry)
+		assert.Nil(err, expiry)
+		assert.Equal(time.July, month, expiry)
+		assert.Equal(2031, year, expiry)
+	}
+}
+
+func TestCardExpiresAtEndOfMonth(t *testing.T) {
+	assert := assert.New(t)
+
+	card, err := dpo.NewCardWithExpiry("Holder", "4111111111111111", "123", time.Date(2099, time.February, 1, 0, 0, 0, 0, time.UTC))
+	assert.Nil(err)
+	assert.False(card.IsExpired(time.Date(2099, time.February, 28, 23, 59, 0, 0, time.UTC)))
+	assert.True(card.IsExpired(time.Date(2099, time.March, 1, 0, 0, 0, 0, time.UTC)))
+}
+
+func TestCardDoesNotLeakNumber(t *testing.T) {
+	assert := assert.New(t)
+
+	card, err := dpo.NewCard("Holder", "4111111111111111", "987", "12/99")
+	assert.Nil(err)
+
+	data, err := json.Marshal(card)
+	assert.Nil(err)
+
+	for _, s := range []string{card.String(), fmt.Sprintf("%v", card), fmt.Sprintf("%+v", *card), fmt.Sprintf("%#v", card), string(data)} {
+		assert.NotContains(s, "4111111111111111")
+		assert.NotContains(s, "987")
+		assert.Contains(s, "1111")
+	}
+}
+
+func TestZeroCard(t *testing.T) {
+	assert := assert.New(t)
+
+	var card dpo.Card
+	assert.Equal("", card.Last4())
+	assert.Equal("", card.MaskedNumber())
+	assert.NotPanics(func() { _ = card.String() })
+
+	data, err := json.Marshal(struct {
+		Card dpo.Card `json:"card"`
+	}{})
+	assert.Nil(err)
+	assert.Contains(string(data), `"last4":""`)
+}
@@ -0,0 +1,284 @@
+package dpo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// CheckoutStatus is the status of a checkout session.
+type CheckoutStatus string
+
+const (
+	CheckoutPending   CheckoutStatus = "pending"   // CheckoutPending the customer has not completed the payment yet
+	CheckoutPaid      CheckoutStatus = "paid"      // CheckoutPaid DPO confirmed the payment
+	CheckoutFailed    CheckoutStatus = "failed"    // CheckoutFailed the payment was declined or did not match the order
+	CheckoutExpired   CheckoutStatus = "expired"   // CheckoutExpired the payment time limit passed
+	CheckoutCancelled CheckoutStatus = "cancelled" // CheckoutCancelled the token was cancelled
+)
+
+// IsFinal reports whether the status can no longer change.
+func (s CheckoutStatus) IsFinal() bool {
+	return s != CheckoutPending && s != ""
+}
+
+// checkoutStatusFor maps the Result of a verifyToken response to a checkout status.
+func checkoutStatusFor(result string) CheckoutStatus {
+	switch result {
+	case StatusPaid:
+		return CheckoutPaid
+	case StatusDeclined, StatusDataMismatch:
+		return CheckoutFailed
+	case StatusExpired:
+		return CheckoutExpired
+	case StatusCancelled:
+		return CheckoutCancelled
+	default:
+		return CheckoutPending
+	}
+}
+
+// isRequestError reports whether a verifyToken Result code means the request itself was rejected.
+func isRequestError(result string) bool {
+	switch result {
+	case "801", "802", "803", "804", "950":
+		return true
+	}
+	return false
+}
+
+// Order is what the customer pays for in a checkout.
+type Order struct {
+	ID       string
+	Amount   Money
+	Services []OrderService
+	Customer Customer
+
+	RedirectURL string // RedirectURL optional, overrides the RedirectURL of the client
+	BackURL     string // BackURL optional, overrides the BackURL of the client
+}
+
+// OrderService is a service paid for in an order, see CreateTokenRequest.AddService.
+type OrderService struct {
+	TypeCode    string
+	Description string
+	Date        time.Time
+}
+
+// CheckoutSession tracks a payment made through the DPO hosted payment page.
+// It is a view of the PaymentRecord kept for the token in the Store of the client.
+type CheckoutSession struct {
+	CompanyRef string
+	OrderID    string
+	TransToken string
+	TransRef   string
+	Amount     Money
+	PaymentURL string // PaymentURL the DPO payment page to redirect the customer to
+
+	Status            CheckoutStatus
+	Result            string // Result the last verifyToken result code
+	ResultExplanation string
+	Completed         bool // Completed whether OnComplete handled the final status
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Checkout runs the DPO hosted payment page flow: it creates tokens for orders, handles the browser redirect and
+// push notifications, verifies payments and reports the outcome of each session.
+// Sessions are kept as payments in the Store of the client, which must be set with client.SetStore.
+type Checkout struct {
+	client *Client
+
+	// LookupOrder loads an order by its id when a checkout is started.
+	LookupOrder func(ctx context.Context, orderID string) (*Order, error)
+	// OnComplete is called when a session reaches a final status, e.g. to fulfil a paid order.
+	// It is called again by later refreshes of the session until it returns nil, and may run more than once
+	// when the same session is refreshed concurrently, so it should be idempotent.
+	OnComplete func(ctx context.Context, session *CheckoutSession) error
+}
+
+// NewCheckout creates a Checkout which uses client to talk to DPO and keeps sessions in the Store of client.
+func NewCheckout(client *Client, lookupOrder func(ctx context.Context, orderID string) (*Order, error), onComplete func(ctx context.Context, session *CheckoutSession) error) *Checkout {
+	return &Checkout{
+		client:      client,
+		LookupOrder: lookupOrder,
+		OnComplete:  onComplete,
+	}
+}
+
+// store returns the Store of the client.
+func (co *Checkout) store() (Store, error) {
+	if co.client.store == nil {
+		return nil, fmt.Errorf("checkout needs a client with a Store, see client.SetStore")
+	}
+	return co.client.store, nil
+}
+
+// Start creates a token for the order and stores a pending session.
+// Redirect the customer to session.PaymentURL, e.g. with client.WritePaymentPage.
+func (co *Checkout) Start(ctx context.Context, orderID string) (*CheckoutSession, error) {
+	if co.LookupOrder == nil {
+		return nil, fmt.Errorf("checkout has no LookupOrder function")
+	}
+	store, err := co.store()
+	if err != nil {
+		return nil, err
+	}
+	order, err := co.LookupOrder(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up order %s: %w", orderID, err)
+	}
+	if order == nil {
+		return nil, fmt.Errorf("order %s not found", orderID)
+	}
+	if order.Amount.Cents <= 0 || order.Amount.Currency == "" {
+		return nil, fmt.Errorf("order %s has an invalid amount %s", orderID, order.Amount)
+	}
+	if len(order.Services) == 0 {
+		return nil, fmt.Errorf("order %s has no services", orderID)
+	}
+
+	request := co.client.NewCreateTokenRequest(co.client.Token, order.Amount.Currency, order.Amount.Float())
+	request.SetCustomer(order.Customer)
+	if order.RedirectURL != "" {
+		request.SetRedirectURL(order.RedirectURL)
+	}
+	if order.BackURL != "" {
+		request.SetBackURL(order.BackURL)
+	}
+	for _, service := range order.Services {
+		request.AddService(service.TypeCode, service.Description, service.Date)
+	}
+
+	token, err := co.client.createToken(ctx, request, order.ID)
+	if err != nil {
+		return nil, err
+	}
+	record, err := store.Payment(ctx, token.TransToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load checkout session: %w", err)
+	}
+	return co.session(record), nil
+}
+
+// session returns the CheckoutSession for record.
+func (co *Checkout) session(record *PaymentRecord) *CheckoutSession {
+	return &CheckoutSession{
+		CompanyRef:        record.CompanyRef,
+		OrderID:           record.OrderID,
+		TransToken:        record.TransToken,
+		TransRef:          record.TransRef,
+		Amount:            record.Amount,
+		PaymentURL:        co.client.MakePaymentURL(&CreateTokenResponse{TransToken: record.TransToken}),
+		Status:            checkoutStatusFor(record.Status),
+		Result:            record.Status,
+		ResultExplanation: record.StatusExplanation,
+		Completed:         record.CompletedAt != nil,
+		CreatedAt:         record.CreatedAt,
+		UpdatedAt:         record.UpdatedAt,
+	}
+}
+
+// HandleRedirect processes the browser returning from the DPO payment page to the RedirectURL or BackURL.
+// The payment is verified with DPO, the query parameters are not trusted.
+func (co *Checkout) HandleRedirect(ctx context.Context, r *http.Request) (*CheckoutSession, error) {
+	redirect, err := ParsePaymentRedirect(r)
+	if err != nil {
+		return nil, err
+	}
+	return co.Refresh(ctx, redirect.TransToken)
+}
+
+// HandleNotification processes a push notification from DPO.
+// The payment is verified with DPO, the notification content is not trusted.
+func (co *Checkout) HandleNotification(ctx context.Context, r *http.Request) (*CheckoutSession, error) {
+	notification, err := ParsePushNotification(r)
+	if err != nil {
+		return nil, err
+	}
+	return co.Refresh(ctx, notification.TransToken)
+}
+
+// NotificationHandler returns an http.Handler for the push notification URL configured with DPO.
+func (co *Checkout) NotificationHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := co.HandleNotification(r.Context(), r); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, ErrPaymentNotFound) {
+				status = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		_ = WritePushAcknowledgement(w)
+	})
+}
+
+// Refresh verifies the payment of the session for transToken and updates its status.
+// When the session reaches a final status OnComplete is called, see there.
+func (co *Checkout) Refresh(ctx context.Context, transToken string) (*CheckoutSession, error) {
+	store, err := co.store()
+	if err != nil {
+		return nil, err
+	}
+	record, err := store.Payment(ctx, transToken)
+	if err != nil {
+		return nil, err
+	}
+	if record.CompletedAt != nil {
+		return co.session(record), nil
+	}
+	// a paid status is verified again until the session is completed, as it may have been recorded
+	// by a worker that did not compare the paid amount with the order
+	if !record.IsSettled() || record.Status == StatusPaid {
+		if record, err = co.verify(ctx, store, record); err != nil {
+			return nil, err
+		}
+	}
+
+	session := co.session(record)
+	if !session.Status.IsFinal() {
+		return session, nil
+	}
+	if co.OnComplete != nil {
+		if err := co.OnComplete(ctx, session); err != nil {
+			return session, fmt.Errorf("checkout completion failed: %w", err)
+		}
+	}
+	if _, err := store.CompletePayment(ctx, transToken, time.Now()); err != nil {
+		return session, fmt.Errorf("failed to save checkout session: %w", err)
+	}
+	session.Completed = true
+	return session, nil
+}
+
+// verify requests the status of record from DPO and has the client store and publish it. A payment whose amount
+// does not match the order is recorded as StatusDataMismatch, so it is published as failed rather than succeeded.
+// It returns the updated record.
+func (co *Checkout) verify(ctx context.Context, store Store, record *PaymentRecord) (*PaymentRecord, error) {
+	verifyResponse, err := co.client.requestVerifyToken(ctx, record.TransToken)
+	if err != nil {
+		return nil, err
+	}
+	if isRequestError(verifyResponse.Result) {
+		return nil, &Error{Op: "verifyToken", Code: verifyResponse.Result, Explanation: verifyResponse.ResultExplanation}
+	}
+
+	if verifyResponse.Result == StatusPaid && verifyResponse.TransactionAmount != "" {
+		paid, err := ParseMoney(verifyResponse.TransactionAmount, verifyResponse.TransactionCurrency)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read paid amount: %v", err)
+		}
+		if cmp, err := paid.Cmp(record.Amount); err != nil || cmp != 0 {
+			verifyResponse.Result = StatusDataMismatch
+			verifyResponse.ResultExplanation = fmt.Sprintf("paid amount %s does not match order amount %s", paid, record.Amount)
+		}
+	}
+	if err := co.client.recordVerified(ctx, record.TransToken, verifyResponse); err != nil {
+		return nil, fmt.Errorf("failed to save checkout session: %w", err)
+	}
+	return store.Payment(ctx, record.TransToken)
+}
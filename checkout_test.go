@@ -0,0 +1,189 @@
+package dpo_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-malawi/go-dpo"
+	"github.com/stretchr/testify/assert"
+)
+
+func newCheckoutStubClient(verifyResult, verifyAmount string, requests *[]string) *dpo.Client {
+	return newStubClientFunc(func(requestBody string) (int, string) {
+		*requests = append(*requests, requestBody)
+		if strings.Contains(requestBody, "<Request>createToken</Request>") {
+			return http.StatusOK, `<API3G><Result>000</Result><ResultExplanation>Transaction created</ResultExplanation>
+<TransToken>T1</TransToken><TransRef>R1</TransRef></API3G>`
+		}
+		return http.StatusOK, `<API3G><Result>` + verifyResult + `</Result><ResultExplanation>status</ResultExplanation>
+<TransactionCurrency>USD</TransactionCurrency><TransactionAmount>` + verifyAmount + `</TransactionAmount></API3G>`
+	})
+}
+
+func newTestCheckout(client *dpo.Client, completed *[]*dpo.CheckoutSession) *dpo.Checkout {
+	client.SetStore(dpo.NewMemoryStore())
+	return dpo.NewCheckout(client,
+		func(ctx context.Context, orderID string) (*dpo.Order, error) {
+			return &dpo.Order{
+				ID:       orderID,
+				Amount:   dpo.Money{Cents: 1050, Currency: "USD"},
+				Services: []dpo.OrderService{{TypeCode: "3854", Description: "Ecommerce", Date: time.Now()}},
+				Customer: dpo.Customer{Email: "customer@example.com"},
+			}, nil
+		},
+		func(ctx context.Context, session *dpo.CheckoutSession) error {
+			*completed = append(*completed, session)
+			return nil
+		})
+}
+
+func TestCheckoutPaid(t *testing.T) {
+	assert := assert.New(t)
+
+	var requests []string
+	var completed []*dpo.CheckoutSession
+	checkout := newTestCheckout(newCheckoutStubClient("000", "10.50", &requests), &completed)
+
+	session, err := checkout.Start(context.Background(), "order-1")
+	assert.Nil(err)
+	assert.Equal(dpo.CheckoutPending, session.Status)
+	assert.Equal("https://secure.3gdirectpay.com/payv2.php?ID=T1", session.PaymentURL)
+	assert.Contains(requests[0], "<PaymentAmount>10.50</PaymentAmount>")
+	assert.Contains(requests[0], "<customerEmail>customer@example.com</customerEmail>")
+
+	session, err = checkout.HandleRedirect(context.Background(), httptest.NewRequest("GET", "/return?TransactionToken=T1&CompanyRef=X", nil))
+	assert.Nil(err)
+	assert.Equal(dpo.CheckoutPaid, session.Status)
+	assert.Equal("order-1", session.OrderID)
+	assert.True(session.Completed)
+
+	recorder := httptest.NewRecorder()
+	checkout.NotificationHandler().ServeHTTP(recorder, httptest.NewRequest("POST", "/notify",
+		strings.NewReader(`<API3G><Result>000</Result><TransactionToken>T1</TransactionToken></API3G>`)))
+	assert.Equal(http.StatusOK, recorder.Code)
+	assert.Contains(recorder.Body.String(), "<Response>OK</Response>")
+
+	assert.Len(completed, 1)
+}
+
+func TestCheckoutAmountMismatch(t *testing.T) {
+	assert := assert.New(t)
+
+	var requests []string
+	var completed []*dpo.CheckoutSession
+	client := newCheckoutStubClient("000", "1.00", &requests)
+	checkout := newTestCheckout(client, &completed)
+	var published []dpo.Event
+	events := dpo.NewEvents(nil)
+	events.Subscribe(func(ctx context.Context, event dpo.Event) error {
+		published = append(published, event)
+		return nil
+	})
+	client.SetEvents(events)
+
+	_, err := checkout.Start(context.Background(), "order-1")
+	assert.Nil(err)
+
+	session, err := checkout.Refresh(context.Background(), "T1")
+	assert.Nil(err)
+	assert.Equal(dpo.CheckoutFailed, session.Status)
+	assert.Equal(dpo.StatusDataMismatch, session.Result)
+	assert.Len(completed, 1)
+	var types []dpo.EventType
+	for _, event := range published {
+		types = append(types, event.Type)
+	}
+	assert.NotContains(types, dpo.EventPaymentSucceeded)
+	assert.Contains(types, dpo.EventPaymentFailed)
+
+	session, err = checkout.Refresh(context.Background(), "T1")
+	assert.Nil(err)
+	assert.Equal(dpo.CheckoutFailed, session.Status)
+	assert.Len(completed, 1)
+	assert.Len(requests, 2)
+}
+
+func TestCheckoutPending(t *testing.T) {
+	assert := assert.New(t)
+
+	var requests []string
+	var completed []*dpo.CheckoutSession
+	checkout := newTestCheckout(newCheckoutStubClient("900", "", &requests), &completed)
+
+	_, err := checkout.Start(context.Background(), "order-1")
+	assert.Nil(err)
+
+	session, err := checkout.Refresh(context.Background(), "T1")
+	assert.Nil(err)
+	assert.Equal(dpo.CheckoutPending, session.Status)
+	assert.Equal(dpo.StatusNotPaid, session.Result)
+	assert.Empty(completed)
+
+	_, err = checkout.Refresh(context.Background(), "unknown")
+	assert.ErrorIs(err, dpo.ErrPaymentNotFound)
+}
+
+func TestCheckoutRetriesFailedCompletion(t *testing.T) {
+	assert := assert.New(t)
+
+	var requests []string
+	var completed []*dpo.CheckoutSession
+	client := newCheckoutStubClient("000", "10.50", &requests)
+	checkout := newTestCheckout(client, &completed)
+	fulfil := checkout.OnComplete
+	failures := 1
+	checkout.OnComplete = func(ctx context.Context, session *dpo.CheckoutSession) error {
+		if failures > 0 {
+			failures--
+			return errors.New("warehouse unavailable")
+		}
+		return fulfil(ctx, session)
+	}
+
+	_, err := checkout.Start(context.Background(), "order-1")
+	assert.Nil(err)
+
+	session, err := checkout.Refresh(context.Background(), "T1")
+	assert.ErrorContains(err, "warehouse unavailable")
+	assert.Equal(dpo.CheckoutPaid, session.Status)
+	assert.False(session.Completed)
+	assert.Empty(completed)
+
+	session, err = checkout.Refresh(context.Background(), "T1")
+	assert.Nil(err)
+	assert.True(session.Completed)
+	assert.Len(completed, 1)
+
+	session, err = checkout.Refresh(context.Background(), "T1")
+	assert.Nil(err)
+	assert.True(session.Completed)
+	assert.Len(completed, 1)
+}
+
+func TestCheckoutStartUnknownOrder(t *testing.T) {
+	assert := assert.New(t)
+
+	var requests []string
+	client := newCheckoutStubClient("000", "10.50", &requests)
+	client.SetStore(dpo.NewMemoryStore())
+	checkout := dpo.NewCheckout(client, func(ctx context.Context, orderID string) (*dpo.Order, error) {
+		return nil, nil
+	}, nil)
+
+	_, err := checkout.Start(context.Background(), "order-1")
+	assert.ErrorContains(err, "order order-1 not found")
+	assert.Empty(requests)
+}
+
+func TestCheckoutWithoutStore(t *testing.T) {
+	var requests []string
+	checkout := dpo.NewCheckout(newCheckoutStubClient("000", "10.50", &requests), nil, nil)
+
+	_, err := checkout.Refresh(context.Background(), "T1")
+	assert.ErrorContains(t, err, "client.SetStore")
+}
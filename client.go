@@ -2,14 +2,15 @@ package dpo
 
 import (
 	"bytes"
-	"crypto/rand"
-	"encoding/base64"
+	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"math/big"
 	"net/http"
-	"strings"
+	"os"
+	"sync"
 	"time"
 )
 
@@ -23,24 +24,30 @@ const (
 type Client struct {
 	Debug       bool   // Determines whether to use test or live url
 	Token       string // Credentials key for the company
+	debugOutput io.Writer
 	http        *http.Client
 	UserAgent   string
-	maxAttempts int // Maximum number of attempts per operation
-	GenerateRef func() string
+	maxAttempts int          // Maximum number of attempts per operation
+	GenerateRef RefGenerator // GenerateRef generates the CompanyRef of new tokens, ULIDGenerator by default
 
 	RedirectURL string // RedirectURL the url to redirect to when payment flow completes
 	BackURL     string // BackURL is the url to redirect to when payment fails or is cancelled
-}
 
-// defaultCompanyRefGenerator is a function that generates a string that can be used as a Transaction ID.
-func defaultCompanyRefGenerator() string {
-	b := make([]byte, 32)
-	_, err := rand.Read(b)
-	if err != nil {
-		// TODO: default to some other random string scheme
-		panic(err) // TODO: don't panic in a library
-	}
-	return base64.RawURLEncoding.EncodeToString(b)
+	serviceCatalog *ServiceCatalog // serviceCatalog optional catalog used to validate services before creating tokens
+	refundLedger   RefundLedger    // refundLedger optional ledger tracking partial refunds per token
+	store          Store           // store optional store recording created and verified tokens
+	events         *Events         // events optional dispatcher for payment events
+	metrics        Metrics         // metrics optional receiver of request measurements
+	tracer         Tracer          // tracer optional tracer of requests and workers
+	breaker        *CircuitBreaker // breaker optional circuit breaker failing requests fast during outages
+	auditSink      AuditSink       // auditSink optional receiver of the raw requests and responses
+	onAuditError   func(err error) // onAuditError called when a record cannot be written to auditSink
+
+	idempotencyLocks keyedMutex // idempotencyLocks serialises CreateTokenIdempotent calls per CompanyRef
+
+	limitsMu     sync.Mutex
+	limits       map[string]*limiter // limits the limiters per operation, see SetLimit
+	defaultLimit Limit               // defaultLimit the limit of operations without a limit of their own
 }
 
 // xmlMarshallWithHeader marshals dat into XML with the xml header prepended.
@@ -65,6 +72,146 @@ func xmlMarshalWithHeaderDebug(data any) ([]byte, error) {
 	return xmlstring, nil
 }
 
+// singleAttemptOps are requests that are never retried because a retry could charge or refund the customer twice.
+var singleAttemptOps = map[string]bool{
+	"createToken":           true,
+	opChargeTokenCreditCard: true,
+	opChargeTokenMobile:     true,
+	opRefundToken:           true,
+}
+
+// post sends request to the DPO API and unmarshals the XML reply into response.
+// op is the API3G request name and is only used for error reporting.
+// Requests which fail with a server error are retried up to c.maxAttempts times, except for singleAttemptOps.
+// post does not inspect the Result code of the response, that is left to the caller.
+func (c *Client) post(ctx context.Context, op string, request, response any) (err error) {
+	ctx, span := c.startRequestSpan(ctx, op, request)
+	defer func() { span.end(response, err) }()
+
+	var url string
+	var xmlData []byte
+
+	if c.Debug {
+		url = testAPIURL
+		xmlData, err = xmlMarshalWithHeaderDebug(request)
+	} else {
+		url = liveAPIURL
+		xmlData, err = xmlMarshalWithHeader(request)
+	}
+
+	if err != nil {
+		return &notSentError{fmt.Errorf("failed to form XML request for %s: %v", op, err)}
+	}
+
+	if c.Debug && c.debugOutput != nil {
+		fmt.Fprintf(c.debugOutput, "using request body: %s\n", string(xmlData))
+	}
+
+	var auditRequest string
+	if c.auditSink != nil {
+		auditRequest = maskXML(xmlData)
+	}
+
+	maxAttempts := c.maxAttempts
+	if maxAttempts < 1 || singleAttemptOps[op] {
+		maxAttempts = 1
+	}
+
+	lastStatus := 0
+	for i := 0; i < maxAttempts; i++ {
+		// notSent marks errors before the first attempt was sent, later attempts follow one DPO may have processed
+		notSent := func(err error) error {
+			if i == 0 {
+				return &notSentError{err}
+			}
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(xmlData))
+		if err != nil {
+			return notSent(err)
+		}
+		req.Header.Add("User-Agent", c.UserAgent)
+		req.Header.Add("Content-Type", "application/xml")
+		req.Header.Add("Cache-control", "no-cache")
+
+		done, err := c.allowRequest(ctx, op)
+		if err != nil {
+			return notSent(err)
+		}
+		release, err := c.acquireLimit(ctx, op)
+		if err != nil {
+			done(breakerIgnored)
+			return notSent(err)
+		}
+
+		start := time.Now()
+		resp, err := c.http.Do(req)
+		if err != nil {
+			release()
+			done(breakerFailure)
+			c.observeAttempt(ctx, RequestAttempt{Op: op, Retry: i, Duration: time.Since(start), Err: err}, request, nil)
+			span.attempt(i, nil)
+			if c.auditSink != nil {
+				c.audit(ctx, AuditRecord{Op: op, Attempt: i, Request: auditRequest, Error: err.Error(), SentAt: start, ReceivedAt: time.Now()}, request)
+			}
+			return err
+		}
+
+		bodyData, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		release()
+		if err != nil || resp.StatusCode >= 500 {
+			done(breakerFailure)
+		} else {
+			done(breakerSuccess)
+		}
+		c.observeAttempt(ctx, RequestAttempt{Op: op, Retry: i, HTTPStatus: resp.StatusCode, Duration: time.Since(start), Err: err}, request, bodyData)
+		span.attempt(i, bodyData)
+		if c.auditSink != nil {
+			record := AuditRecord{Op: op, Attempt: i, Request: auditRequest, Response: string(bodyData), HTTPStatus: resp.StatusCode, SentAt: start, ReceivedAt: time.Now()}
+			if err != nil {
+				record.Error = err.Error()
+			}
+			c.audit(ctx, record, request)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read body: %s got: %v", string(bodyData), err)
+		}
+		if c.Debug && c.debugOutput != nil {
+			fmt.Fprintf(c.debugOutput, "got response body: %s\n", string(bodyData))
+		}
+
+		if resp.StatusCode == http.StatusOK {
+			if err := xml.Unmarshal(bodyData, response); err != nil {
+				return fmt.Errorf("failed unmarshal response: %v", err)
+			}
+			return nil
+		} else if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+			return fmt.Errorf("invalid response code:%d body: %s", resp.StatusCode, string(bodyData))
+		}
+		lastStatus = resp.StatusCode
+	}
+
+	return fmt.Errorf("failed to process %s request after %d attempts, last response code:%d", op, maxAttempts, lastStatus)
+}
+
+// notSentError is returned by post for failures before the request was sent to DPO,
+// e.g. while the circuit breaker is open or while waiting for a request limit.
+type notSentError struct {
+	err error
+}
+
+func (e *notSentError) Error() string { return e.err.Error() }
+
+func (e *notSentError) Unwrap() error { return e.err }
+
+// requestNotSent reports whether err returned by post is known to have happened before DPO received the request.
+func requestNotSent(err error) bool {
+	var notSent *notSentError
+	return errors.As(err, &notSent)
+}
+
 // MakePaymentURL creates a URL which should be passed to the User to redirect to the DPO system to complete the payment.
 // Requires a non-nil token created using client.CreateToken.
 func (c *Client) MakePaymentURL(token *CreateTokenResponse) string {
@@ -85,9 +232,10 @@ func NewClient(companyToken string, debug bool) *Client {
 	return &Client{
 		Debug:       debug,
 		Token:       companyToken,
+		debugOutput: os.Stdout,
 		UserAgent:   defaultUA,
 		maxAttempts: 5, // other DPO libraries use 10: see - TODO: add link
-		GenerateRef: defaultCompanyRefGenerator,
+		GenerateRef: ULIDGenerator{},
 		RedirectURL: "",
 		BackURL:     "",
 		http: &http.Client{
@@ -117,6 +265,27 @@ func (c *Client) SetUserAgent(userAgent string) {
 	c.UserAgent = userAgent
 }
 
+// SetDebugOutput sets where a debug client prints the XML it sends and receives, os.Stdout by default.
+// Passing nil stops the printing, the client keeps using the test URLs.
+func (c *Client) SetDebugOutput(w io.Writer) {
+	c.debugOutput = w
+}
+
+// SetHTTPClient sets the http.Client used for all requests to the DPO API.
+// Passing nil restores the default client with a 30 second timeout.
+func (c *Client) SetHTTPClient(httpClient *http.Client) {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	c.http = httpClient
+}
+
+// SetServiceCatalog makes client.CreateToken validate the services of each request against catalog before calling DPO.
+// Passing nil disables the validation.
+func (c *Client) SetServiceCatalog(catalog *ServiceCatalog) {
+	c.serviceCatalog = catalog
+}
+
 // SetRedirectURL sets the redirect URL which is used for all requests that require a redirect url,
 // in most cases this can be overridden by using a similar function call on the request type.
 func (c *Client) SetRedirectURL(url string) {
@@ -132,388 +301,174 @@ func (c *Client) SetBackURL(url string) {
 // CreateToken creates a token that can be used to perform payments. This is the first step in the payment flow with DPO.
 // Once the token is created it must be verified using client.VerifyToken.
 func (c *Client) CreateToken(token *CreateTokenRequest) (*CreateTokenResponse, error) {
-	if token == nil {
-		return nil, fmt.Errorf("token must not be nil")
-	}
-	var url string
-	var xmlData []byte
-	var err error
+	return c.CreateTokenContext(context.Background(), token)
+}
 
-	if c.Debug {
-		url = testAPIURL
-		xmlData, err = xmlMarshalWithHeaderDebug(token)
-	} else {
-		url = liveAPIURL
-		xmlData, err = xmlMarshalWithHeader(token)
-	}
+// CreateTokenContext is like CreateToken but the request is bound to ctx.
+func (c *Client) CreateTokenContext(ctx context.Context, token *CreateTokenRequest) (*CreateTokenResponse, error) {
+	return c.createToken(ctx, token, "")
+}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to form XML request: %s got: %v", string(xmlData), err)
+// createToken creates a token and records it in the store of the client with orderID.
+func (c *Client) createToken(ctx context.Context, token *CreateTokenRequest, orderID string) (*CreateTokenResponse, error) {
+	if token == nil {
+		return nil, fmt.Errorf("token must not be nil")
 	}
-
-	if c.Debug {
-		fmt.Printf("using request body: %s\n", string(xmlData))
+	if token.Transaction.CompanyRef == "" {
+		ref, err := c.newCompanyRef()
+		if err != nil {
+			return nil, err
+		}
+		token.Transaction.CompanyRef = ref
 	}
-
-	r := bytes.NewReader(xmlData)
-
-	req, err := http.NewRequest("POST", url, r)
-	if err != nil {
-		return nil, err
+	if c.serviceCatalog != nil {
+		if err := c.serviceCatalog.Validate(ctx, token); err != nil {
+			return nil, err
+		}
 	}
-	req.Header.Add("User-Agent", c.UserAgent)
-	req.Header.Add("Content-Type", "application/xml")
-	req.Header.Add("Cache-control", "no-cache")
 
-	resp, err := c.http.Do(req)
-	if err != nil {
+	var tokenResponse CreateTokenResponse
+	if err := c.post(ctx, "createToken", token, &tokenResponse); err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	bodyData, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read body: %s got: %v", string(bodyData), err)
-	}
-	if c.Debug {
-		fmt.Printf("got response body: %s\n", string(bodyData))
+	if tokenResponse.IsError() {
+		return nil, &Error{Op: "createToken", Code: tokenResponse.Result, Explanation: tokenResponse.ResultExplanation}
 	}
-	var tokenResponse CreateTokenResponse
-	if resp.StatusCode == http.StatusOK {
-		err = xml.Unmarshal(bodyData, &tokenResponse)
-		if err != nil {
-			return nil, fmt.Errorf("failed unmarshal response: %v", err)
-		}
-		if tokenResponse.IsError() {
-			return nil, fmt.Errorf("failed to charge card: %s", tokenResponse.ResultExplanation)
+	if c.store != nil {
+		if err := c.recordCreatedToken(ctx, token, &tokenResponse, orderID); err != nil {
+			return &tokenResponse, fmt.Errorf("token created but failed to store payment: %w", err)
 		}
-		return &tokenResponse, nil
 	}
-
-	return nil, fmt.Errorf("invalid response code:%d body: %s", resp.StatusCode, string(bodyData))
+	if c.events != nil {
+		amount, _ := ParseMoney(token.Transaction.PaymentAmount, token.Transaction.PaymentCurrency)
+		c.publish(ctx, Event{
+			ID:          string(EventTokenCreated) + ":" + tokenResponse.TransToken,
+			Type:        EventTokenCreated,
+			TransToken:  tokenResponse.TransToken,
+			CompanyRef:  token.Transaction.CompanyRef,
+			Amount:      amount,
+			Status:      tokenResponse.Result,
+			Explanation: tokenResponse.ResultExplanation,
+		})
+	}
+	return &tokenResponse, nil
 }
 
 // VerifyToken verifies the token with DPO site to prepare it for use for actual payment process.
 func (c *Client) VerifyToken(token *CreateTokenResponse) (*VerifyTokenResponse, error) {
-	verifyRequest := &VerifyTokenRequest{
-		Request:          "verifyToken",
-		CompanyToken:     c.Token,
-		TransactionToken: token.TransToken,
-	}
-
-	var url string
-	var xmlData []byte
-	var err error
-
-	if c.Debug {
-		url = testAPIURL
-		xmlData, err = xmlMarshalWithHeaderDebug(verifyRequest)
-	} else {
-		url = liveAPIURL
-		xmlData, err = xmlMarshalWithHeader(verifyRequest)
-	}
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to form XML request: %s got: %v", string(xmlData), err)
-	}
+	return c.VerifyTokenContext(context.Background(), token)
+}
 
-	if c.Debug {
-		fmt.Printf("using request body: %s\n", string(xmlData))
+// VerifyTokenContext is like VerifyToken but the request is bound to ctx.
+// The response is returned as is, check its Result for the status of the payment.
+func (c *Client) VerifyTokenContext(ctx context.Context, token *CreateTokenResponse) (*VerifyTokenResponse, error) {
+	if token == nil {
+		return nil, fmt.Errorf("token must not be nil")
 	}
+	return c.verifyToken(ctx, token.TransToken)
+}
 
-	r := bytes.NewReader(xmlData)
-	created := false
-
-	maxAttempts := c.maxAttempts
-
-	for i := 0; !created && i < maxAttempts; i++ {
-		req, err := http.NewRequest("POST", url, r)
-		if err != nil {
-			return nil, err
-		}
-		req.Header.Add("User-Agent", c.UserAgent)
-		req.Header.Add("Content-Type", "application/xml")
-		req.Header.Add("Cache-control", "no-cache")
-
-		resp, err := c.http.Do(req)
-		if err != nil {
-			return nil, err
-		}
-		defer resp.Body.Close()
-
-		bodyData, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read body: %s got: %v", string(bodyData), err)
-		}
-		if c.Debug {
-			fmt.Printf("got response body: %s\n", string(bodyData))
-		}
-		var verifyTokenResponse VerifyTokenResponse
-		if resp.StatusCode == http.StatusOK {
-			err = xml.Unmarshal(bodyData, &verifyTokenResponse)
-			if err != nil {
-				return nil, fmt.Errorf("failed unmarshal response: %v", err)
-			}
-			// if verifyTokenResponse == "900".IsError() {
-			// 	return nil, fmt.Errorf("failed to charge card: %s", verifyTokenResponse.ResultExplanation)
-			// }
-			return &verifyTokenResponse, nil
-		} else if resp.StatusCode >= 400 && resp.StatusCode < 500 {
-			return nil, fmt.Errorf("invalid response code:%d body: %s", resp.StatusCode, string(bodyData))
-		}
+// CheckToken asks DPO for the status of the transaction identified by transToken, like VerifyTokenContext,
+// but neither records the status in the client's Store nor publishes an event.
+// Use it to compare what DPO reports with your own records, e.g. when reconciling.
+func (c *Client) CheckToken(ctx context.Context, transToken string) (*VerifyTokenResponse, error) {
+	if transToken == "" {
+		return nil, fmt.Errorf("transToken must not be empty")
 	}
-
-	return nil, fmt.Errorf("failed to process request after %d attempts", c.maxAttempts)
+	return c.requestVerifyToken(ctx, transToken)
 }
 
-// ChargeCreditCard is used for charging a card directly. Do not use this yet.
-func (c *Client) ChargeCreditCard(cardHolder, cardNumber, cvv, cardExpiry string, token *CreateTokenResponse) (*ChargeCreditCardResponse, error) {
-	if token == nil {
-		return nil, fmt.Errorf("failed to get token: nil value passed as 'token'")
+// verifyToken requests the status of the transaction identified by transToken.
+// The response is returned as is, callers must check its Result.
+func (c *Client) verifyToken(ctx context.Context, transToken string) (*VerifyTokenResponse, error) {
+	verifyTokenResponse, err := c.requestVerifyToken(ctx, transToken)
+	if err != nil {
+		return nil, err
 	}
-	transactionToken := token.TransToken
-	if transactionToken == "" {
-		return nil, fmt.Errorf("failed to get token")
+	if err := c.recordVerified(ctx, transToken, verifyTokenResponse); err != nil {
+		return verifyTokenResponse, err
 	}
+	return verifyTokenResponse, nil
+}
 
-	cardRequest := &ChargeCreditCardRequest{
+// requestVerifyToken sends a verifyToken request without recording the status.
+func (c *Client) requestVerifyToken(ctx context.Context, transToken string) (*VerifyTokenResponse, error) {
+	verifyRequest := &VerifyTokenRequest{
+		Request:          "verifyToken",
 		CompanyToken:     c.Token,
-		Request:          opChargeTokenCreditCard,
-		TransactionToken: token.TransToken,
-		CreditCardNumber: cardNumber,
-		// The API doesn't accept  an expiry with MM/YY it requires MMYY
-		CreditCardExpiry: strings.ReplaceAll(cardExpiry, "/", ""),
-		CreditCardCVV:    cvv,
-		CardHolderName:   cardHolder,
-		ThreeD: ThreeDRequest{
-			Enrolled:    "Y",
-			Paresstatus: "Y",
-			Eci:         "05",
-			Xid:         "",
-			Cavv:        "",
-			Signature:   "_",
-			Veres:       "AUTHENTICATION_SUCCESSFUL",
-			Pares:       "",
-		},
-	}
-
-	var url string
-	var xmlData []byte
-	var err error
-
-	if c.Debug {
-		url = testAPIURL
-		xmlData, err = xmlMarshalWithHeaderDebug(cardRequest)
-	} else {
-		url = liveAPIURL
-		xmlData, err = xmlMarshalWithHeader(cardRequest)
+		TransactionToken: transToken,
 	}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to form XML request: %s got: %v", string(xmlData), err)
+	var verifyTokenResponse VerifyTokenResponse
+	if err := c.post(ctx, "verifyToken", verifyRequest, &verifyTokenResponse); err != nil {
+		return nil, err
 	}
+	return &verifyTokenResponse, nil
+}
 
-	if c.Debug {
-		fmt.Printf("using request body: %s\n", string(xmlData))
+// recordVerified stores the status of a verifyToken response and publishes its event.
+func (c *Client) recordVerified(ctx context.Context, transToken string, response *VerifyTokenResponse) error {
+	if c.store != nil {
+		if err := c.recordVerifiedToken(ctx, transToken, response); err != nil {
+			return fmt.Errorf("token verified but failed to store status: %w", err)
+		}
 	}
+	c.publishVerified(ctx, transToken, response)
+	return nil
+}
 
-	r := bytes.NewReader(xmlData)
-	req, err := http.NewRequest("POST", url, r)
+// ChargeCreditCard is used for charging a card directly.
+// The card details are validated with NewCard before calling DPO.
+// No 3-D Secure data is sent, so DPO may answer with a challenge, in which case the response has a RedirectURL
+// the card holder must be sent to. Use client.ChargeCard to pass 3-D Secure results from your own 3DS server.
+func (c *Client) ChargeCreditCard(cardHolder, cardNumber, cvv, cardExpiry string, token *CreateTokenResponse) (*ChargeCreditCardResponse, error) {
+	card, err := NewCard(cardHolder, cardNumber, cvv, cardExpiry)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Add("User-Agent", c.UserAgent)
-	req.Header.Add("Content-Type", "application/xml")
-	req.Header.Add("Cache-control", "no-cache")
-
-	resp, err := c.http.Do(req)
+	result, err := c.ChargeCard(context.Background(), token, CreditCardCharge{Card: card})
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	bodyData, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read body: %s got: %v", string(bodyData), err)
-	}
-	if c.Debug {
-		fmt.Printf("got response body: %s\n", string(bodyData))
-	}
-	var cardResponse ChargeCreditCardResponse
-	if resp.StatusCode == http.StatusOK {
-		err = xml.Unmarshal(bodyData, &cardResponse)
-		if err != nil {
-			return nil, fmt.Errorf("failed unmarshal response: %v", err)
-		}
-		if cardResponse.IsError() {
-			return nil, fmt.Errorf("failed to charge card: %s", cardResponse.Explanation)
-		}
-
-		return &cardResponse, nil
-	}
-
-	return nil, fmt.Errorf("invalid response code:%d body: %s", resp.StatusCode, string(bodyData))
+	return result.Response, nil
 }
 
-// CancelToken initiates token cancellations - NOT YET IMPLEMENTED
+// CancelToken cancels a token that has not been paid yet, so it can no longer be used for payment.
 func (c *Client) CancelToken(tokenStr string) (*CancelTokenResponse, error) {
+	return c.CancelTokenContext(context.Background(), tokenStr)
+}
+
+// CancelTokenContext is like CancelToken but the request is bound to ctx.
+func (c *Client) CancelTokenContext(ctx context.Context, tokenStr string) (*CancelTokenResponse, error) {
 	cancelRequest := &CancelTokenRequest{
 		Request:      "cancelToken",
 		CompanyToken: c.Token,
 		Token:        tokenStr,
 	}
 
-	var url string
-	var xmlData []byte
-	var err error
-
-	if c.Debug {
-		url = testAPIURL
-		xmlData, err = xmlMarshalWithHeaderDebug(cancelRequest)
-	} else {
-		url = liveAPIURL
-		xmlData, err = xmlMarshalWithHeader(cancelRequest)
-	}
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to form XML request: %s got: %v", string(xmlData), err)
-	}
-
-	if c.Debug {
-		fmt.Printf("using request body: %s\n", string(xmlData))
-	}
-
-	r := bytes.NewReader(xmlData)
-	created := false
-
-	maxAttempts := c.maxAttempts
-
-	for i := 0; !created && i < maxAttempts; i++ {
-		req, err := http.NewRequest("POST", url, r)
-		if err != nil {
-			return nil, err
-		}
-		req.Header.Add("User-Agent", c.UserAgent)
-		req.Header.Add("Content-Type", "application/xml")
-		req.Header.Add("Cache-control", "no-cache")
-
-		resp, err := c.http.Do(req)
-		if err != nil {
-			return nil, err
-		}
-		defer resp.Body.Close()
-
-		bodyData, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read body: %s got: %v", string(bodyData), err)
-		}
-		if c.Debug {
-			fmt.Printf("got response body: %s\n", string(bodyData))
-		}
-		var cancelTokenResponse CancelTokenResponse
-		if resp.StatusCode == http.StatusOK {
-			err = xml.Unmarshal(bodyData, &cancelTokenResponse)
-			if err != nil {
-				return nil, fmt.Errorf("failed unmarshal response: %v", err)
-			}
-
-			switch cancelTokenResponse.Result {
-			case "000":
-				return &cancelTokenResponse, nil
-			case "999", "804", "950":
-			default:
-				return &cancelTokenResponse, fmt.Errorf("dpo error: %s", cancelTokenResponse.ResultExplanation)
-			}
-		} else if resp.StatusCode >= 400 && resp.StatusCode < 500 {
-			return nil, fmt.Errorf("invalid response code:%d body: %s", resp.StatusCode, string(bodyData))
-		}
-	}
-
-	return nil, fmt.Errorf("failed to process request after %d attempts", c.maxAttempts)
-}
-
-// RefundToken initiates token refunds - NOT YET IMPLEMENTED
-func (c *Client) RefundToken(tokenStr string, refundAmount *big.Float, refundRef, description string, requiresApproval bool) (*RefundTokenResponse, error) {
-	refundApproval := 0
-	if requiresApproval {
-		refundApproval = 1
-	}
-	refundRequest := &RefundTokenRequest{
-		CompanyToken:   c.Token,
-		Request:        "refundToken",
-		Token:          tokenStr,
-		RefundAmount:   big.Float{},
-		RefundDetails:  description,
-		RefundRef:      refundRef,
-		RefundApproval: int8(refundApproval),
-	}
-
-	var url string
-	var xmlData []byte
-	var err error
-
-	if c.Debug {
-		url = testAPIURL
-		xmlData, err = xmlMarshalWithHeaderDebug(refundRequest)
-	} else {
-		url = liveAPIURL
-		xmlData, err = xmlMarshalWithHeader(refundRequest)
-	}
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to form XML request: %s got: %v", string(xmlData), err)
-	}
-
-	if c.Debug {
-		fmt.Printf("using request body: %s\n", string(xmlData))
+	var cancelTokenResponse CancelTokenResponse
+	if err := c.post(ctx, "cancelToken", cancelRequest, &cancelTokenResponse); err != nil {
+		return nil, err
 	}
-
-	r := bytes.NewReader(xmlData)
-	created := false
-
-	maxAttempts := c.maxAttempts
-
-	for i := 0; !created && i < maxAttempts; i++ {
-		req, err := http.NewRequest("POST", url, r)
-		if err != nil {
-			return nil, err
-		}
-		req.Header.Add("User-Agent", c.UserAgent)
-		req.Header.Add("Content-Type", "application/xml")
-		req.Header.Add("Cache-control", "no-cache")
-
-		resp, err := c.http.Do(req)
-		if err != nil {
-			return nil, err
-		}
-		defer resp.Body.Close()
-
-		bodyData, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read body: %s got: %v", string(bodyData), err)
-		}
-		if c.Debug {
-			fmt.Printf("got response body: %s\n", string(bodyData))
-		}
-		var refundTokenResponse RefundTokenResponse
-		if resp.StatusCode == http.StatusOK {
-			err = xml.Unmarshal(bodyData, &refundTokenResponse)
-			if err != nil {
-				return nil, fmt.Errorf("failed unmarshal response: %v", err)
-			}
-
-			switch refundTokenResponse.Result {
-			case "000":
-				return &refundTokenResponse, nil
-			case "801", "802", "803", "804", "950", "999":
-			default:
-				return &refundTokenResponse, fmt.Errorf("dpo error: %s", refundTokenResponse.ResultExplanation)
-			}
-
-		} else if resp.StatusCode >= 400 && resp.StatusCode < 500 {
-			return nil, fmt.Errorf("invalid response code:%d body: %s", resp.StatusCode, string(bodyData))
+	if cancelTokenResponse.Result != "000" {
+		return &cancelTokenResponse, &Error{Op: "cancelToken", Code: cancelTokenResponse.Result, Explanation: cancelTokenResponse.ResultExplanation}
+	}
+	if c.store != nil {
+		err := c.store.UpdateStatus(ctx, tokenStr, StatusChange{
+			Status:      StatusCancelled,
+			Explanation: cancelTokenResponse.ResultExplanation,
+			At:          time.Now(),
+		})
+		if err != nil && !errors.Is(err, ErrPaymentNotFound) {
+			return &cancelTokenResponse, fmt.Errorf("token cancelled but failed to store status: %w", err)
 		}
 	}
-
-	return nil, fmt.Errorf("failed to process request after %d attempts", c.maxAttempts)
+	c.publish(ctx, Event{
+		ID:          string(EventTokenCancelled) + ":" + tokenStr,
+		Type:        EventTokenCancelled,
+		TransToken:  tokenStr,
+		Status:      StatusCancelled,
+		Explanation: cancelTokenResponse.ResultExplanation,
+	})
+	return &cancelTokenResponse, nil
 }
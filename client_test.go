@@ -1,6 +1,9 @@
 package dpo_test
 
 import (
+	"io"
+	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/golang-malawi/go-dpo"
@@ -15,3 +18,67 @@ func TestCreateTokenWithNilToken(t *testing.T) {
 	assert.NotNil(err)
 	assert.ErrorContains(err, "token must not be nil")
 }
+
+// roundTripFunc lets tests answer API requests without a network connection.
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// newStubClient returns a client whose requests are answered with status and body.
+// Every request body received is appended to requests when it is not nil.
+func newStubClient(status int, body string, requests *[]string) *dpo.Client {
+	return newStubClientFunc(func(requestBody string) (int, string) {
+		if requests != nil {
+			*requests = append(*requests, requestBody)
+		}
+		return status, body
+	})
+}
+
+// newStubClientFunc returns a client whose requests are answered by respond.
+func newStubClientFunc(respond func(requestBody string) (int, string)) *dpo.Client {
+	client := dpo.NewClient("TOKEN", false)
+	client.SetHTTPClient(&http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			data, _ := io.ReadAll(req.Body)
+			status, body := respond(string(data))
+			return &http.Response{
+				StatusCode: status,
+				Body:       io.NopCloser(strings.NewReader(body)),
+				Header:     make(http.Header),
+			}, nil
+		}),
+	})
+	return client
+}
+
+func TestSetDebugOutput(t *testing.T) {
+	assert := assert.New(t)
+
+	client := dpo.NewClient("TOKEN", true)
+	client.SetHTTPClient(&http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(`<API3G><Result>900</Result></API3G>`)),
+				Header:     make(http.Header),
+			}, nil
+		}),
+	})
+	var out strings.Builder
+	client.SetDebugOutput(&out)
+
+	_, err := client.VerifyToken(&dpo.CreateTokenResponse{TransToken: "T1"})
+	assert.Nil(err)
+	assert.Contains(out.String(), "using request body:")
+	assert.Contains(out.String(), "<TransactionToken>T1</TransactionToken>")
+	assert.Contains(out.String(), "got response body: <API3G><Result>900</Result></API3G>")
+
+	out.Reset()
+	client.SetDebugOutput(nil)
+	_, err = client.VerifyToken(&dpo.CreateTokenResponse{TransToken: "T1"})
+	assert.Nil(err)
+	assert.Empty(out.String())
+}
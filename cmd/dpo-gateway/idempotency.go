@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// idempotencyTTL is how long responses are kept for replay.
+const idempotencyTTL = 24 * time.Hour
+
+// idempotentResponse is a response recorded for an Idempotency-Key.
+type idempotentResponse struct {
+	requestHash [32]byte
+	done        chan struct{} // done is closed once status and body are set
+	status      int
+	body        []byte
+	created     time.Time
+}
+
+// idempotencyCache remembers the responses of POST requests by Idempotency-Key.
+type idempotencyCache struct {
+	mu        sync.Mutex
+	responses map[string]*idempotentResponse
+	now       func() time.Time
+}
+
+func newIdempotencyCache() *idempotencyCache {
+	return &idempotencyCache{
+		responses: make(map[string]*idempotentResponse),
+		now:       time.Now,
+	}
+}
+
+// begin registers a request for key. When the key was seen before it returns the earlier response after
+// waiting for it to complete, and whether the request body matches the earlier one.
+func (c *idempotencyCache) begin(key string, body []byte) (previous *idempotentResponse, matches bool) {
+	hash := sha256.Sum256(body)
+
+	c.mu.Lock()
+	now := c.now()
+	for k, r := range c.responses {
+		if now.Sub(r.created) > idempotencyTTL {
+			delete(c.responses, k)
+		}
+	}
+	if r, ok := c.responses[key]; ok {
+		c.mu.Unlock()
+		<-r.done
+		return r, r.requestHash == hash
+	}
+	c.responses[key] = &idempotentResponse{requestHash: hash, done: make(chan struct{}), created: now}
+	c.mu.Unlock()
+	return nil, true
+}
+
+// finish records the response for key. Server errors are forgotten so that the request can be retried,
+// as is a status of 0 left by a handler that panicked or wrote nothing.
+func (c *idempotencyCache) finish(key string, status int, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.responses[key]
+	if !ok {
+		return
+	}
+	r.status = status
+	r.body = body
+	if status == 0 || status >= http.StatusInternalServerError {
+		delete(c.responses, key)
+	}
+	close(r.done)
+}
@@ -0,0 +1,141 @@
+// Command dpo-gateway is an HTTP service exposing DPO payments as a JSON API, for services that do not want
+// to speak API3G XML themselves.
+//
+//	POST /tokens                  create a token
+//	GET  /tokens/{token}          verify a token
+//	POST /tokens/{token}/cancel   cancel an unpaid token
+//	POST /refunds                 refund a paid transaction
+//	POST /mobile-charges          charge a mobile money account against a token
+//	GET  /dpo/redirect            RedirectURL for DPO's payment page
+//	POST /dpo/notify              notification URL for DPO's push notifications
+//
+// All endpoints except the /dpo ones need an API key in the Authorization header ("Bearer <key>") or in
+// X-API-Key. POST requests may carry an Idempotency-Key header, retries with the same key return the first
+// response instead of calling DPO again.
+//
+// Configuration is read from the environment:
+//
+//	DPO_COMPANY_TOKEN       company token (required)
+//	DPO_SANDBOX             "1" to use the DPO test environment
+//	GATEWAY_ADDR            listen address, ":8080" by default
+//	GATEWAY_API_KEYS        comma separated API keys (required)
+//	GATEWAY_PUBLIC_URL      external base URL of the gateway, used for the DPO RedirectURL
+//	GATEWAY_RETURN_URL      where customers are sent after the redirect, with trans_token and status appended
+//	GATEWAY_WEBHOOK_URL     URL receiving payment events as JSON POSTs
+//	GATEWAY_STORE_FILE      JSON lines file recording payments, kept in memory when empty
+//	GATEWAY_AUDIT_FILE      JSON lines file recording every request to and response from DPO, rotated at 100 MB
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/golang-malawi/go-dpo"
+)
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	token := os.Getenv("DPO_COMPANY_TOKEN")
+	if token == "" {
+		return errors.New("DPO_COMPANY_TOKEN must be set")
+	}
+	var apiKeys []string
+	for _, key := range strings.Split(os.Getenv("GATEWAY_API_KEYS"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			apiKeys = append(apiKeys, key)
+		}
+	}
+	if len(apiKeys) == 0 {
+		return errors.New("GATEWAY_API_KEYS must be set")
+	}
+
+	client := dpo.NewClient(token, os.Getenv("DPO_SANDBOX") == "1")
+	client.SetUserAgent("dpo-gateway")
+	if publicURL := strings.TrimRight(os.Getenv("GATEWAY_PUBLIC_URL"), "/"); publicURL != "" {
+		client.SetRedirectURL(publicURL + "/dpo/redirect")
+		client.SetBackURL(publicURL + "/dpo/redirect")
+	}
+	breaker := dpo.NewCircuitBreaker()
+	breaker.OnStateChange = func(from, to dpo.BreakerState) {
+		log.Printf("DPO circuit breaker %s -> %s", from, to)
+	}
+	client.SetCircuitBreaker(breaker)
+
+	var store interface {
+		dpo.Store
+		dpo.EventOutbox
+	}
+	if path := os.Getenv("GATEWAY_STORE_FILE"); path != "" {
+		fileStore, err := dpo.OpenFileStore(path)
+		if err != nil {
+			return err
+		}
+		defer fileStore.Close()
+		store = fileStore
+	} else {
+		store = dpo.NewMemoryStore()
+	}
+	client.SetStore(store)
+
+	if path := os.Getenv("GATEWAY_AUDIT_FILE"); path != "" {
+		auditLog, err := dpo.OpenFileAuditLog(path, 100<<20)
+		if err != nil {
+			return err
+		}
+		defer auditLog.Close()
+		client.SetAuditSink(auditLog, func(err error) {
+			log.Print(err)
+		})
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if webhookURL := os.Getenv("GATEWAY_WEBHOOK_URL"); webhookURL != "" {
+		events := dpo.NewEvents(store)
+		events.SubscribeAsync(webhookHandler(webhookURL, &http.Client{Timeout: 10 * time.Second}))
+		events.OnError = func(event dpo.Event, err error) {
+			log.Printf("event %s: %v", event.ID, err)
+		}
+		client.SetEvents(events)
+		go events.Run(ctx, time.Minute)
+		defer events.Wait()
+	}
+
+	srv := &http.Server{
+		Addr:              ":8080",
+		Handler:           newServer(client, apiKeys, os.Getenv("GATEWAY_RETURN_URL")),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if addr := os.Getenv("GATEWAY_ADDR"); addr != "" {
+		srv.Addr = addr
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		log.Printf("listening on %s", srv.Addr)
+		errs <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
@@ -0,0 +1,652 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-malawi/go-dpo"
+)
+
+// maxBodySize limits the size of request bodies.
+const maxBodySize = 1 << 20
+
+// server routes the gateway's endpoints. Routing is done by hand as net/http.ServeMux cannot match methods
+// and path parameters in the Go version this module supports.
+type server struct {
+	client      *dpo.Client
+	apiKeys     [][]byte
+	returnURL   string
+	idempotency *idempotencyCache
+}
+
+func newServer(client *dpo.Client, apiKeys []string, returnURL string) *server {
+	s := &server{
+		client:      client,
+		returnURL:   returnURL,
+		idempotency: newIdempotencyCache(),
+	}
+	for _, key := range apiKeys {
+		s.apiKeys = append(s.apiKeys, []byte(key))
+	}
+	return s
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case len(parts) == 2 && parts[0] == "dpo" && parts[1] == "redirect":
+		if allowMethod(w, r, http.MethodGet) {
+			s.handleRedirect(w, r)
+		}
+	case len(parts) == 2 && parts[0] == "dpo" && parts[1] == "notify":
+		if allowMethod(w, r, http.MethodPost) {
+			s.handleNotification(w, r)
+		}
+	case len(parts) == 1 && parts[0] == "tokens":
+		if allowMethod(w, r, http.MethodPost) && s.authorize(w, r) {
+			s.idempotent(w, r, s.handleCreateToken)
+		}
+	case len(parts) == 2 && parts[0] == "tokens" && parts[1] != "":
+		if allowMethod(w, r, http.MethodGet) && s.authorize(w, r) {
+			s.handleVerifyToken(w, r, parts[1])
+		}
+	case len(parts) == 3 && parts[0] == "tokens" && parts[1] != "" && parts[2] == "cancel":
+		if allowMethod(w, r, http.MethodPost) && s.authorize(w, r) {
+			s.idempotent(w, r, func(w http.ResponseWriter, r *http.Request) {
+				s.handleCancelToken(w, r, parts[1])
+			})
+		}
+	case len(parts) == 1 && parts[0] == "refunds":
+		if allowMethod(w, r, http.MethodPost) && s.authorize(w, r) {
+			s.idempotent(w, r, s.handleRefund)
+		}
+	case len(parts) == 1 && parts[0] == "mobile-charges":
+		if allowMethod(w, r, http.MethodPost) && s.authorize(w, r) {
+			s.idempotent(w, r, s.handleMobileCharge)
+		}
+	default:
+		writeError(w, http.StatusNotFound, "not_found", "no such endpoint")
+	}
+}
+
+// allowMethod answers 405 unless r uses method.
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", method+" required")
+	return false
+}
+
+// authorize checks the API key of r, answering 401 when it is missing or unknown.
+func (s *server) authorize(w http.ResponseWriter, r *http.Request) bool {
+	key := r.Header.Get("X-API-Key")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		key = strings.TrimPrefix(auth, "Bearer ")
+	}
+	if key != "" {
+		for _, known := range s.apiKeys {
+			if subtle.ConstantTimeCompare([]byte(key), known) == 1 {
+				return true
+			}
+		}
+	}
+	w.Header().Set("WWW-Authenticate", `Bearer realm="dpo-gateway"`)
+	writeError(w, http.StatusUnauthorized, "unauthorized", "missing or invalid API key")
+	return false
+}
+
+// responseRecorder keeps a copy of the response for the idempotency cache.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// idempotent runs handler once per Idempotency-Key and replays its response for retries with the same key.
+// Reusing a key with a different body is rejected.
+func (s *server) idempotent(w http.ResponseWriter, r *http.Request, handler http.HandlerFunc) {
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" {
+		handler(w, r)
+		return
+	}
+	if len(key) > 255 {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Idempotency-Key is too long")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "failed to read body")
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	cacheKey := r.URL.Path + "\x00" + key
+	previous, matches := s.idempotency.begin(cacheKey, body)
+	if previous != nil {
+		if !matches {
+			writeError(w, http.StatusUnprocessableEntity, "idempotency_key_reused", "Idempotency-Key was used with a different request")
+			return
+		}
+		if previous.status == 0 {
+			writeError(w, http.StatusInternalServerError, "internal_error", "the request with this Idempotency-Key failed, retry it")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(previous.status)
+		_, _ = w.Write(previous.body)
+		return
+	}
+
+	recorder := &responseRecorder{ResponseWriter: w}
+	defer func() {
+		s.idempotency.finish(cacheKey, recorder.status, recorder.body.Bytes())
+	}()
+	handler(recorder, r)
+}
+
+// decodeBody reads the JSON body of r into v, rejecting unknown fields.
+func decodeBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", err.Error())
+		return false
+	}
+	return true
+}
+
+// errorBody is the JSON body of every error response.
+type errorBody struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+		DPOCode string `json:"dpo_code,omitempty"`
+	} `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	var body errorBody
+	body.Error.Code = code
+	body.Error.Message = message
+	writeJSON(w, status, &body)
+}
+
+// writeDPOError answers with the error of a Client call: 422 for results DPO rejected, 503 while the circuit
+// breaker is open and 502 when DPO could not be reached.
+func writeDPOError(w http.ResponseWriter, err error) {
+	var dpoErr *dpo.Error
+	if errors.As(err, &dpoErr) {
+		var body errorBody
+		body.Error.Code = "dpo_error"
+		body.Error.Message = dpoErr.Explanation
+		body.Error.DPOCode = dpoErr.Code
+		writeJSON(w, http.StatusUnprocessableEntity, &body)
+		return
+	}
+	if errors.Is(err, dpo.ErrGatewayUnavailable) {
+		w.Header().Set("Retry-After", "30")
+		writeError(w, http.StatusServiceUnavailable, "gateway_unavailable", "payments are temporarily unavailable")
+		return
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		writeError(w, http.StatusGatewayTimeout, "timeout", err.Error())
+		return
+	}
+	writeError(w, http.StatusBadGateway, "gateway_error", err.Error())
+}
+
+// validToken reports whether token looks like a DPO TransToken, to keep junk out of API calls.
+func validToken(token string) bool {
+	if token == "" || len(token) > 64 {
+		return false
+	}
+	for _, r := range token {
+		if !(r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// createTokenRequest is the body of POST /tokens.
+type createTokenRequest struct {
+	Amount      string         `json:"amount"`
+	Currency    string         `json:"currency"`
+	CompanyRef  string         `json:"company_ref"`
+	RedirectURL string         `json:"redirect_url"`
+	BackURL     string         `json:"back_url"`
+	PTL         int            `json:"ptl_hours"`
+	Services    []serviceInput `json:"services"`
+	Customer    *customerInput `json:"customer"`
+}
+
+type serviceInput struct {
+	Type        string    `json:"type"`
+	Description string    `json:"description"`
+	Date        time.Time `json:"date"`
+}
+
+type customerInput struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+	Phone     string `json:"phone"`
+	DialCode  string `json:"dial_code"`
+	Address   string `json:"address"`
+	City      string `json:"city"`
+	Country   string `json:"country"`
+	Zip       string `json:"zip"`
+}
+
+// validate checks the request, returning the parsed amount or a message for the caller.
+func (req *createTokenRequest) validate() (dpo.Money, string) {
+	amount, err := dpo.ParseMoney(req.Amount, req.Currency)
+	if err != nil || amount.Cents <= 0 {
+		return dpo.Money{}, "amount must be a positive decimal amount"
+	}
+	if len(req.Currency) != 3 {
+		return dpo.Money{}, "currency must be a 3 letter ISO code"
+	}
+	if req.CompanyRef != "" {
+		if err := dpo.ValidateCompanyRef(req.CompanyRef); err != nil {
+			return dpo.Money{}, err.Error()
+		}
+	}
+	for _, u := range []string{req.RedirectURL, req.BackURL} {
+		if u == "" {
+			continue
+		}
+		if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") {
+			return dpo.Money{}, fmt.Sprintf("invalid URL %q", u)
+		}
+	}
+	if req.PTL < 0 {
+		return dpo.Money{}, "ptl_hours must not be negative"
+	}
+	if len(req.Services) == 0 {
+		return dpo.Money{}, "at least one service is required"
+	}
+	for i, service := range req.Services {
+		if service.Type == "" || service.Description == "" {
+			return dpo.Money{}, fmt.Sprintf("services[%d]: type and description are required", i)
+		}
+	}
+	return amount, ""
+}
+
+// tokenResponse is returned by POST /tokens.
+type tokenResponse struct {
+	TransToken  string `json:"trans_token"`
+	TransRef    string `json:"trans_ref"`
+	CompanyRef  string `json:"company_ref"`
+	PaymentURL  string `json:"payment_url"`
+	Explanation string `json:"explanation"`
+}
+
+func (s *server) handleCreateToken(w http.ResponseWriter, r *http.Request) {
+	var req createTokenRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	req.Currency = strings.ToUpper(req.Currency)
+	amount, msg := req.validate()
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", msg)
+		return
+	}
+
+	request := s.client.NewCreateTokenRequest(s.client.Token, req.Currency, amount.Float())
+	if req.CompanyRef != "" {
+		request.Transaction.CompanyRef = req.CompanyRef
+	}
+	if req.RedirectURL != "" {
+		request.Transaction.RedirectURL = req.RedirectURL
+	}
+	if req.BackURL != "" {
+		request.Transaction.BackURL = req.BackURL
+	}
+	if req.PTL > 0 {
+		request.Transaction.PTL = fmt.Sprint(req.PTL)
+	}
+	for _, service := range req.Services {
+		date := service.Date
+		if date.IsZero() {
+			date = time.Now()
+		}
+		request.AddService(service.Type, service.Description, date)
+	}
+	if c := req.Customer; c != nil {
+		request.SetCustomer(dpo.Customer{
+			FirstName: c.FirstName, LastName: c.LastName, Email: c.Email, Phone: c.Phone, DialCode: c.DialCode,
+			Address: c.Address, City: c.City, Country: c.Country, Zip: c.Zip,
+		})
+	}
+
+	var token *dpo.CreateTokenResponse
+	var err error
+	if key := r.Header.Get("Idempotency-Key"); key != "" && req.CompanyRef == "" {
+		// also safe across restarts of the gateway, DPO rejects a second token with the same CompanyRef
+		token, err = s.client.CreateTokenIdempotent(r.Context(), key, request)
+	} else {
+		token, err = s.client.CreateTokenContext(r.Context(), request)
+	}
+	if err != nil && token == nil {
+		writeDPOError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, &tokenResponse{
+		TransToken:  token.TransToken,
+		TransRef:    token.TransRef,
+		CompanyRef:  request.Transaction.CompanyRef,
+		PaymentURL:  s.client.MakePaymentURL(token),
+		Explanation: token.ResultExplanation,
+	})
+}
+
+// paymentStatus summarises a verifyToken Result for callers that do not want to know DPO's codes.
+func paymentStatus(result string) string {
+	switch result {
+	case dpo.StatusPaid:
+		return "paid"
+	case dpo.StatusDeclined, dpo.StatusDataMismatch:
+		return "failed"
+	case dpo.StatusExpired:
+		return "expired"
+	case dpo.StatusCancelled:
+		return "cancelled"
+	}
+	return "pending"
+}
+
+// verifyResponse is returned by GET /tokens/{token}.
+type verifyResponse struct {
+	TransToken      string `json:"trans_token"`
+	Status          string `json:"status"`
+	Result          string `json:"result"`
+	Explanation     string `json:"explanation"`
+	Amount          string `json:"amount,omitempty"`
+	Currency        string `json:"currency,omitempty"`
+	CustomerName    string `json:"customer_name,omitempty"`
+	CustomerPhone   string `json:"customer_phone,omitempty"`
+	Approval        string `json:"approval,omitempty"`
+	FraudAlert      string `json:"fraud_alert,omitempty"`
+	AccRef          string `json:"acc_ref,omitempty"`
+	TransactionDate string `json:"transaction_date,omitempty"`
+}
+
+func (s *server) handleVerifyToken(w http.ResponseWriter, r *http.Request, transToken string) {
+	if !validToken(transToken) {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid token")
+		return
+	}
+	response, err := s.client.VerifyTokenContext(r.Context(), &dpo.CreateTokenResponse{TransToken: transToken})
+	if err != nil && response == nil {
+		writeDPOError(w, err)
+		return
+	}
+	switch response.Result {
+	case "801", "802", "803", "804", "950":
+		writeDPOError(w, &dpo.Error{Op: "verifyToken", Code: response.Result, Explanation: response.ResultExplanation})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &verifyResponse{
+		TransToken:      transToken,
+		Status:          paymentStatus(response.Result),
+		Result:          response.Result,
+		Explanation:     response.ResultExplanation,
+		Amount:          response.TransactionAmount,
+		Currency:        response.TransactionCurrency,
+		CustomerName:    strings.TrimSpace(response.CustomerName),
+		CustomerPhone:   response.CustomerPhone,
+		Approval:        response.TransactionApproval,
+		FraudAlert:      response.FraudAlert,
+		AccRef:          response.AccRef,
+		TransactionDate: response.TransactionSettlementDate,
+	})
+}
+
+// resultResponse is returned by the endpoints that only report a result.
+type resultResponse struct {
+	Result      string `json:"result"`
+	Explanation string `json:"explanation"`
+}
+
+func (s *server) handleCancelToken(w http.ResponseWriter, r *http.Request, transToken string) {
+	if !validToken(transToken) {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid token")
+		return
+	}
+	response, err := s.client.CancelTokenContext(r.Context(), transToken)
+	if err != nil {
+		writeDPOError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, &resultResponse{Result: response.Result, Explanation: response.ResultExplanation})
+}
+
+// refundRequest is the body of POST /refunds.
+type refundRequest struct {
+	TransToken       string `json:"trans_token"`
+	Amount           string `json:"amount"`
+	Currency         string `json:"currency"`
+	Description      string `json:"description"`
+	Ref              string `json:"ref"`
+	RequiresApproval bool   `json:"requires_approval"`
+}
+
+// refundResponse is returned by POST /refunds.
+type refundResponse struct {
+	TransToken  string `json:"trans_token"`
+	Ref         string `json:"ref,omitempty"`
+	Status      string `json:"status"`
+	Amount      string `json:"amount"`
+	Currency    string `json:"currency"`
+	Captured    string `json:"captured"`
+	Explanation string `json:"explanation"`
+}
+
+func (s *server) handleRefund(w http.ResponseWriter, r *http.Request) {
+	var req refundRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if !validToken(req.TransToken) {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid trans_token")
+		return
+	}
+	if req.Description == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "description is required")
+		return
+	}
+	amount, err := dpo.ParseMoney(req.Amount, strings.ToUpper(req.Currency))
+	if err != nil || amount.Cents <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid_request", "amount must be a positive decimal amount")
+		return
+	}
+
+	result, err := s.client.Refund(r.Context(), dpo.Refund{
+		TransToken:       req.TransToken,
+		Amount:           amount,
+		Description:      req.Description,
+		Ref:              req.Ref,
+		RequiresApproval: req.RequiresApproval,
+	})
+	if errors.Is(err, dpo.ErrRefundExceedsCaptured) {
+		writeError(w, http.StatusUnprocessableEntity, "refund_exceeds_captured", err.Error())
+		return
+	}
+	if err != nil {
+		writeDPOError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &refundResponse{
+		TransToken:  result.TransToken,
+		Ref:         result.Ref,
+		Status:      string(result.Status),
+		Amount:      result.Amount.Decimal(),
+		Currency:    result.Amount.Currency,
+		Captured:    result.Captured.Decimal(),
+		Explanation: result.Explanation,
+	})
+}
+
+// mobileChargeRequest is the body of POST /mobile-charges.
+type mobileChargeRequest struct {
+	TransToken string `json:"trans_token"`
+	Phone      string `json:"phone"`
+	Country    string `json:"country"`
+	MNO        string `json:"mno"`
+}
+
+// mobileChargeResponse is returned by POST /mobile-charges.
+type mobileChargeResponse struct {
+	Code         int    `json:"code"`
+	Explanation  string `json:"explanation"`
+	Instructions string `json:"instructions,omitempty"`
+	RedirectURL  string `json:"redirect_url,omitempty"`
+}
+
+func (s *server) handleMobileCharge(w http.ResponseWriter, r *http.Request) {
+	var req mobileChargeRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if !validToken(req.TransToken) {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid trans_token")
+		return
+	}
+	if _, err := dpo.NewMobilePayment(req.Phone, req.MNO, req.Country); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	response, err := s.client.ChargeMobile(r.Context(), &dpo.CreateTokenResponse{TransToken: req.TransToken}, req.Phone, req.MNO, req.Country)
+	if err != nil {
+		writeDPOError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, &mobileChargeResponse{
+		Code:         response.Code,
+		Explanation:  response.Explanation,
+		Instructions: response.Instructions,
+		RedirectURL:  response.RedirectURL,
+	})
+}
+
+// handleRedirect verifies the payment the customer returns from and forwards them to the return URL.
+func (s *server) handleRedirect(w http.ResponseWriter, r *http.Request) {
+	redirect, response, err := s.client.VerifyRedirect(r.Context(), r)
+	if err != nil && response == nil {
+		if redirect == nil {
+			writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		writeDPOError(w, err)
+		return
+	}
+
+	status := paymentStatus(response.Result)
+	if s.returnURL == "" {
+		writeJSON(w, http.StatusOK, &verifyResponse{
+			TransToken:  redirect.TransToken,
+			Status:      status,
+			Result:      response.Result,
+			Explanation: response.ResultExplanation,
+			Amount:      response.TransactionAmount,
+			Currency:    response.TransactionCurrency,
+		})
+		return
+	}
+
+	target, err := url.Parse(s.returnURL)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "configuration_error", "invalid return URL")
+		return
+	}
+	query := target.Query()
+	query.Set("trans_token", redirect.TransToken)
+	query.Set("company_ref", redirect.CompanyRef)
+	query.Set("status", status)
+	target.RawQuery = query.Encode()
+	http.Redirect(w, r, target.String(), http.StatusSeeOther)
+}
+
+// handleNotification verifies the payment DPO notifies about and acknowledges the notification.
+// The notification itself is not trusted, the status comes from verifyToken.
+func (s *server) handleNotification(w http.ResponseWriter, r *http.Request) {
+	notification, err := dpo.ParsePushNotification(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if _, err := s.client.VerifyTokenContext(r.Context(), &dpo.CreateTokenResponse{TransToken: notification.TransToken}); err != nil {
+		// answer with an error so DPO sends the notification again
+		writeDPOError(w, err)
+		return
+	}
+	_ = dpo.WritePushAcknowledgement(w)
+}
+
+// webhookHandler returns an event handler posting events as JSON to webhookURL.
+func webhookHandler(webhookURL string, httpClient *http.Client) dpo.EventHandler {
+	return func(ctx context.Context, event dpo.Event) error {
+		body, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", event.ID)
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		_, _ = io.Copy(io.Discard, resp.Body)
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("webhook answered %s", resp.Status)
+		}
+		return nil
+	}
+}
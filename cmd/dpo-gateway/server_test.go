@@ -0,0 +1,246 @@
+package main
+
+import (
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-malawi/go-dpo"
+	"github.com/stretchr/testify/assert"
+)
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// newTestServer returns a gateway whose client gets its DPO answers from respond.
+func newTestServer(respond func(requestBody string) string) (*server, *int) {
+	var mu sync.Mutex
+	calls := 0
+	client := dpo.NewClient("TOKEN", false)
+	client.SetHTTPClient(&http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			data, _ := io.ReadAll(req.Body)
+			mu.Lock()
+			calls++
+			mu.Unlock()
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(respond(string(data)))),
+				Header:     make(http.Header),
+			}, nil
+		}),
+	})
+	client.SetStore(dpo.NewMemoryStore())
+	return newServer(client, []string{"secret"}, "https://shop.example.com/return"), &calls
+}
+
+func doRequest(s *server, method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	return w
+}
+
+const createdResponse = `<API3G><Result>000</Result><ResultExplanation>Transaction created</ResultExplanation><TransToken>T1</TransToken><TransRef>R1</TransRef></API3G>`
+
+func TestCreateToken(t *testing.T) {
+	assert := assert.New(t)
+
+	s, calls := newTestServer(func(string) string { return createdResponse })
+	body := `{"amount": "10.50", "currency": "usd", "company_ref": "ORDER-1", "services": [{"type": "3854", "description": "Shoes"}]}`
+	w := doRequest(s, http.MethodPost, "/tokens", body, nil)
+
+	assert.Equal(http.StatusCreated, w.Code, w.Body.String())
+	assert.Contains(w.Body.String(), `"trans_token":"T1"`)
+	assert.Contains(w.Body.String(), `"company_ref":"ORDER-1"`)
+	assert.Equal(1, *calls)
+}
+
+func TestCreateTokenIdempotencyKey(t *testing.T) {
+	assert := assert.New(t)
+
+	s, calls := newTestServer(func(requestBody string) string {
+		if strings.Contains(requestBody, "getTransactionByRef") {
+			return `<API3G><Result>999</Result><ResultExplanation>Not found</ResultExplanation></API3G>`
+		}
+		return createdResponse
+	})
+	body := `{"amount": "10.50", "currency": "USD", "services": [{"type": "3854", "description": "Shoes"}]}`
+	header := map[string]string{"Idempotency-Key": "order-1"}
+
+	first := doRequest(s, http.MethodPost, "/tokens", body, header)
+	second := doRequest(s, http.MethodPost, "/tokens", body, header)
+	assert.Equal(http.StatusCreated, first.Code, first.Body.String())
+	assert.Equal(first.Body.String(), second.Body.String())
+	assert.Equal("true", second.Header().Get("Idempotent-Replayed"))
+	assert.Equal(2, *calls) // getTransactionByRef and createToken
+
+	reused := doRequest(s, http.MethodPost, "/tokens", strings.Replace(body, "10.50", "11.00", 1), header)
+	assert.Equal(http.StatusUnprocessableEntity, reused.Code)
+}
+
+func TestCreateTokenValidation(t *testing.T) {
+	assert := assert.New(t)
+
+	s, calls := newTestServer(func(string) string { return createdResponse })
+	for _, body := range []string{
+		`{"amount": "ten", "currency": "USD", "services": [{"type": "3854", "description": "Shoes"}]}`,
+		`{"amount": ".", "currency": "USD", "services": [{"type": "3854", "description": "Shoes"}]}`,
+		`{"amount": "-", "currency": "USD", "services": [{"type": "3854", "description": "Shoes"}]}`,
+		`{"amount": "+", "currency": "USD", "services": [{"type": "3854", "description": "Shoes"}]}`,
+		`{"amount": "0", "currency": "USD", "services": [{"type": "3854", "description": "Shoes"}]}`,
+		`{"amount": "-5", "currency": "USD", "services": [{"type": "3854", "description": "Shoes"}]}`,
+		`{"amount": "10", "currency": "USD", "services": []}`,
+		`{"amount": "10", "currency": "USD", "company_ref": "bad ref", "services": [{"type": "3854", "description": "Shoes"}]}`,
+		`{"amount": "10", "currency": "USD", "unknown": true}`,
+	} {
+		w := doRequest(s, http.MethodPost, "/tokens", body, nil)
+		assert.Equal(http.StatusBadRequest, w.Code, body)
+	}
+	assert.Equal(0, *calls)
+}
+
+func TestVerifyToken(t *testing.T) {
+	assert := assert.New(t)
+
+	s, _ := newTestServer(func(string) string {
+		return `<API3G><Result>000</Result><ResultExplanation>Transaction paid</ResultExplanation><TransactionAmount>10.50</TransactionAmount><TransactionCurrency>USD</TransactionCurrency></API3G>`
+	})
+	w := doRequest(s, http.MethodGet, "/tokens/T1", "", nil)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), `"status":"paid"`)
+	assert.Contains(w.Body.String(), `"amount":"10.50"`)
+
+	w = doRequest(s, http.MethodPost, "/tokens/T1", "", nil)
+	assert.Equal(http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestCancelTokenDPOError(t *testing.T) {
+	assert := assert.New(t)
+
+	s, _ := newTestServer(func(string) string {
+		return `<API3G><Result>804</Result><ResultExplanation>Token already paid</ResultExplanation></API3G>`
+	})
+	w := doRequest(s, http.MethodPost, "/tokens/T1/cancel", "", nil)
+	assert.Equal(http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(w.Body.String(), `"dpo_code":"804"`)
+}
+
+func TestGatewayUnavailable(t *testing.T) {
+	assert := assert.New(t)
+
+	s, calls := newTestServer(func(string) string {
+		return `<API3G><Result>900</Result><ResultExplanation>Transaction not paid yet</ResultExplanation></API3G>`
+	})
+	s.client.SetHTTPClient(&http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			*calls++
+			return &http.Response{StatusCode: http.StatusBadGateway, Body: io.NopCloser(strings.NewReader("")), Header: make(http.Header)}, nil
+		}),
+	})
+	breaker := dpo.NewCircuitBreaker()
+	breaker.FailureThreshold = 1
+	s.client.SetCircuitBreaker(breaker)
+
+	w := doRequest(s, http.MethodGet, "/tokens/T1", "", nil)
+	assert.Equal(http.StatusServiceUnavailable, w.Code)
+	assert.Equal("30", w.Header().Get("Retry-After"))
+	assert.Contains(w.Body.String(), `"code":"gateway_unavailable"`)
+	assert.Equal(1, *calls)
+}
+
+func TestAuthorization(t *testing.T) {
+	assert := assert.New(t)
+
+	s, calls := newTestServer(func(string) string { return createdResponse })
+	req := httptest.NewRequest(http.MethodGet, "/tokens/T1", nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	assert.Equal(http.StatusUnauthorized, w.Code)
+
+	w = doRequest(s, http.MethodGet, "/tokens/T1", "", map[string]string{"Authorization": "Bearer wrong"})
+	assert.Equal(http.StatusUnauthorized, w.Code)
+	assert.Equal(0, *calls)
+
+	w = doRequest(s, http.MethodGet, "/unknown", "", nil)
+	assert.Equal(http.StatusNotFound, w.Code)
+}
+
+func TestRedirectAndNotification(t *testing.T) {
+	assert := assert.New(t)
+
+	s, _ := newTestServer(func(string) string {
+		return `<API3G><Result>000</Result><ResultExplanation>Transaction paid</ResultExplanation></API3G>`
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/dpo/redirect?TransID=T1&CompanyRef=ORDER-1&TransactionToken=T1", nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	assert.Equal(http.StatusSeeOther, w.Code)
+	assert.Contains(w.Header().Get("Location"), "status=paid")
+	assert.Contains(w.Header().Get("Location"), "trans_token=T1")
+
+	req = httptest.NewRequest(http.MethodPost, "/dpo/notify", strings.NewReader(`<API3G><Result>000</Result><TransactionToken>T1</TransactionToken></API3G>`))
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), "<Response>OK</Response>")
+}
+
+func TestIdempotencyKeyFailedHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	s, _ := newTestServer(func(string) string { return createdResponse })
+	run := func(handler http.HandlerFunc) (w *httptest.ResponseRecorder, panicked bool) {
+		req := httptest.NewRequest(http.MethodPost, "/tokens", strings.NewReader(`{}`))
+		req.Header.Set("Idempotency-Key", "order-1")
+		w = httptest.NewRecorder()
+		defer func() { panicked = recover() != nil }()
+		s.idempotent(w, req, handler)
+		return w, false
+	}
+	created := func(w http.ResponseWriter, r *http.Request) { writeJSON(w, http.StatusCreated, map[string]string{}) }
+
+	_, panicked := run(func(http.ResponseWriter, *http.Request) { panic("handler failed") })
+	assert.True(panicked)
+	_, panicked = run(func(http.ResponseWriter, *http.Request) {})
+	assert.False(panicked)
+
+	w, panicked := run(created)
+	assert.False(panicked)
+	assert.Equal(http.StatusCreated, w.Code)
+	assert.Empty(w.Header().Get("Idempotent-Replayed"))
+
+	w, _ = run(func(http.ResponseWriter, *http.Request) { t.Error("handler ran for a replay") })
+	assert.Equal(http.StatusCreated, w.Code)
+	assert.Equal("true", w.Header().Get("Idempotent-Replayed"))
+}
+
+func TestIdempotencyKeyFailedWhileWaiting(t *testing.T) {
+	assert := assert.New(t)
+
+	// a request waiting in begin holds on to the entry of a handler that panicked after it was deleted
+	s, _ := newTestServer(func(string) string { return createdResponse })
+	failed := &idempotentResponse{requestHash: sha256.Sum256([]byte(`{}`)), done: make(chan struct{}), created: time.Now()}
+	close(failed.done)
+	s.idempotency.responses["/tokens\x00order-1"] = failed
+
+	req := httptest.NewRequest(http.MethodPost, "/tokens", strings.NewReader(`{}`))
+	req.Header.Set("Idempotency-Key", "order-1")
+	w := httptest.NewRecorder()
+	s.idempotent(w, req, func(http.ResponseWriter, *http.Request) { t.Error("handler ran for a waiting request") })
+	assert.Equal(http.StatusInternalServerError, w.Code)
+	assert.Contains(w.Body.String(), "internal_error")
+}
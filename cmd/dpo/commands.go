@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/golang-malawi/go-dpo"
+)
+
+var commands = map[string]command{
+	"create-token":  {args: "", summary: "create a payment token", flags: createTokenCommand},
+	"verify":        {args: "<trans-token>", summary: "show the status of a payment", flags: verifyCommand},
+	"cancel":        {args: "<trans-token>", summary: "cancel an unpaid token", flags: cancelCommand},
+	"refund":        {args: "<trans-token>", summary: "refund all or part of a paid transaction", flags: refundCommand},
+	"charge-mobile": {args: "<trans-token>", summary: "charge a mobile money account against a token", flags: chargeMobileCommand},
+	"lookup-ref":    {args: "<company-ref>", summary: "find the tokens created with a company reference", flags: lookupRefCommand},
+	"balance":       {args: "", summary: "show the account balance per currency", flags: balanceCommand},
+	"payment-url":   {args: "<trans-token>", summary: "print the payment page URL, optionally as a QR code", flags: paymentURLCommand},
+}
+
+// field is a labelled value of a table.
+type field struct {
+	label string
+	value string
+}
+
+// print writes fields as a table, or v as JSON when --json was given.
+func (e *env) print(v any, fields ...field) error {
+	if e.json {
+		encoder := json.NewEncoder(e.out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+	tw := tabwriter.NewWriter(e.out, 0, 4, 2, ' ', 0)
+	for _, f := range fields {
+		if f.value != "" {
+			fmt.Fprintf(tw, "%s:\t%s\n", f.label, f.value)
+		}
+	}
+	return tw.Flush()
+}
+
+// oneArg returns the single positional argument named name.
+func oneArg(args []string, name string) (string, error) {
+	if len(args) != 1 || args[0] == "" {
+		return "", usagef("expected exactly one %s argument", name)
+	}
+	return args[0], nil
+}
+
+func createTokenCommand(fs *flag.FlagSet) func(ctx context.Context, e *env, args []string) error {
+	amount := fs.String("amount", "", "amount to pay, e.g. 10.50 (required)")
+	currency := fs.String("currency", "", "ISO currency code, e.g. USD (required)")
+	serviceType := fs.String("service", "", "service type code (required)")
+	description := fs.String("description", "Payment", "service description")
+	ref := fs.String("ref", "", "company reference, generated when empty")
+	key := fs.String("idempotency-key", "", "return the existing token for this key instead of creating a second one")
+	redirectURL := fs.String("redirect-url", "", "URL the customer returns to after paying")
+	backURL := fs.String("back-url", "", "URL the customer returns to when cancelling")
+	ptl := fs.String("ptl", "", "payment time limit in hours")
+
+	return func(ctx context.Context, e *env, args []string) error {
+		if len(args) > 0 {
+			return usagef("unexpected arguments %q", args)
+		}
+		if *amount == "" || *currency == "" || *serviceType == "" {
+			return usagef("--amount, --currency and --service are required")
+		}
+		money, err := dpo.ParseMoney(*amount, *currency)
+		if err != nil || money.Cents <= 0 {
+			return usagef("invalid amount %q", *amount)
+		}
+
+		request := e.client.NewCreateTokenRequest(e.client.Token, money.Currency, money.Float())
+		request.AddService(*serviceType, *description, time.Now())
+		if *ref != "" {
+			request.Transaction.CompanyRef = *ref
+		}
+		if *redirectURL != "" {
+			request.Transaction.RedirectURL = *redirectURL
+		}
+		if *backURL != "" {
+			request.Transaction.BackURL = *backURL
+		}
+		if *ptl != "" {
+			request.Transaction.PTL = *ptl
+		}
+
+		var token *dpo.CreateTokenResponse
+		if *key != "" {
+			token, err = e.client.CreateTokenIdempotent(ctx, *key, request)
+		} else {
+			token, err = e.client.CreateTokenContext(ctx, request)
+		}
+		if err != nil {
+			return err
+		}
+
+		paymentURL := e.client.MakePaymentURL(token)
+		return e.print(struct {
+			*dpo.CreateTokenResponse
+			CompanyRef string `json:"company_ref"`
+			PaymentURL string `json:"payment_url"`
+		}{token, request.Transaction.CompanyRef, paymentURL},
+			field{"Trans token", token.TransToken},
+			field{"Trans ref", token.TransRef},
+			field{"Company ref", request.Transaction.CompanyRef},
+			field{"Payment URL", paymentURL},
+		)
+	}
+}
+
+func verifyCommand(fs *flag.FlagSet) func(ctx context.Context, e *env, args []string) error {
+	return func(ctx context.Context, e *env, args []string) error {
+		transToken, err := oneArg(args, "trans-token")
+		if err != nil {
+			return err
+		}
+		response, err := e.client.VerifyTokenContext(ctx, &dpo.CreateTokenResponse{TransToken: transToken})
+		if err != nil {
+			return err
+		}
+		amount := strings.TrimSpace(response.TransactionAmount + " " + response.TransactionCurrency)
+		if err := e.print(response,
+			field{"Result", response.Result},
+			field{"Explanation", response.ResultExplanation},
+			field{"Amount", amount},
+			field{"Customer", strings.TrimSpace(response.CustomerName)},
+			field{"Approval", response.TransactionApproval},
+			field{"Fraud alert", response.FraudAlert},
+		); err != nil {
+			return err
+		}
+		if response.Result != dpo.StatusPaid {
+			return &dpo.Error{Op: "verifyToken", Code: response.Result, Explanation: response.ResultExplanation}
+		}
+		return nil
+	}
+}
+
+func cancelCommand(fs *flag.FlagSet) func(ctx context.Context, e *env, args []string) error {
+	return func(ctx context.Context, e *env, args []string) error {
+		transToken, err := oneArg(args, "trans-token")
+		if err != nil {
+			return err
+		}
+		response, err := e.client.CancelTokenContext(ctx, transToken)
+		if err != nil {
+			return err
+		}
+		return e.print(response,
+			field{"Result", response.Result},
+			field{"Explanation", response.ResultExplanation},
+		)
+	}
+}
+
+func refundCommand(fs *flag.FlagSet) func(ctx context.Context, e *env, args []string) error {
+	amount := fs.String("amount", "", "amount to refund, e.g. 5.00 (required)")
+	currency := fs.String("currency", "", "currency of the amount, defaults to the currency of the transaction")
+	description := fs.String("description", "", "reason for the refund (required)")
+	ref := fs.String("ref", "", "reference of the refund in your system")
+	approval := fs.Bool("approval", false, "submit the refund for approval in DPO instead of processing it")
+
+	return func(ctx context.Context, e *env, args []string) error {
+		transToken, err := oneArg(args, "trans-token")
+		if err != nil {
+			return err
+		}
+		if *amount == "" || *description == "" {
+			return usagef("--amount and --description are required")
+		}
+		money, err := dpo.ParseMoney(*amount, strings.ToUpper(*currency))
+		if err != nil {
+			return usagef("%v", err)
+		}
+
+		result, err := e.client.Refund(ctx, dpo.Refund{
+			TransToken:       transToken,
+			Amount:           money,
+			Description:      *description,
+			Ref:              *ref,
+			RequiresApproval: *approval,
+		})
+		if err != nil {
+			return err
+		}
+		return e.print(result,
+			field{"Status", string(result.Status)},
+			field{"Amount", result.Amount.String()},
+			field{"Captured", result.Captured.String()},
+			field{"Explanation", result.Explanation},
+		)
+	}
+}
+
+func chargeMobileCommand(fs *flag.FlagSet) func(ctx context.Context, e *env, args []string) error {
+	phone := fs.String("phone", "", "phone number in local or international format (required)")
+	country := fs.String("country", "", "country name or ISO code, e.g. malawi or MW (required)")
+	mno := fs.String("mno", "", "mobile network, detected from the number when empty")
+
+	return func(ctx context.Context, e *env, args []string) error {
+		transToken, err := oneArg(args, "trans-token")
+		if err != nil {
+			return err
+		}
+		if *phone == "" || *country == "" {
+			return usagef("--phone and --country are required")
+		}
+		response, err := e.client.ChargeMobile(ctx, &dpo.CreateTokenResponse{TransToken: transToken}, *phone, *mno, *country)
+		if err != nil {
+			return err
+		}
+		return e.print(response,
+			field{"Code", fmt.Sprintf("%03d", response.Code)},
+			field{"Explanation", response.Explanation},
+			field{"Instructions", response.Instructions},
+			field{"Redirect URL", response.RedirectURL},
+		)
+	}
+}
+
+func lookupRefCommand(fs *flag.FlagSet) func(ctx context.Context, e *env, args []string) error {
+	latest := fs.Bool("latest", false, "list only the latest token created with the reference")
+
+	return func(ctx context.Context, e *env, args []string) error {
+		companyRef, err := oneArg(args, "company-ref")
+		if err != nil {
+			return err
+		}
+		transactions, err := e.client.TransactionByRef(ctx, companyRef, &dpo.TransactionByRefOptions{LatestOnly: *latest})
+		if err != nil {
+			return err
+		}
+		if e.json {
+			return e.print(transactions)
+		}
+
+		tw := tabwriter.NewWriter(e.out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "TRANS TOKEN\tRESULT\tAMOUNT\tCREATED\tEXPLANATION")
+		for _, t := range transactions {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", t.TransToken, t.Result,
+				strings.TrimSpace(t.TransactionAmount+" "+t.TransactionCurrency), t.TransactionCreatedDate, t.ResultExplanation)
+		}
+		return tw.Flush()
+	}
+}
+
+func balanceCommand(fs *flag.FlagSet) func(ctx context.Context, e *env, args []string) error {
+	currency := fs.String("currency", "", "only show this currency")
+
+	return func(ctx context.Context, e *env, args []string) error {
+		if len(args) > 0 {
+			return usagef("unexpected arguments %q", args)
+		}
+		balance, err := e.client.Balance(ctx, strings.ToUpper(*currency))
+		if err != nil {
+			return err
+		}
+		if e.json {
+			return e.print(balance)
+		}
+
+		tw := tabwriter.NewWriter(e.out, 0, 4, 2, ' ', 0)
+		if !balance.AsOf.IsZero() {
+			fmt.Fprintf(tw, "As of:\t%s\n", balance.AsOf.Format(time.RFC3339))
+		}
+		for _, amount := range balance.Amounts {
+			fmt.Fprintf(tw, "%s:\t%s\n", amount.Currency, amount.Decimal())
+		}
+		return tw.Flush()
+	}
+}
+
+func paymentURLCommand(fs *flag.FlagSet) func(ctx context.Context, e *env, args []string) error {
+	qr := fs.String("qr", "", "also write a QR code of the URL to this .png or .svg file")
+	scale := fs.Int("scale", 8, "size of a QR code module in pixels")
+
+	return func(ctx context.Context, e *env, args []string) error {
+		transToken, err := oneArg(args, "trans-token")
+		if err != nil {
+			return err
+		}
+		token := &dpo.CreateTokenResponse{TransToken: transToken}
+
+		if *qr != "" {
+			if err := writeQRCode(e.client, token, *qr, *scale); err != nil {
+				return err
+			}
+		}
+		paymentURL := e.client.MakePaymentURL(token)
+		if e.json {
+			return e.print(struct {
+				PaymentURL string `json:"payment_url"`
+			}{paymentURL})
+		}
+		_, err = fmt.Fprintln(e.out, paymentURL)
+		return err
+	}
+}
+
+// writeQRCode writes the QR code of the payment URL to path, the format follows the file extension.
+func writeQRCode(client *dpo.Client, token *dpo.CreateTokenResponse, path string, scale int) error {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".png" && ext != ".svg" {
+		return usagef("--qr must end in .png or .svg")
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if ext == ".png" {
+		err = client.WritePaymentQRCodePNG(file, token, scale)
+	} else {
+		err = client.WritePaymentQRCodeSVG(file, token, scale)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,282 @@
+// Command dpo is a command line tool for checking and acting on DPO payments without writing Go.
+//
+//	dpo [--sandbox] [--json] [--config file] <command> [flags] [args]
+//
+// The company token is read from the DPO_COMPANY_TOKEN (or DPO_TOKEN) environment variable, or from a JSON
+// config file given with --config, DPO_CONFIG or found at $XDG_CONFIG_HOME/dpo/config.json:
+//
+//	{"company_token": "...", "sandbox": true}
+//
+// Exit codes follow the DPO result code so the tool can be used in scripts:
+//
+//	0  success, or the payment is paid
+//	1  local, network or unexpected error
+//	2  invalid usage
+//	3  the payment is pending (900, 001, 003, 005, 007)
+//	4  the payment was declined (901, 902)
+//	5  the token expired or was cancelled (903, 904)
+//	6  DPO rejected the request (801-804, 950)
+//	7  any other DPO error code
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+
+	"github.com/golang-malawi/go-dpo"
+)
+
+const (
+	exitOK       = 0
+	exitError    = 1
+	exitUsage    = 2
+	exitPending  = 3
+	exitDeclined = 4
+	exitExpired  = 5
+	exitRejected = 6
+	exitDPOError = 7
+)
+
+// config is the content of the config file.
+type config struct {
+	CompanyToken string `json:"company_token"`
+	Sandbox      bool   `json:"sandbox"`
+	UserAgent    string `json:"user_agent"`
+}
+
+// options are the flags shared by all commands.
+type options struct {
+	configPath string
+	sandbox    bool
+	json       bool
+}
+
+func (o *options) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.configPath, "config", o.configPath, "path of the JSON config file")
+	fs.BoolVar(&o.sandbox, "sandbox", o.sandbox, "use the DPO test environment")
+	fs.BoolVar(&o.json, "json", o.json, "print JSON instead of tables")
+}
+
+// env is what commands run with.
+type env struct {
+	client *dpo.Client
+	out    io.Writer
+	json   bool
+}
+
+// command is a subcommand of the tool.
+type command struct {
+	args    string // args describes the positional arguments
+	summary string
+	flags   func(fs *flag.FlagSet) func(ctx context.Context, e *env, args []string) error
+}
+
+// usageError is returned for invalid command lines.
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+func usagef(format string, args ...any) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// run executes the command line args and returns the exit code.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	var opts options
+	global := flag.NewFlagSet("dpo", flag.ContinueOnError)
+	global.SetOutput(stderr)
+	opts.register(global)
+	global.Usage = func() { printUsage(stderr, global) }
+	if err := global.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if global.NArg() == 0 {
+		printUsage(stderr, global)
+		return exitUsage
+	}
+
+	name := global.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(stderr, "dpo: unknown command %q\n", name)
+		printUsage(stderr, global)
+		return exitUsage
+	}
+
+	fs := flag.NewFlagSet("dpo "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	opts.register(fs)
+	runCommand := cmd.flags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: dpo %s [flags] %s\n\n%s\n\nflags:\n", name, cmd.args, cmd.summary)
+		fs.PrintDefaults()
+	}
+	positional, err := parseInterspersed(fs, global.Args()[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	client, err := newClient(opts)
+	if err != nil {
+		fmt.Fprintf(stderr, "dpo: %v\n", err)
+		return exitUsage
+	}
+	err = runCommand(ctx, &env{client: client, out: stdout, json: opts.json}, positional)
+	if err != nil {
+		fmt.Fprintf(stderr, "dpo %s: %v\n", name, err)
+		var usage *usageError
+		if errors.As(err, &usage) {
+			fs.Usage()
+		}
+	}
+	return exitCode(err)
+}
+
+// parseInterspersed parses args with fs allowing flags after positional arguments, e.g. "verify TOKEN --json".
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		if args[0] == "--" {
+			return append(positional, args[1:]...), nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func printUsage(w io.Writer, global *flag.FlagSet) {
+	fmt.Fprintln(w, "usage: dpo [flags] <command> [command flags] [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-14s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "flags:")
+	global.PrintDefaults()
+}
+
+// newClient creates the client from the environment and config file.
+func newClient(opts options) (*dpo.Client, error) {
+	cfg, err := loadConfig(opts.configPath)
+	if err != nil {
+		return nil, err
+	}
+	token := cfg.CompanyToken
+	for _, name := range []string{"DPO_COMPANY_TOKEN", "DPO_TOKEN"} {
+		if value := os.Getenv(name); value != "" {
+			token = value
+			break
+		}
+	}
+	if token == "" {
+		return nil, fmt.Errorf("no company token, set DPO_COMPANY_TOKEN or company_token in the config file")
+	}
+
+	sandbox := opts.sandbox || cfg.Sandbox || os.Getenv("DPO_SANDBOX") == "1"
+	client := dpo.NewClient(token, sandbox)
+	// keep stdout for the output of the commands
+	client.SetDebugOutput(nil)
+	if cfg.UserAgent != "" {
+		client.SetUserAgent(cfg.UserAgent)
+	}
+	return client, nil
+}
+
+// loadConfig reads the config file at path, DPO_CONFIG or the default location.
+// Only a missing file at the default location is not an error.
+func loadConfig(path string) (*config, error) {
+	if path == "" {
+		path = os.Getenv("DPO_CONFIG")
+	}
+	explicit := path != ""
+	if !explicit {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return &config{}, nil
+		}
+		path = filepath.Join(dir, "dpo", "config.json")
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && !explicit {
+		return &config{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %v", err)
+	}
+	var cfg config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %v", path, err)
+	}
+	return &cfg, nil
+}
+
+// exitCode maps the error of a command to the exit code of the tool.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var usage *usageError
+	if errors.As(err, &usage) {
+		return exitUsage
+	}
+	if code := dpo.ErrorCode(err); code != "" {
+		return resultExitCode(code)
+	}
+	return exitError
+}
+
+// resultExitCode maps a DPO result code to an exit code.
+func resultExitCode(code string) int {
+	switch code {
+	case dpo.StatusPaid, dpo.StatusOverpaid:
+		return exitOK
+	case dpo.StatusNotPaid, dpo.StatusAuthorized, dpo.StatusPendingBank, dpo.StatusQueuedAuthorization, dpo.StatusPendingSplit:
+		return exitPending
+	case dpo.StatusDeclined, dpo.StatusDataMismatch:
+		return exitDeclined
+	case dpo.StatusExpired, dpo.StatusCancelled:
+		return exitExpired
+	case "801", "802", "803", "804", "950":
+		return exitRejected
+	}
+	return exitDPOError
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang-malawi/go-dpo"
+	"github.com/stretchr/testify/assert"
+)
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// stubDPO answers every API request with body until the test ends.
+func stubDPO(t *testing.T, body string) *[]string {
+	var requests []string
+	saved := http.DefaultTransport
+	http.DefaultTransport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		data, _ := io.ReadAll(req.Body)
+		requests = append(requests, string(data))
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     make(http.Header),
+		}, nil
+	})
+	t.Cleanup(func() { http.DefaultTransport = saved })
+	t.Setenv("DPO_COMPANY_TOKEN", "TOKEN")
+	t.Setenv("DPO_CONFIG", "")
+	return &requests
+}
+
+func TestResultExitCode(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(exitOK, exitCode(nil))
+	assert.Equal(exitUsage, exitCode(usagef("bad")))
+	assert.Equal(exitPending, exitCode(&dpo.Error{Code: "900"}))
+	assert.Equal(exitDeclined, exitCode(&dpo.Error{Code: "901"}))
+	assert.Equal(exitExpired, exitCode(&dpo.Error{Code: "904"}))
+	assert.Equal(exitRejected, exitCode(&dpo.Error{Code: "802"}))
+	assert.Equal(exitDPOError, exitCode(&dpo.Error{Code: "999"}))
+	assert.Equal(exitError, exitCode(io.ErrUnexpectedEOF))
+}
+
+func TestVerifyCommand(t *testing.T) {
+	assert := assert.New(t)
+
+	requests := stubDPO(t, `<API3G><Result>900</Result><ResultExplanation>Transaction not paid yet</ResultExplanation></API3G>`)
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"verify", "TOKEN1", "--json"}, &stdout, &stderr)
+
+	assert.Equal(exitPending, code)
+	assert.Contains(stdout.String(), `"result": "900"`)
+	assert.Contains((*requests)[0], "<TransactionToken>TOKEN1</TransactionToken>")
+}
+
+func TestCreateTokenCommand(t *testing.T) {
+	assert := assert.New(t)
+
+	requests := stubDPO(t, `<API3G><Result>000</Result><ResultExplanation>Transaction created</ResultExplanation><TransToken>T1</TransToken><TransRef>R1</TransRef></API3G>`)
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"create-token", "--amount", "10.50", "--currency", "usd", "--service", "3854", "--ref", "ORDER-1"}, &stdout, &stderr)
+
+	assert.Equal(exitOK, code, stderr.String())
+	assert.Contains(stdout.String(), "T1")
+	assert.Contains(stdout.String(), "ID=T1")
+	assert.Contains((*requests)[0], "<PaymentAmount>10.50</PaymentAmount>")
+	assert.Contains((*requests)[0], "<CompanyRef>ORDER-1</CompanyRef>")
+}
+
+func TestUsageErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	stubDPO(t, "")
+	var stdout, stderr bytes.Buffer
+	assert.Equal(exitUsage, run(context.Background(), nil, &stdout, &stderr))
+	assert.Equal(exitUsage, run(context.Background(), []string{"unknown"}, &stdout, &stderr))
+	assert.Equal(exitUsage, run(context.Background(), []string{"verify"}, &stdout, &stderr))
+	assert.Equal(exitUsage, run(context.Background(), []string{"refund", "T1"}, &stdout, &stderr))
+
+	t.Setenv("DPO_COMPANY_TOKEN", "")
+	t.Setenv("DPO_TOKEN", "")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	assert.Equal(exitUsage, run(context.Background(), []string{"balance"}, &stdout, &stderr))
+}
+
+func TestLoadConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	assert.Nil(os.WriteFile(path, []byte(`{"company_token": "FROMFILE", "sandbox": true}`), 0o600))
+	t.Setenv("DPO_COMPANY_TOKEN", "")
+	t.Setenv("DPO_TOKEN", "")
+
+	client, err := newClient(options{configPath: path})
+	assert.Nil(err)
+	assert.Equal("FROMFILE", client.Token)
+	assert.True(client.Debug)
+
+	_, err = newClient(options{configPath: filepath.Join(t.TempDir(), "missing.json")})
+	assert.NotNil(err)
+}
+
+func TestCreateTokenCommandJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	stubDPO(t, `<API3G><Result>000</Result><ResultExplanation>Transaction created</ResultExplanation><TransToken>T1</TransToken><TransRef>R1</TransRef></API3G>`)
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"--sandbox", "create-token", "--amount", "10.50", "--currency", "USD", "--service", "3854", "--ref", "ORDER-1", "--json"}, &stdout, &stderr)
+
+	assert.Equal(exitOK, code, stderr.String())
+	var output map[string]any
+	assert.Nil(json.Unmarshal(stdout.Bytes(), &output), stdout.String())
+	assert.Equal("ORDER-1", output["company_ref"])
+	assert.Equal("https://secure.3gdirectpay.com/payv2.php?ID=T1", output["payment_url"])
+	assert.Equal("T1", output["trans_token"])
+	assert.NotContains(stdout.String(), "using request body")
+}
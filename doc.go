@@ -12,4 +12,10 @@
 // # Usage: Error Handling
 //
 // The dpo package exposes errors that are thrown from DPO API.
+// When DPO answers with a failure result code the operation returns a *dpo.Error which carries the code.
+//
+//	transactions, err := client.TransactionByRef(ctx, companyRef, nil)
+//	if dpo.ErrorCode(err) == "802" {
+//		// wrong company token
+//	}
 package dpo
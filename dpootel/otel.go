@@ -0,0 +1,77 @@
+// Package dpootel traces the requests of a dpo.Client with OpenTelemetry.
+//
+//	client.SetTracer(dpootel.NewTracer(otel.GetTracerProvider()))
+//
+// It is a separate module so that the dpo package does not depend on OpenTelemetry.
+package dpootel
+
+import (
+	"context"
+
+	dpo "github.com/golang-malawi/go-dpo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the name of the tracer used for the spans.
+const instrumentationName = "github.com/golang-malawi/go-dpo"
+
+// Attribute keys of the spans.
+const (
+	OpKey         = attribute.Key("dpo.op")
+	CompanyRefKey = attribute.Key("dpo.company_ref")
+	TransTokenKey = attribute.Key("dpo.trans_token")
+	ResultCodeKey = attribute.Key("dpo.result_code")
+	RetriesKey    = attribute.Key("dpo.retries")
+)
+
+// Tracer is a dpo.Tracer creating OpenTelemetry spans named "dpo.<op>", e.g. "dpo.verifyToken".
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// NewTracer creates a Tracer using a tracer of provider.
+func NewTracer(provider trace.TracerProvider) *Tracer {
+	return &Tracer{tracer: provider.Tracer(instrumentationName)}
+}
+
+// Start implements dpo.Tracer.
+func (t *Tracer) Start(ctx context.Context, attrs dpo.SpanAttributes) (context.Context, dpo.Span) {
+	kind := trace.SpanKindClient
+	if attrs.Op == "worker.sweep" || attrs.Op == "worker.check" {
+		kind = trace.SpanKindInternal
+	}
+	ctx, span := t.tracer.Start(ctx, "dpo."+attrs.Op, trace.WithSpanKind(kind), trace.WithAttributes(attributes(attrs)...))
+	return ctx, otelSpan{span: span}
+}
+
+type otelSpan struct {
+	span trace.Span
+}
+
+// End implements dpo.Span.
+func (s otelSpan) End(attrs dpo.SpanAttributes, err error) {
+	s.span.SetAttributes(attributes(attrs)...)
+	s.span.SetAttributes(RetriesKey.Int(attrs.Retries))
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
+
+// attributes returns the non-empty attributes of attrs.
+func attributes(attrs dpo.SpanAttributes) []attribute.KeyValue {
+	kvs := []attribute.KeyValue{OpKey.String(attrs.Op)}
+	if attrs.CompanyRef != "" {
+		kvs = append(kvs, CompanyRefKey.String(attrs.CompanyRef))
+	}
+	if attrs.TransToken != "" {
+		kvs = append(kvs, TransTokenKey.String(attrs.TransToken))
+	}
+	if attrs.ResultCode != "" {
+		kvs = append(kvs, ResultCodeKey.String(attrs.ResultCode))
+	}
+	return kvs
+}
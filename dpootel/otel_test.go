@@ -0,0 +1,45 @@
+package dpootel_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	dpo "github.com/golang-malawi/go-dpo"
+	"github.com/golang-malawi/go-dpo/dpootel"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracer(t *testing.T) {
+	assert := assert.New(t)
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := dpootel.NewTracer(provider)
+
+	parentCtx, parent := provider.Tracer("test").Start(context.Background(), "checkout")
+	ctx, span := tracer.Start(parentCtx, dpo.SpanAttributes{Op: "verifyToken", TransToken: "T1"})
+	assert.Equal(parent.SpanContext().TraceID(), trace.SpanContextFromContext(ctx).TraceID())
+	span.End(dpo.SpanAttributes{Op: "verifyToken", TransToken: "T1", ResultCode: "901", Retries: 2}, errors.New("declined"))
+	parent.End()
+
+	ended := recorder.Ended()
+	assert.Len(ended, 2)
+	assert.Equal("dpo.verifyToken", ended[0].Name())
+	assert.Equal(trace.SpanKindClient, ended[0].SpanKind())
+	assert.Equal(parent.SpanContext().SpanID(), ended[0].Parent().SpanID())
+	assert.Equal(codes.Error, ended[0].Status().Code)
+
+	attrs := attribute.NewSet(ended[0].Attributes()...)
+	value, _ := attrs.Value(dpootel.ResultCodeKey)
+	assert.Equal("901", value.AsString())
+	value, _ = attrs.Value(dpootel.RetriesKey)
+	assert.Equal(int64(2), value.AsInt64())
+	value, _ = attrs.Value(dpootel.TransTokenKey)
+	assert.Equal("T1", value.AsString())
+}
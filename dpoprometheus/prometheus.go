@@ -0,0 +1,95 @@
+// Package dpoprometheus exports the request metrics of a dpo.Client to Prometheus.
+//
+//	collector := dpoprometheus.NewCollector("dpo")
+//	prometheus.MustRegister(collector)
+//	client.SetMetrics(collector)
+//
+// It is a separate module so that the dpo package does not depend on the Prometheus client.
+package dpoprometheus
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	dpo "github.com/golang-malawi/go-dpo"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector is a dpo.Metrics and a prometheus.Collector.
+type Collector struct {
+	requests *prometheus.CounterVec
+	retries  *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	wait     *prometheus.HistogramVec
+}
+
+// NewCollector creates a Collector whose metrics are prefixed with namespace, e.g. "dpo".
+func NewCollector(namespace string) *Collector {
+	return &Collector{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "requests_total",
+			Help:      "Responses received from the DPO API by operation, HTTP status, result code, service type and currency.",
+		}, []string{"op", "http_status", "result", "service_type", "currency"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "request_retries_total",
+			Help:      "Attempts after the first one of requests to the DPO API by operation.",
+		}, []string{"op"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "request_errors_total",
+			Help:      "Attempts of requests to the DPO API which got no response by operation.",
+		}, []string{"op"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "request_duration_seconds",
+			Help:      "Duration of the attempts of requests to the DPO API by operation.",
+			Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		}, []string{"op"}),
+		wait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "limit_wait_seconds",
+			Help:      "Time attempts of requests to the DPO API waited for the client side limits by operation.",
+			Buckets:   []float64{0.001, 0.01, 0.1, 0.5, 1, 5, 10, 30},
+		}, []string{"op"}),
+	}
+}
+
+// ObserveAttempt implements dpo.Metrics.
+func (c *Collector) ObserveAttempt(ctx context.Context, attempt dpo.RequestAttempt) {
+	c.duration.WithLabelValues(attempt.Op).Observe(attempt.Duration.Seconds())
+	if attempt.Retry > 0 {
+		c.retries.WithLabelValues(attempt.Op).Inc()
+	}
+	if attempt.Err != nil || attempt.HTTPStatus == 0 {
+		c.errors.WithLabelValues(attempt.Op).Inc()
+		return
+	}
+	c.requests.WithLabelValues(attempt.Op, strconv.Itoa(attempt.HTTPStatus), attempt.ResultCode, attempt.ServiceType, attempt.Currency).Inc()
+}
+
+// ObserveWait implements dpo.WaitMetrics.
+func (c *Collector) ObserveWait(ctx context.Context, op string, wait time.Duration) {
+	c.wait.WithLabelValues(op).Observe(wait.Seconds())
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.requests.Describe(ch)
+	c.retries.Describe(ch)
+	c.errors.Describe(ch)
+	c.duration.Describe(ch)
+	c.wait.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.requests.Collect(ch)
+	c.retries.Collect(ch)
+	c.errors.Collect(ch)
+	c.duration.Collect(ch)
+	c.wait.Collect(ch)
+}
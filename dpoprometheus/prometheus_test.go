@@ -0,0 +1,40 @@
+package dpoprometheus_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	dpo "github.com/golang-malawi/go-dpo"
+	"github.com/golang-malawi/go-dpo/dpoprometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollector(t *testing.T) {
+	assert := assert.New(t)
+
+	collector := dpoprometheus.NewCollector("dpo")
+	registry := prometheus.NewRegistry()
+	assert.Nil(registry.Register(collector))
+
+	ctx := context.Background()
+	collector.ObserveAttempt(ctx, dpo.RequestAttempt{Op: "verifyToken", Err: context.DeadlineExceeded, Duration: time.Second})
+	collector.ObserveAttempt(ctx, dpo.RequestAttempt{Op: "verifyToken", Retry: 1, HTTPStatus: 200, ResultCode: "901", Currency: "USD", Duration: time.Second})
+
+	expected := `
+# HELP dpo_requests_total Responses received from the DPO API by operation, HTTP status, result code, service type and currency.
+# TYPE dpo_requests_total counter
+dpo_requests_total{currency="USD",http_status="200",op="verifyToken",result="901",service_type=""} 1
+# HELP dpo_request_errors_total Attempts of requests to the DPO API which got no response by operation.
+# TYPE dpo_request_errors_total counter
+dpo_request_errors_total{op="verifyToken"} 1
+# HELP dpo_request_retries_total Attempts after the first one of requests to the DPO API by operation.
+# TYPE dpo_request_retries_total counter
+dpo_request_retries_total{op="verifyToken"} 1
+`
+	assert.Nil(testutil.GatherAndCompare(registry, strings.NewReader(expected), "dpo_requests_total", "dpo_request_errors_total", "dpo_request_retries_total"))
+	assert.Equal(1, testutil.CollectAndCount(collector, "dpo_request_duration_seconds"))
+}
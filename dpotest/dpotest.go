@@ -0,0 +1,342 @@
+// Package dpotest records the exchanges of a dpo.Client with the DPO API as fixture files and replays them,
+// so that code using the client can be tested offline and deterministically.
+//
+// Record the fixtures once against the DPO sandbox and commit them:
+//
+//	transport, err := dpotest.NewTransport("testdata/checkout", *record)
+//	client := dpo.NewClient(companyToken, true)
+//	client.SetHTTPClient(&http.Client{Transport: transport})
+//
+// Company tokens and card data are scrubbed from the fixtures. Requests are matched by their API3G operation and
+// their XML body, ignoring formatting and the scrubbed values, so values which change between runs, such as a
+// generated CompanyRef, must either be fixed in the test or listed in Replayer.Ignore.
+package dpotest
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang-malawi/go-dpo"
+)
+
+// Fixture is a recorded exchange with the DPO API.
+type Fixture struct {
+	Op       string `json:"op"`       // Op the API3G request name, e.g. "createToken"
+	Request  string `json:"request"`  // Request the normalised and scrubbed request XML
+	Status   int    `json:"status"`   // Status the HTTP status code of the response
+	Response string `json:"response"` // Response the scrubbed response body
+}
+
+// NewTransport returns a Recorder forwarding requests to http.DefaultTransport when record is true and a
+// Replayer of the fixtures in dir otherwise.
+func NewTransport(dir string, record bool) (http.RoundTripper, error) {
+	if record {
+		return NewRecorder(dir, nil)
+	}
+	return NewReplayer(dir)
+}
+
+// Recorder is an http.RoundTripper which saves every exchange as a fixture file in a directory.
+// The files are numbered in the order the requests were sent, e.g. "001-createToken.json".
+type Recorder struct {
+	transport http.RoundTripper
+	dir       string
+
+	mu   sync.Mutex
+	next int
+}
+
+// NewRecorder creates dir if needed and returns a Recorder sending requests with transport,
+// http.DefaultTransport if nil. Numbering continues after the fixtures already in dir.
+func NewRecorder(dir string, transport http.RoundTripper) (*Recorder, error) {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	files, err := fixtureFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	next := 1
+	if len(files) > 0 {
+		last := filepath.Base(files[len(files)-1])
+		if n, err := strconv.Atoi(last[:strings.IndexByte(last, '-')]); err == nil {
+			next = n + 1
+		}
+	}
+	return &Recorder{transport: transport, dir: dir, next: next}, nil
+}
+
+// RoundTrip implements http.RoundTripper. The response is passed on unchanged, only the fixture is scrubbed.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	fixture := Fixture{Op: operation(body)}
+	if fixture.Request, err = Normalize(body); err != nil {
+		return nil, fmt.Errorf("dpotest: invalid request XML: %v", err)
+	}
+
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	fixture.Status = resp.StatusCode
+	if fixture.Response, err = Normalize(respBody); err != nil {
+		// error pages are not always XML
+		fixture.Response = string(respBody)
+	}
+	if err := r.save(&fixture); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// save writes fixture to the next file.
+func (r *Recorder) save(fixture *Fixture) error {
+	// keep the XML readable in the files instead of escaping '<' and '>'
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(fixture); err != nil {
+		return err
+	}
+	data := buf.Bytes()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	name := fmt.Sprintf("%03d-%s.json", r.next, fixture.Op)
+	if err := os.WriteFile(filepath.Join(r.dir, name), data, 0o644); err != nil {
+		return err
+	}
+	r.next++
+	return nil
+}
+
+// Replayer is an http.RoundTripper answering requests with recorded fixtures, without network access.
+//
+// A request is answered by the first fixture with the same operation and request body which was not used yet.
+// Once all matching fixtures were used the last one answers again, e.g. for a test polling verifyToken.
+// Requests without a matching fixture fail with an error describing the request.
+type Replayer struct {
+	// Ignore lists XML elements which are left out when comparing requests, e.g. "CompanyRef" or "ServiceDate".
+	Ignore []string
+
+	mu       sync.Mutex
+	fixtures []Fixture
+	used     []bool
+}
+
+// NewReplayer loads the fixtures in dir.
+func NewReplayer(dir string) (*Replayer, error) {
+	files, err := fixtureFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("dpotest: no fixtures in %s", dir)
+	}
+	r := &Replayer{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var fixture Fixture
+		if err := json.Unmarshal(data, &fixture); err != nil {
+			return nil, fmt.Errorf("dpotest: %s: %v", file, err)
+		}
+		r.fixtures = append(r.fixtures, fixture)
+	}
+	r.used = make([]bool, len(r.fixtures))
+	return r, nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	op := operation(body)
+	want, err := Normalize(body, r.Ignore...)
+	if err != nil {
+		return nil, fmt.Errorf("dpotest: invalid request XML: %v", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	match := -1
+	for i, fixture := range r.fixtures {
+		if fixture.Op != op {
+			continue
+		}
+		if got, err := Normalize([]byte(fixture.Request), r.Ignore...); err != nil || got != want {
+			continue
+		}
+		match = i
+		if !r.used[i] {
+			break
+		}
+	}
+	if match < 0 {
+		return nil, fmt.Errorf("dpotest: no fixture for %s request %s", op, want)
+	}
+	r.used[match] = true
+
+	fixture := r.fixtures[match]
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", fixture.Status, http.StatusText(fixture.Status)),
+		StatusCode:    fixture.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/xml"}},
+		Body:          io.NopCloser(strings.NewReader(fixture.Response)),
+		ContentLength: int64(len(fixture.Response)),
+		Request:       req,
+	}, nil
+}
+
+// Unused returns the fixtures which did not answer any request, to check that a test made every recorded call.
+func (r *Replayer) Unused() []Fixture {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var unused []Fixture
+	for i, fixture := range r.fixtures {
+		if !r.used[i] {
+			unused = append(unused, fixture)
+		}
+	}
+	return unused
+}
+
+// scrubbers replace the values of sensitive elements.
+var scrubbers = map[string]func(value string) string{
+	"CompanyToken":     redact,
+	"CreditCardNumber": dpo.MaskCardNumber,
+	"CreditCardCVV":    redact,
+	"CreditCardExpiry": redact,
+	"CardHolderName":   redact,
+	"Cavv":             redact,
+	"Pares":            redact,
+}
+
+func redact(string) string {
+	return "***"
+}
+
+// Normalize re-encodes an XML document without the declaration, comments and whitespace between elements,
+// scrubbing company tokens and card data and leaving out the elements named in ignore.
+func Normalize(body []byte, ignore ...string) (string, error) {
+	ignored := make(map[string]bool, len(ignore))
+	for _, name := range ignore {
+		ignored[name] = true
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	var buf bytes.Buffer
+	encoder := xml.NewEncoder(&buf)
+	var path []string
+	skip := 0 // depth inside an ignored element
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			path = append(path, t.Name.Local)
+			if skip > 0 || ignored[t.Name.Local] {
+				skip++
+				continue
+			}
+			err = encoder.EncodeToken(xml.StartElement{Name: xml.Name{Local: t.Name.Local}, Attr: t.Attr})
+		case xml.EndElement:
+			path = path[:len(path)-1]
+			if skip > 0 {
+				skip--
+				continue
+			}
+			err = encoder.EncodeToken(xml.EndElement{Name: xml.Name{Local: t.Name.Local}})
+		case xml.CharData:
+			text := strings.TrimSpace(string(t))
+			if skip > 0 || text == "" || len(path) == 0 {
+				continue
+			}
+			if scrub := scrubbers[path[len(path)-1]]; scrub != nil {
+				text = scrub(text)
+			}
+			err = encoder.EncodeToken(xml.CharData(text))
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	if err := encoder.Flush(); err != nil {
+		return "", err
+	}
+	if buf.Len() == 0 {
+		return "", fmt.Errorf("no XML elements")
+	}
+	return buf.String(), nil
+}
+
+// operation returns the API3G request name of a request body.
+func operation(body []byte) string {
+	var request struct {
+		Request string `xml:"Request"`
+	}
+	if xml.Unmarshal(body, &request) != nil || request.Request == "" {
+		return "unknown"
+	}
+	return strings.TrimSpace(request.Request)
+}
+
+// readBody reads the body of req and replaces it so that it can be sent.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// fixtureFiles returns the fixture files in dir in recording order.
+func fixtureFiles(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "[0-9]*-*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,187 @@
+package dpotest_test
+
+import (
+	"context"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang-malawi/go-dpo"
+	"github.com/golang-malawi/go-dpo/dpotest"
+	"github.com/stretchr/testify/assert"
+)
+
+// roundTripFunc stands in for the DPO sandbox.
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// sandbox answers createToken, chargeTokenCreditCard and verifyToken requests like the DPO sandbox.
+var sandbox = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+	data, _ := io.ReadAll(req.Body)
+	body := string(data)
+	var response string
+	switch {
+	case strings.Contains(body, "<Request>createToken</Request>"):
+		response = `<?xml version="1.0" encoding="utf-8"?><API3G><Result>000</Result><ResultExplanation>Transaction created</ResultExplanation><TransToken>T1</TransToken><TransRef>R1</TransRef></API3G>`
+	case strings.Contains(body, "<Request>chargeTokenCreditCard</Request>"):
+		response = `<?xml version="1.0" encoding="utf-8"?><API3G><Result>000</Result><ResultExplanation>Transaction charged</ResultExplanation></API3G>`
+	case strings.Contains(body, "<Request>verifyToken</Request>"):
+		response = `<?xml version="1.0" encoding="utf-8"?><API3G><Result>000</Result><ResultExplanation>Transaction paid</ResultExplanation><TransactionAmount>10.00</TransactionAmount><TransactionCurrency>USD</TransactionCurrency></API3G>`
+	default:
+		return &http.Response{StatusCode: http.StatusInternalServerError, Body: io.NopCloser(strings.NewReader("unknown request")), Header: make(http.Header)}, nil
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(response)), Header: make(http.Header)}, nil
+})
+
+// newClient returns a client with deterministic company references sending requests with transport.
+func newClient(companyToken string, transport http.RoundTripper) *dpo.Client {
+	client := dpo.NewClient(companyToken, true)
+	client.GenerateRef = dpo.RefGeneratorFunc(func() (string, error) {
+		return "REF-1", nil
+	})
+	client.SetHTTPClient(&http.Client{Transport: transport})
+	return client
+}
+
+// checkout creates a token, charges a card against it and verifies it.
+func checkout(t *testing.T, client *dpo.Client) *dpo.VerifyTokenResponse {
+	token, err := client.CreateToken(client.NewCreateTokenRequest(client.Token, "USD", big.NewFloat(10)))
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	card, err := dpo.NewCard("John Banda", "4111 1111 1111 1111", "987", "12/99")
+	assert.Nil(t, err)
+	result, err := client.ChargeCard(context.Background(), token, dpo.CreditCardCharge{Card: card})
+	assert.Nil(t, err)
+	assert.Equal(t, dpo.CardChargeApproved, result.Status)
+	verified, err := client.VerifyToken(token)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	return verified
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	assert := assert.New(t)
+	dir := filepath.Join(t.TempDir(), "checkout")
+
+	recorder, err := dpotest.NewRecorder(dir, sandbox)
+	assert.Nil(err)
+	recorded := checkout(t, newClient("SECRET-COMPANY-TOKEN", recorder))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	assert.Nil(err)
+	if assert.Len(files, 3) {
+		assert.Equal("001-createToken.json", filepath.Base(files[0]))
+		assert.Equal("002-chargeTokenCreditCard.json", filepath.Base(files[1]))
+		assert.Equal("003-verifyToken.json", filepath.Base(files[2]))
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		assert.Nil(err)
+		assert.NotContains(string(data), "SECRET-COMPANY-TOKEN")
+		assert.NotContains(string(data), "4111111111111111")
+		assert.NotContains(string(data), "987")
+		assert.NotContains(string(data), "John Banda")
+	}
+	data, err := os.ReadFile(files[1])
+	assert.Nil(err)
+	assert.Contains(string(data), "************1111")
+
+	replayer, err := dpotest.NewReplayer(dir)
+	assert.Nil(err)
+	replayed := checkout(t, newClient("OTHER-COMPANY-TOKEN", replayer))
+	assert.Equal(recorded, replayed)
+	assert.Empty(replayer.Unused())
+
+	// a repeated request is answered by the last matching fixture
+	replayed = checkout(t, newClient("OTHER-COMPANY-TOKEN", replayer))
+	assert.Equal(recorded, replayed)
+}
+
+func TestReplayUnmatchedRequest(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+
+	recorder, err := dpotest.NewRecorder(dir, sandbox)
+	assert.Nil(err)
+	client := newClient("TOKEN", recorder)
+	_, err = client.CreateToken(client.NewCreateTokenRequest(client.Token, "USD", big.NewFloat(10)))
+	assert.Nil(err)
+
+	replayer, err := dpotest.NewReplayer(dir)
+	assert.Nil(err)
+	client = newClient("TOKEN", replayer)
+	_, err = client.CreateToken(client.NewCreateTokenRequest(client.Token, "USD", big.NewFloat(20)))
+	assert.ErrorContains(err, "no fixture for createToken request")
+	assert.Len(replayer.Unused(), 1)
+
+	client.GenerateRef = dpo.RefGeneratorFunc(func() (string, error) {
+		return "REF-2", nil
+	})
+	_, err = client.CreateToken(client.NewCreateTokenRequest(client.Token, "USD", big.NewFloat(10)))
+	assert.ErrorContains(err, "no fixture for createToken request")
+
+	replayer.Ignore = []string{"CompanyRef"}
+	token, err := client.CreateToken(client.NewCreateTokenRequest(client.Token, "USD", big.NewFloat(10)))
+	assert.Nil(err)
+	assert.Equal("T1", token.TransToken)
+	assert.Empty(replayer.Unused())
+}
+
+func TestRecorderContinuesNumbering(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+
+	for i := 0; i < 2; i++ {
+		recorder, err := dpotest.NewRecorder(dir, sandbox)
+		assert.Nil(err)
+		client := newClient("TOKEN", recorder)
+		_, err = client.VerifyToken(&dpo.CreateTokenResponse{TransToken: "T1"})
+		assert.Nil(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	assert.Nil(err)
+	if assert.Len(files, 2) {
+		assert.Equal("002-verifyToken.json", filepath.Base(files[1]))
+	}
+}
+
+func TestNewReplayerWithoutFixtures(t *testing.T) {
+	_, err := dpotest.NewReplayer(t.TempDir())
+	assert.ErrorContains(t, err, "no fixtures")
+}
+
+func TestNormalize(t *testing.T) {
+	assert := assert.New(t)
+
+	a, err := dpotest.Normalize([]byte("<?xml version=\"1.0\"?>\n<API3G>\n  <CompanyToken>A</CompanyToken>\n  <Request>verifyToken</Request>\n  <TransactionToken> T1 </TransactionToken>\n</API3G>"))
+	assert.Nil(err)
+	b, err := dpotest.Normalize([]byte("<API3G><CompanyToken>B</CompanyToken><Request>verifyToken</Request><TransactionToken>T1</TransactionToken></API3G>"))
+	assert.Nil(err)
+	assert.Equal(a, b)
+	assert.Equal("<API3G><CompanyToken>***</CompanyToken><Request>verifyToken</Request><TransactionToken>T1</TransactionToken></API3G>", a)
+
+	c, err := dpotest.Normalize([]byte("<API3G><Request>verifyToken</Request><TransactionToken>T1</TransactionToken></API3G>"), "CompanyToken", "TransactionToken")
+	assert.Nil(err)
+	assert.Equal("<API3G><Request>verifyToken</Request></API3G>", c)
+
+	_, err = dpotest.Normalize([]byte("not xml"))
+	assert.NotNil(err)
+}
+
+func TestNormalizeScrubsThreeD(t *testing.T) {
+	assert := assert.New(t)
+
+	normalized, err := dpotest.Normalize([]byte("<API3G><Request>chargeTokenCreditCard</Request><CreditCardNumber>4111 1111 1111 1111</CreditCardNumber><ThreeD><Eci>05</Eci><Cavv>AAABBEg0VhI0VniQEjRWAAAAAAA=</Cavv><Pares>eJzVWNmSo0iS/ZW0=</Pares></ThreeD></API3G>"))
+	assert.Nil(err)
+	assert.Equal("<API3G><Request>chargeTokenCreditCard</Request><CreditCardNumber>************1111</CreditCardNumber><ThreeD><Eci>05</Eci><Cavv>***</Cavv><Pares>***</Pares></ThreeD></API3G>", normalized)
+}
@@ -0,0 +1,28 @@
+package dpo
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error is returned when the DPO API answers a request with a result code that indicates failure.
+// Use errors.As to inspect the code of a failed operation.
+type Error struct {
+	Op          string // Op is the API3G request that failed, e.g. "createToken"
+	Code        string // Code is the Result code returned by DPO
+	Explanation string // Explanation is the ResultExplanation returned by DPO
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return fmt.Sprintf("dpo: %s failed with code %s: %s", e.Op, e.Code, e.Explanation)
+}
+
+// ErrorCode returns the DPO result code carried by err, or an empty string if err is not a *Error.
+func ErrorCode(err error) string {
+	var dpoErr *Error
+	if errors.As(err, &dpoErr) {
+		return dpoErr.Code
+	}
+	return ""
+}
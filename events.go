@@ -0,0 +1,346 @@
+package dpo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrEventExists is returned by an EventOutbox when an event with the same ID was already added.
+var ErrEventExists = errors.New("dpo: event already exists")
+
+// EventType identifies the kind of an Event.
+type EventType string
+
+const (
+	EventTokenCreated     EventType = "token_created"     // EventTokenCreated a token was created with createToken
+	EventPaymentSucceeded EventType = "payment_succeeded" // EventPaymentSucceeded verifyToken reported the payment as paid
+	EventPaymentFailed    EventType = "payment_failed"    // EventPaymentFailed verifyToken reported the payment as declined
+	EventPaymentExpired   EventType = "payment_expired"   // EventPaymentExpired the payment time limit passed without payment
+	EventTokenCancelled   EventType = "token_cancelled"   // EventTokenCancelled the token was cancelled
+	EventRefundRequested  EventType = "refund_requested"  // EventRefundRequested a refund is about to be sent to DPO
+	EventRefundCompleted  EventType = "refund_completed"  // EventRefundCompleted DPO accepted a refund
+)
+
+// Event is published by the Client when something happens to a payment.
+//
+// Events are delivered at least once, so handlers must be idempotent. Events about the state of a token have
+// a stable ID derived from the type and token, e.g. "payment_succeeded:<token>", which handlers can use to
+// drop duplicates.
+type Event struct {
+	ID          string    `json:"id"`
+	Type        EventType `json:"type"`
+	TransToken  string    `json:"trans_token"`
+	CompanyRef  string    `json:"company_ref,omitempty"`
+	Amount      Money     `json:"amount"`
+	Status      string    `json:"status,omitempty"`      // Status the DPO result code which caused the event
+	Explanation string    `json:"explanation,omitempty"` // Explanation the DPO result explanation
+	RefundRef   string    `json:"refund_ref,omitempty"`  // RefundRef reference of the refund for refund events
+	At          time.Time `json:"at"`
+}
+
+// EventHandler handles a published event. Returning an error leaves the event in the outbox for redelivery.
+type EventHandler func(ctx context.Context, event Event) error
+
+// EventOutbox persists events until all subscribers handled them.
+// MemoryStore, FileStore and SQLStore implement EventOutbox next to Store.
+type EventOutbox interface {
+	// AddEvent saves a new event, returning ErrEventExists when the ID is already known.
+	AddEvent(ctx context.Context, event Event) error
+	// PendingEvents returns up to limit events not yet marked delivered, oldest first.
+	PendingEvents(ctx context.Context, limit int) ([]Event, error)
+	// MarkEventDelivered marks the event with id as delivered.
+	MarkEventDelivered(ctx context.Context, id string) error
+}
+
+type eventSubscriber struct {
+	handler EventHandler
+	types   map[EventType]bool // types the subscriber wants, nil for all
+	async   bool
+}
+
+func (s eventSubscriber) wants(t EventType) bool {
+	return s.types == nil || s.types[t]
+}
+
+// Events dispatches payment events to subscribers.
+//
+// Synchronous subscribers run in the goroutine that published the event, asynchronous subscribers run in a
+// separate goroutine. With an outbox, every event is saved before it is dispatched and only marked delivered
+// once every subscriber succeeded, call Redeliver or Run to retry the others. Without an outbox delivery is
+// best effort.
+type Events struct {
+	outbox EventOutbox
+
+	mu          sync.RWMutex
+	subscribers []eventSubscriber
+	inflight    map[string]bool
+	wg          sync.WaitGroup
+
+	// OnError is called when a subscriber or the outbox fails.
+	OnError func(event Event, err error)
+}
+
+// NewEvents creates an event dispatcher, outbox may be nil.
+func NewEvents(outbox EventOutbox) *Events {
+	return &Events{
+		outbox:   outbox,
+		inflight: make(map[string]bool),
+	}
+}
+
+// Subscribe registers handler to be called synchronously for events of types, or all events when types is empty.
+func (e *Events) Subscribe(handler EventHandler, types ...EventType) {
+	e.subscribe(handler, types, false)
+}
+
+// SubscribeAsync registers handler to be called in a separate goroutine for events of types, or all events
+// when types is empty. Asynchronous handlers are called with a context that is not cancelled with the
+// publisher's.
+func (e *Events) SubscribeAsync(handler EventHandler, types ...EventType) {
+	e.subscribe(handler, types, true)
+}
+
+func (e *Events) subscribe(handler EventHandler, types []EventType, async bool) {
+	subscriber := eventSubscriber{handler: handler, async: async}
+	if len(types) > 0 {
+		subscriber.types = make(map[EventType]bool, len(types))
+		for _, t := range types {
+			subscriber.types[t] = true
+		}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.subscribers = append(e.subscribers, subscriber)
+}
+
+// Publish saves event to the outbox and dispatches it to the subscribers. A missing ID or timestamp is filled in.
+// Events whose ID is already in the outbox are not dispatched again.
+// The error of the outbox or of the first failing synchronous subscriber is returned.
+func (e *Events) Publish(ctx context.Context, event Event) error {
+	if event.ID == "" {
+		id, err := newEventID()
+		if err != nil {
+			return err
+		}
+		event.ID = id
+	}
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+
+	if e.outbox != nil {
+		err := e.outbox.AddEvent(ctx, event)
+		if errors.Is(err, ErrEventExists) {
+			return nil
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to save event %s: %w", event.ID, err)
+			e.reportError(event, err)
+			return err
+		}
+	}
+	return e.dispatch(ctx, event)
+}
+
+// redeliverPage is the number of events Redeliver reads from the outbox at a time.
+const redeliverPage = 100
+
+// Redeliver dispatches the events left in the outbox by failed subscribers again.
+// It pages through every pending event, so events which keep failing do not hold back newer ones.
+func (e *Events) Redeliver(ctx context.Context) error {
+	if e.outbox == nil {
+		return nil
+	}
+	// EventOutbox has no offset, so each page asks for the events seen so far plus one more page and skips the
+	// seen ones. Events delivered meanwhile only shift the pages, they are not dispatched twice.
+	seen := make(map[string]bool)
+	for {
+		limit := len(seen) + redeliverPage
+		events, err := e.outbox.PendingEvents(ctx, limit)
+		if err != nil {
+			return err
+		}
+		dispatched := 0
+		for _, event := range events {
+			if seen[event.ID] {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			seen[event.ID] = true
+			dispatched++
+			_ = e.dispatch(ctx, event)
+		}
+		if len(events) < limit || dispatched == 0 {
+			return nil
+		}
+	}
+}
+
+// Run calls Redeliver every interval until ctx is cancelled.
+func (e *Events) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := e.Redeliver(ctx); err != nil && ctx.Err() == nil {
+				e.reportError(Event{}, err)
+			}
+		}
+	}
+}
+
+// Wait blocks until the asynchronous subscribers handled all events published so far.
+func (e *Events) Wait() {
+	e.wg.Wait()
+}
+
+// dispatch calls the subscribers for event, skipping events which are already being delivered.
+func (e *Events) dispatch(ctx context.Context, event Event) error {
+	e.mu.Lock()
+	if e.inflight[event.ID] {
+		e.mu.Unlock()
+		return nil
+	}
+	e.inflight[event.ID] = true
+	var syncSubs, asyncSubs []eventSubscriber
+	for _, s := range e.subscribers {
+		if !s.wants(event.Type) {
+			continue
+		}
+		if s.async {
+			asyncSubs = append(asyncSubs, s)
+		} else {
+			syncSubs = append(syncSubs, s)
+		}
+	}
+	e.mu.Unlock()
+
+	var firstErr error
+	for _, s := range syncSubs {
+		if err := s.handler(ctx, event); err != nil {
+			e.reportError(event, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	if len(asyncSubs) == 0 {
+		e.finish(ctx, event, firstErr == nil)
+		return firstErr
+	}
+
+	e.wg.Add(1)
+	go func(ok bool) {
+		defer e.wg.Done()
+		ctx := context.Background()
+		for _, s := range asyncSubs {
+			if err := s.handler(ctx, event); err != nil {
+				e.reportError(event, err)
+				ok = false
+			}
+		}
+		e.finish(ctx, event, ok)
+	}(firstErr == nil)
+	return firstErr
+}
+
+// finish marks event delivered in the outbox when all subscribers succeeded.
+func (e *Events) finish(ctx context.Context, event Event, delivered bool) {
+	if delivered && e.outbox != nil {
+		if err := e.outbox.MarkEventDelivered(ctx, event.ID); err != nil {
+			e.reportError(event, fmt.Errorf("failed to mark event %s delivered: %w", event.ID, err))
+		}
+	}
+	e.mu.Lock()
+	delete(e.inflight, event.ID)
+	e.mu.Unlock()
+}
+
+func (e *Events) reportError(event Event, err error) {
+	if e.OnError != nil {
+		e.OnError(event, err)
+	}
+}
+
+// newEventID returns a random ID for events which have no natural one.
+func newEventID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate event id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// SetEvents makes the client publish events for its operations to events.
+// Payment events are published whenever verifyToken sees a final status, including verification done by
+// VerifyRedirect, Checkout and Worker, and rely on their stable IDs and the outbox to suppress duplicates.
+func (c *Client) SetEvents(events *Events) {
+	c.events = events
+}
+
+// publish sends event to the client's Events, if any. Failures are reported through Events.OnError
+// and do not fail the operation, the outbox takes care of redelivery.
+func (c *Client) publish(ctx context.Context, event Event) {
+	if c.events == nil {
+		return
+	}
+	_ = c.events.Publish(ctx, event)
+}
+
+// paymentEventType maps a verifyToken Result code to the event it causes, if any.
+func paymentEventType(result string) (EventType, bool) {
+	switch result {
+	case StatusPaid:
+		return EventPaymentSucceeded, true
+	case StatusDeclined, StatusDataMismatch:
+		return EventPaymentFailed, true
+	case StatusExpired:
+		return EventPaymentExpired, true
+	case StatusCancelled:
+		return EventTokenCancelled, true
+	}
+	return "", false
+}
+
+// publishVerified publishes the event for the status in a verifyToken response.
+func (c *Client) publishVerified(ctx context.Context, transToken string, response *VerifyTokenResponse) {
+	eventType, ok := paymentEventType(response.Result)
+	if !ok || c.events == nil {
+		return
+	}
+	amount, _ := ParseMoney(response.TransactionAmount, response.TransactionCurrency)
+	companyRef := ""
+	if c.store != nil {
+		if record, err := c.store.Payment(ctx, transToken); err == nil {
+			companyRef = record.CompanyRef
+		}
+	}
+	c.publish(ctx, Event{
+		ID:          string(eventType) + ":" + transToken,
+		Type:        eventType,
+		TransToken:  transToken,
+		CompanyRef:  companyRef,
+		Amount:      amount,
+		Status:      response.Result,
+		Explanation: response.ResultExplanation,
+	})
+}
+
+// refundEventID returns the ID of a refund event, stable when the refund has a reference.
+func refundEventID(eventType EventType, transToken, ref string) string {
+	if ref == "" {
+		return ""
+	}
+	return string(eventType) + ":" + transToken + ":" + ref
+}
@@ -0,0 +1,169 @@
+package dpo_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/golang-malawi/go-dpo"
+	"github.com/stretchr/testify/assert"
+)
+
+func testOutbox(t *testing.T, outbox dpo.EventOutbox) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	for _, id := range []string{"a", "b", "c"} {
+		assert.Nil(outbox.AddEvent(ctx, dpo.Event{ID: id, Type: dpo.EventTokenCreated}))
+	}
+	assert.Equal(dpo.ErrEventExists, outbox.AddEvent(ctx, dpo.Event{ID: "a"}))
+	assert.Nil(outbox.MarkEventDelivered(ctx, "a"))
+	assert.Equal(dpo.ErrEventExists, outbox.AddEvent(ctx, dpo.Event{ID: "a"}))
+
+	events, err := outbox.PendingEvents(ctx, 1)
+	assert.Nil(err)
+	assert.Len(events, 1)
+	assert.Equal("b", events[0].ID)
+
+	events, err = outbox.PendingEvents(ctx, 0)
+	assert.Nil(err)
+	assert.Len(events, 2)
+}
+
+func TestMemoryStoreOutbox(t *testing.T) {
+	testOutbox(t, dpo.NewMemoryStore())
+}
+
+func TestFileStoreOutbox(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "payments.jsonl")
+
+	store, err := dpo.OpenFileStore(path)
+	assert.Nil(err)
+	testOutbox(t, store)
+	assert.Nil(store.Close())
+
+	store, err = dpo.OpenFileStore(path)
+	assert.Nil(err)
+	events, err := store.PendingEvents(context.Background(), 0)
+	assert.Nil(err)
+	assert.Len(events, 2)
+
+	assert.Nil(store.Compact())
+	assert.Nil(store.Close())
+	store, err = dpo.OpenFileStore(path)
+	assert.Nil(err)
+	events, err = store.PendingEvents(context.Background(), 0)
+	assert.Nil(err)
+	assert.Len(events, 2)
+	assert.Nil(store.Close())
+}
+
+func TestEventsRedeliver(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	store := dpo.NewMemoryStore()
+	events := dpo.NewEvents(store)
+
+	calls := 0
+	events.Subscribe(func(ctx context.Context, event dpo.Event) error {
+		calls++
+		if calls == 1 {
+			return errors.New("temporary failure")
+		}
+		return nil
+	}, dpo.EventPaymentSucceeded)
+
+	var mu sync.Mutex
+	var async []dpo.Event
+	events.SubscribeAsync(func(ctx context.Context, event dpo.Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		async = append(async, event)
+		return nil
+	})
+
+	err := events.Publish(ctx, dpo.Event{ID: "payment_succeeded:T1", Type: dpo.EventPaymentSucceeded, TransToken: "T1"})
+	assert.NotNil(err)
+	events.Wait()
+
+	pending, _ := store.PendingEvents(ctx, 0)
+	assert.Len(pending, 1)
+
+	// publishing the same event again is suppressed by the outbox
+	assert.Nil(events.Publish(ctx, dpo.Event{ID: "payment_succeeded:T1", Type: dpo.EventPaymentSucceeded}))
+	assert.Equal(1, calls)
+
+	assert.Nil(events.Redeliver(ctx))
+	events.Wait()
+	assert.Equal(2, calls)
+	assert.Len(async, 2)
+
+	pending, _ = store.PendingEvents(ctx, 0)
+	assert.Len(pending, 0)
+}
+
+func TestEventsRedeliverPastFailingEvents(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	store := dpo.NewMemoryStore()
+	// delivered events leave the outbox while it is paged through
+	for i := 0; i < 250; i++ {
+		eventType := dpo.EventPaymentFailed
+		if i%5 == 0 {
+			eventType = dpo.EventPaymentSucceeded
+		}
+		assert.Nil(store.AddEvent(ctx, dpo.Event{ID: fmt.Sprintf("E%d", i), Type: eventType}))
+	}
+	assert.Nil(store.AddEvent(ctx, dpo.Event{ID: "payment_succeeded:T1", Type: dpo.EventPaymentSucceeded}))
+
+	events := dpo.NewEvents(store)
+	calls := make(map[string]int)
+	events.Subscribe(func(ctx context.Context, event dpo.Event) error {
+		calls[event.ID]++
+		if event.Type == dpo.EventPaymentFailed {
+			return errors.New("cannot handle")
+		}
+		return nil
+	})
+
+	assert.Nil(events.Redeliver(ctx))
+	assert.Len(calls, 251)
+	for id, n := range calls {
+		assert.Equal(1, n, id)
+	}
+	pending, err := store.PendingEvents(ctx, 0)
+	assert.Nil(err)
+	assert.Len(pending, 200)
+}
+
+func TestClientPublishesEvents(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	client := newStubClient(http.StatusOK, `<API3G><Result>000</Result><ResultExplanation>Transaction Paid</ResultExplanation><TransactionAmount>10.00</TransactionAmount><TransactionCurrency>USD</TransactionCurrency></API3G>`, nil)
+	events := dpo.NewEvents(dpo.NewMemoryStore())
+	client.SetEvents(events)
+
+	var received []dpo.Event
+	events.Subscribe(func(ctx context.Context, event dpo.Event) error {
+		received = append(received, event)
+		return nil
+	})
+
+	_, err := client.VerifyTokenContext(ctx, &dpo.CreateTokenResponse{TransToken: "T1"})
+	assert.Nil(err)
+	_, err = client.VerifyTokenContext(ctx, &dpo.CreateTokenResponse{TransToken: "T1"})
+	assert.Nil(err)
+
+	assert.Len(received, 1)
+	assert.Equal(dpo.EventPaymentSucceeded, received[0].Type)
+	assert.Equal("payment_succeeded:T1", received[0].ID)
+	assert.Equal(int64(1000), received[0].Amount.Cents)
+}
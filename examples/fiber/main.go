@@ -33,6 +33,8 @@ func main() {
 		Token:       os.Getenv("DPO_TOKEN"),
 		RedirectURL: os.Getenv("DPO_REDIRECT_URL"),
 		BackURL:     os.Getenv("DPO_BACK_URL"),
+		ServiceCode: os.Getenv("DPO_SERVICE_CODE"),
+		ServiceName: os.Getenv("DPO_SERVICE_NAME"),
 	}
 	// Initialize standard Go html template engine
 	engine := html.New("./views", ".html")
@@ -78,6 +80,8 @@ func main() {
 func InitiatePayment(ctx *fiber.Ctx, dpoConfig DPOConfig) error {
 	clientToken := dpoConfig.Token
 	client := dpo.NewClient(clientToken, true)
+	// Check DPO_SERVICE_CODE against the service types configured for the company before creating tokens
+	client.SetServiceCatalog(dpo.NewServiceCatalog(client, time.Hour))
 
 	// MOTE: Load Plan, Currency and Amount from database
 	createTokenRequest := client.NewCreateTokenRequest(clientToken, "USD", big.NewFloat(0.30))
@@ -103,8 +107,6 @@ func InitiatePayment(ctx *fiber.Ctx, dpoConfig DPOConfig) error {
 	}
 
 	time.Sleep(3 * time.Second)
-	// URL we will redirect to for the user to make a payment on DPOs site...
-	DPOPaymentURL := client.MakePaymentURL(token)
 
 	verifyResponse, err := client.VerifyToken(token)
 	if err != nil {
@@ -115,18 +117,12 @@ func InitiatePayment(ctx *fiber.Ctx, dpoConfig DPOConfig) error {
 		})
 	}
 
-	transactionId := token.TransRef
-	transactionToken := token.TransToken
-	companyRef := createTokenRequest.Transaction.CompanyRef
 	// TODO: Update transaction data here
 	// Verify the token
 	if verifyResponse.Result == "900" {
-		return ctx.Render("dpo_redirect", fiber.Map{
-			"transactionRef":         transactionId,
-			"transactionToken":       transactionToken,
-			"internalTransactionRef": companyRef,
-			"DPOPaymentURL":          DPOPaymentURL,
-		})
+		// Render the page which posts the token to DPOs payment page
+		ctx.Type("html")
+		return client.WritePaymentPage(ctx, token)
 	}
 
 	return ctx.Render("payment_error", fiber.Map{
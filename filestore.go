@@ -0,0 +1,282 @@
+package dpo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileStore is a Store that appends every change to a payment as a JSON line to a file.
+// The file is replayed into memory when the store is opened, the last line for a token wins.
+// Changes are only applied in memory once they were written to the file.
+// Events added to its outbox are kept in the same file.
+// A FileStore must only be used by a single process at a time.
+type FileStore struct {
+	mu     sync.Mutex
+	path   string
+	file   *os.File
+	memory *MemoryStore
+}
+
+// OpenFileStore opens or creates the JSON lines file at path.
+func OpenFileStore(path string) (*FileStore, error) {
+	memory := NewMemoryStore()
+
+	if err := replayFileStore(path, memory); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{path: path, file: file, memory: memory}, nil
+}
+
+// replayFileStore loads the records of the file at path into memory, a missing file is treated as empty.
+// A last line without a newline is left by a crash in the middle of an append. Its change was never applied,
+// so it is cut off the file before new lines are appended.
+func replayFileStore(path string, memory *MemoryStore) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var complete int64 // complete is the size of the lines ending with a newline
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(data) > 0 {
+				return os.Truncate(path, complete)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		complete += int64(len(data))
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+		if err := replayFileStoreLine(memory, data); err != nil {
+			return fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+	}
+}
+
+// replayFileStoreLine applies a line of the file to memory.
+func replayFileStoreLine(memory *MemoryStore, data []byte) error {
+	var eventLine fileEventLine
+	if err := json.Unmarshal(data, &eventLine); err != nil {
+		return err
+	}
+	switch {
+	case eventLine.Event != nil:
+		return memory.AddEvent(context.Background(), *eventLine.Event)
+	case eventLine.Delivered != "":
+		// after Compact the event itself is gone, only its ID is kept
+		memory.rememberEvent(eventLine.Delivered)
+		return memory.MarkEventDelivered(context.Background(), eventLine.Delivered)
+	default:
+		var record PaymentRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return err
+		}
+		memory.payments[record.TransToken] = &record
+		return nil
+	}
+}
+
+// fileEventLine is a line recording an outbox change, told apart from payment lines by its keys.
+type fileEventLine struct {
+	Event     *Event `json:"event,omitempty"`
+	Delivered string `json:"delivered_event,omitempty"`
+}
+
+// append writes record as a line to the file and syncs it to disk.
+func (f *FileStore) append(record any) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if _, err := f.file.Write(data); err != nil {
+		return err
+	}
+	return f.file.Sync()
+}
+
+// CreatePayment implements Store.
+func (f *FileStore) CreatePayment(ctx context.Context, record *PaymentRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.memory.Payment(ctx, record.TransToken); err == nil {
+		return ErrPaymentExists
+	}
+	if err := f.append(record); err != nil {
+		return err
+	}
+	return f.memory.CreatePayment(ctx, record)
+}
+
+// Payment implements Store.
+func (f *FileStore) Payment(ctx context.Context, transToken string) (*PaymentRecord, error) {
+	return f.memory.Payment(ctx, transToken)
+}
+
+// PaymentByRef implements Store.
+func (f *FileStore) PaymentByRef(ctx context.Context, companyRef string) (*PaymentRecord, error) {
+	return f.memory.PaymentByRef(ctx, companyRef)
+}
+
+// UpdateStatus implements Store.
+func (f *FileStore) UpdateStatus(ctx context.Context, transToken string, change StatusChange) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	record, err := f.memory.Payment(ctx, transToken)
+	if err != nil {
+		return err
+	}
+	applyStatusChange(record, change)
+	if err := f.append(record); err != nil {
+		return err
+	}
+	return f.memory.UpdateStatus(ctx, transToken, change)
+}
+
+// CompletePayment implements Store.
+func (f *FileStore) CompletePayment(ctx context.Context, transToken string, at time.Time) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	record, err := f.memory.Payment(ctx, transToken)
+	if err != nil {
+		return false, err
+	}
+	if record.CompletedAt != nil {
+		return false, nil
+	}
+	record.CompletedAt = &at
+	if err := f.append(record); err != nil {
+		return false, err
+	}
+	return f.memory.CompletePayment(ctx, transToken, at)
+}
+
+// Payments implements Store.
+func (f *FileStore) Payments(ctx context.Context, filter PaymentFilter) ([]PaymentRecord, error) {
+	return f.memory.Payments(ctx, filter)
+}
+
+// AddEvent implements EventOutbox.
+func (f *FileStore) AddEvent(ctx context.Context, event Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.memory.hasEvent(event.ID) {
+		return ErrEventExists
+	}
+	if err := f.append(&fileEventLine{Event: &event}); err != nil {
+		return err
+	}
+	return f.memory.AddEvent(ctx, event)
+}
+
+// PendingEvents implements EventOutbox.
+func (f *FileStore) PendingEvents(ctx context.Context, limit int) ([]Event, error) {
+	return f.memory.PendingEvents(ctx, limit)
+}
+
+// MarkEventDelivered implements EventOutbox.
+func (f *FileStore) MarkEventDelivered(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.append(&fileEventLine{Delivered: id}); err != nil {
+		return err
+	}
+	return f.memory.MarkEventDelivered(ctx, id)
+}
+
+// Compact rewrites the file with a single line per payment and pending event.
+// Delivered events are kept as their IDs only, so AddEvent still rejects them.
+func (f *FileStore) Compact() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	records, err := f.memory.Payments(context.Background(), PaymentFilter{})
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	for i := range records {
+		if err := encoder.Encode(&records[i]); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	events, err := f.memory.PendingEvents(context.Background(), 0)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	for i := range events {
+		if err := encoder.Encode(&fileEventLine{Event: &events[i]}); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	for _, id := range f.memory.deliveredEventIDs() {
+		if err := encoder.Encode(&fileEventLine{Delivered: id}); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	f.file.Close()
+	f.file = file
+	return nil
+}
+
+// Close closes the underlying file.
+func (f *FileStore) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
@@ -0,0 +1,134 @@
+package dpo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// IdempotentRef returns the CompanyRef CreateTokenIdempotent uses for key. Keys made of letters, digits, '-'
+// and '_' of up to 50 characters, such as most order IDs, are used unchanged so they stay readable in DPO's
+// back office. Other keys are replaced by a hash.
+func IdempotentRef(key string) string {
+	if ValidateCompanyRef(key) == nil {
+		return key
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "K" + hex.EncodeToString(sum[:])[:40]
+}
+
+// keyedMutex serialises work per key.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	sync.Mutex
+	waiters int
+}
+
+// lock locks key and returns the function that unlocks it.
+func (k *keyedMutex) lock(key string) func() {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = make(map[string]*keyedLock)
+	}
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		k.locks[key] = l
+	}
+	l.waiters++
+	k.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		k.mu.Lock()
+		l.waiters--
+		if l.waiters == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
+
+// CreateTokenIdempotent creates a token for req unless one was already created for key, for example when the
+// customer clicked "Pay" twice. The CompanyRef of req is replaced by IdempotentRef(key) and CompanyRefUnique is
+// set, so DPO rejects a second token with the same reference as well.
+//
+// An existing token is looked up in the client's Store first, if one is set, then with getTransactionByRef.
+// It is returned as a CreateTokenResponse with Result "000", whatever the status of its payment, so a new
+// payment attempt after a failed or expired one needs a new key.
+func (c *Client) CreateTokenIdempotent(ctx context.Context, key string, req *CreateTokenRequest) (*CreateTokenResponse, error) {
+	if key == "" {
+		return nil, fmt.Errorf("idempotency key must not be empty")
+	}
+	if req == nil {
+		return nil, fmt.Errorf("token must not be nil")
+	}
+	ref := IdempotentRef(key)
+	req.Transaction.CompanyRef = ref
+	req.Transaction.CompanyRefUnique = 1
+
+	unlock := c.idempotencyLocks.lock(ref)
+	defer unlock()
+
+	existing, err := c.existingToken(ctx, req)
+	if err != nil || existing != nil {
+		return existing, err
+	}
+
+	response, err := c.CreateTokenContext(ctx, req)
+	var dpoErr *Error
+	if errors.As(err, &dpoErr) {
+		// another process may have created the token in the meantime, DPO then rejects the duplicate ref
+		if existing, lookupErr := c.existingToken(ctx, req); lookupErr == nil && existing != nil {
+			return existing, nil
+		}
+	}
+	return response, err
+}
+
+// existingToken returns the token already created for the CompanyRef of req, or nil when there is none.
+func (c *Client) existingToken(ctx context.Context, req *CreateTokenRequest) (*CreateTokenResponse, error) {
+	ref := req.Transaction.CompanyRef
+	if c.store != nil {
+		record, err := c.store.PaymentByRef(ctx, ref)
+		if err == nil {
+			return &CreateTokenResponse{Result: "000", ResultExplanation: "Existing token", TransToken: record.TransToken, TransRef: record.TransRef}, nil
+		}
+		if !errors.Is(err, ErrPaymentNotFound) {
+			return nil, fmt.Errorf("failed to look up payment %s: %w", ref, err)
+		}
+	}
+
+	transactions, err := c.TransactionByRef(ctx, ref, &TransactionByRefOptions{LatestOnly: true})
+	if ErrorCode(err) == transactionByRefNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up transaction %s: %w", ref, err)
+	}
+	if len(transactions) == 0 {
+		return nil, nil
+	}
+
+	latest := transactions[0]
+	response := &CreateTokenResponse{Result: "000", ResultExplanation: "Existing token", TransToken: latest.TransToken, TransRef: latest.TransRef}
+	if c.store != nil {
+		// the token was created but never stored, e.g. the process crashed in between
+		if err := c.recordCreatedToken(ctx, req, response, ""); err != nil && !errors.Is(err, ErrPaymentExists) {
+			return response, fmt.Errorf("failed to store existing payment: %w", err)
+		}
+		if latest.Result != StatusNotPaid {
+			_ = c.store.UpdateStatus(ctx, latest.TransToken, StatusChange{Status: latest.Result, Explanation: latest.ResultExplanation, At: time.Now()})
+		}
+	}
+	return response, nil
+}
@@ -0,0 +1,114 @@
+package dpo_test
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-malawi/go-dpo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotentRef(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("ORDER-1234", dpo.IdempotentRef("ORDER-1234"))
+	hashed := dpo.IdempotentRef("order 1234 / customer@example.com")
+	assert.Len(hashed, 41)
+	assert.Equal(hashed, dpo.IdempotentRef("order 1234 / customer@example.com"))
+	assert.NotEqual(hashed, dpo.IdempotentRef("order 1235 / customer@example.com"))
+}
+
+func TestCreateTokenIdempotentWithStore(t *testing.T) {
+	assert := assert.New(t)
+
+	created := 0
+	client := newStubClientFunc(func(requestBody string) (int, string) {
+		if strings.Contains(requestBody, "<Request>createToken</Request>") {
+			created++
+			return http.StatusOK, `<API3G><Result>000</Result><TransToken>T1</TransToken><TransRef>R1</TransRef></API3G>`
+		}
+		return http.StatusOK, `<API3G><Result>999</Result><ResultExplanation>No transactions found</ResultExplanation></API3G>`
+	})
+	client.SetStore(dpo.NewMemoryStore())
+
+	for i := 0; i < 2; i++ {
+		request := client.NewCreateTokenRequest(client.Token, "USD", big.NewFloat(10))
+		request.AddService("3854", "Ecommerce", time.Now())
+		token, err := client.CreateTokenIdempotent(context.Background(), "ORDER-1", request)
+		assert.Nil(err)
+		assert.Equal("T1", token.TransToken)
+		assert.Equal("ORDER-1", request.Transaction.CompanyRef)
+		assert.Equal(1, request.Transaction.CompanyRefUnique)
+	}
+	assert.Equal(1, created)
+}
+
+func TestCreateTokenIdempotentLookupByRef(t *testing.T) {
+	assert := assert.New(t)
+
+	var requests []string
+	client := newStubClientFunc(func(requestBody string) (int, string) {
+		requests = append(requests, requestBody)
+		return http.StatusOK, `<API3G><Result>000</Result><Transactions><Transaction><TransactionToken>T9</TransactionToken><TransactionRef>R9</TransactionRef><CompanyRef>ORDER-9</CompanyRef><Result>900</Result></Transaction></Transactions></API3G>`
+	})
+	store := dpo.NewMemoryStore()
+	client.SetStore(store)
+
+	request := client.NewCreateTokenRequest(client.Token, "USD", big.NewFloat(10))
+	token, err := client.CreateTokenIdempotent(context.Background(), "ORDER-9", request)
+	assert.Nil(err)
+	assert.Equal("T9", token.TransToken)
+	assert.Len(requests, 1)
+	assert.Contains(requests[0], "<Request>getTransactionByRef</Request>")
+
+	payment, err := store.PaymentByRef(context.Background(), "ORDER-9")
+	assert.Nil(err)
+	assert.Equal("T9", payment.TransToken)
+}
+
+func TestCreateTokenIdempotentSeveralTokensForRef(t *testing.T) {
+	assert := assert.New(t)
+
+	var requests []string
+	client := newStubClientFunc(func(requestBody string) (int, string) {
+		requests = append(requests, requestBody)
+		latest := `<Transaction><TransactionToken>T2</TransactionToken><TransactionRef>R2</TransactionRef><CompanyRef>ORDER-9</CompanyRef><Result>900</Result></Transaction>`
+		if strings.Contains(requestBody, "<AllTokens>1</AllTokens>") {
+			// the order of several tokens is not documented
+			return http.StatusOK, `<API3G><Result>000</Result><Transactions>` + latest + `<Transaction><TransactionToken>T1</TransactionToken><TransactionRef>R1</TransactionRef><CompanyRef>ORDER-9</CompanyRef><Result>904</Result></Transaction></Transactions></API3G>`
+		}
+		return http.StatusOK, `<API3G><Result>000</Result><Transactions>` + latest + `</Transactions></API3G>`
+	})
+
+	request := client.NewCreateTokenRequest(client.Token, "USD", big.NewFloat(10))
+	token, err := client.CreateTokenIdempotent(context.Background(), "ORDER-9", request)
+	assert.Nil(err)
+	assert.Equal("T2", token.TransToken)
+	assert.Equal("R2", token.TransRef)
+	if assert.Len(requests, 1) {
+		assert.Contains(requests[0], "<AllTokens>0</AllTokens>")
+	}
+}
+
+func TestCreateTokenIdempotentLookupError(t *testing.T) {
+	assert := assert.New(t)
+
+	created := 0
+	client := newStubClientFunc(func(requestBody string) (int, string) {
+		if strings.Contains(requestBody, "<Request>createToken</Request>") {
+			created++
+			return http.StatusOK, `<API3G><Result>000</Result><TransToken>T1</TransToken></API3G>`
+		}
+		return http.StatusOK, `<API3G><Result>802</Result><ResultExplanation>Wrong CompanyToken</ResultExplanation></API3G>`
+	})
+
+	request := client.NewCreateTokenRequest(client.Token, "USD", big.NewFloat(10))
+	token, err := client.CreateTokenIdempotent(context.Background(), "ORDER-1", request)
+	assert.Nil(token)
+	assert.Equal("802", dpo.ErrorCode(err))
+	assert.Equal(0, created, "no token must be created when the lookup failed")
+}
@@ -0,0 +1,33 @@
+// Command schemagen writes the JSON Schema documents returned by dpo.JSONSchemas to a directory.
+//
+//	go run ./internal/schemagen -out schema
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	dpo "github.com/golang-malawi/go-dpo"
+)
+
+func main() {
+	out := flag.String("out", "schema", "directory to write the schema documents to")
+	flag.Parse()
+
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		log.Fatal(err)
+	}
+	for name, schema := range dpo.JSONSchemas() {
+		data, err := json.MarshalIndent(schema, "", "  ")
+		if err != nil {
+			log.Fatalf("%s: %v", name, err)
+		}
+		data = append(data, '\n')
+		if err := os.WriteFile(filepath.Join(*out, name+".schema.json"), data, 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package dpo
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// serviceDateLayout is the format DPO expects for Service.ServiceDate.
+const serviceDateLayout = "2006/01/02 15:04"
+
+// jsonAmount normalises an amount returned by DPO, e.g. "1,000.5" becomes "1000.50".
+// Values that are not a valid amount are returned unchanged.
+func jsonAmount(amount string) string {
+	if amount == "" {
+		return amount
+	}
+	money, err := ParseMoney(amount, "")
+	if err != nil {
+		return amount
+	}
+	return money.Decimal()
+}
+
+// jsonDate normalises a date returned by DPO to RFC 3339, e.g. "2024/01/15 10:30" becomes "2024-01-15T10:30:00Z".
+// Values that are not a valid date are returned unchanged.
+func jsonDate(date string) string {
+	if date == "" {
+		return date
+	}
+	t, err := parseDPOTime(date)
+	if err != nil {
+		return date
+	}
+	return t.Format(time.RFC3339)
+}
+
+// transactionDetailsJSON has the fields of TransactionDetails but not its MarshalJSON method,
+// so it can be embedded in the JSON form of the types that embed TransactionDetails.
+type transactionDetailsJSON TransactionDetails
+
+// normalized returns a copy of d with the amounts and dates in their JSON format.
+func (d TransactionDetails) normalized() transactionDetailsJSON {
+	d.TransactionAmount = jsonAmount(d.TransactionAmount)
+	d.TransactionNetAmount = jsonAmount(d.TransactionNetAmount)
+	d.TransactionRollingReserveAmount = jsonAmount(d.TransactionRollingReserveAmount)
+	d.TransactionFinalAmount = jsonAmount(d.TransactionFinalAmount)
+	d.TransactionSettlementDate = jsonDate(d.TransactionSettlementDate)
+	d.TransactionRollingReserveDate = jsonDate(d.TransactionRollingReserveDate)
+	return transactionDetailsJSON(d)
+}
+
+// MarshalJSON implements json.Marshaler, amounts are written with two decimal places and dates in RFC 3339 format.
+func (d TransactionDetails) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.normalized())
+}
+
+// MarshalJSON implements json.Marshaler, see TransactionDetails.MarshalJSON.
+func (v VerifyTokenResponse) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Result            string `json:"result"`
+		ResultExplanation string `json:"result_explanation"`
+		transactionDetailsJSON
+	}{
+		Result:                 v.Result,
+		ResultExplanation:      v.ResultExplanation,
+		transactionDetailsJSON: v.TransactionDetails.normalized(),
+	})
+}
+
+// MarshalJSON implements json.Marshaler, see TransactionDetails.MarshalJSON.
+func (t Transaction) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		TransToken             string `json:"trans_token"`
+		TransRef               string `json:"trans_ref,omitempty"`
+		CompanyRef             string `json:"company_ref,omitempty"`
+		Result                 string `json:"result"`
+		ResultExplanation      string `json:"result_explanation"`
+		TransactionCreatedDate string `json:"transaction_created_date,omitempty"`
+		TransactionPaymentDate string `json:"transaction_payment_date,omitempty"`
+		transactionDetailsJSON
+	}{
+		TransToken:             t.TransToken,
+		TransRef:               t.TransRef,
+		CompanyRef:             t.CompanyRef,
+		Result:                 t.Result,
+		ResultExplanation:      t.ResultExplanation,
+		TransactionCreatedDate: jsonDate(t.TransactionCreatedDate),
+		TransactionPaymentDate: jsonDate(t.TransactionPaymentDate),
+		transactionDetailsJSON: t.TransactionDetails.normalized(),
+	})
+}
+
+// MarshalJSON implements json.Marshaler, see TransactionDetails.MarshalJSON.
+func (n PushNotification) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Result            string `json:"result"`
+		ResultExplanation string `json:"result_explanation"`
+		TransToken        string `json:"trans_token"`
+		TransRef          string `json:"trans_ref"`
+		CompanyRef        string `json:"company_ref"`
+		transactionDetailsJSON
+	}{
+		Result:                 n.Result,
+		ResultExplanation:      n.ResultExplanation,
+		TransToken:             n.TransToken,
+		TransRef:               n.TransRef,
+		CompanyRef:             n.CompanyRef,
+		transactionDetailsJSON: n.TransactionDetails.normalized(),
+	})
+}
+
+// serviceJSON has the fields of Service but not its JSON methods.
+type serviceJSON Service
+
+// MarshalJSON implements json.Marshaler, the ServiceDate is written in RFC 3339 format.
+func (s Service) MarshalJSON() ([]byte, error) {
+	s.ServiceDate = jsonDate(s.ServiceDate)
+	return json.Marshal(serviceJSON(s))
+}
+
+// UnmarshalJSON implements json.Unmarshaler, the ServiceDate may be in RFC 3339 or in the DPO format.
+func (s *Service) UnmarshalJSON(data []byte) error {
+	var service serviceJSON
+	if err := json.Unmarshal(data, &service); err != nil {
+		return err
+	}
+	if service.ServiceDate != "" {
+		date, err := parseDPOTime(service.ServiceDate)
+		if err != nil {
+			return fmt.Errorf("invalid service_date: %v", err)
+		}
+		service.ServiceDate = date.Format(serviceDateLayout)
+	}
+	*s = Service(service)
+	return nil
+}
+
+// MaskCardNumber replaces all but the last four digits of a card number with '*', spaces are removed first.
+func MaskCardNumber(number string) string {
+	number = strings.ReplaceAll(number, " ", "")
+	if len(number) <= 4 {
+		return strings.Repeat("*", len(number))
+	}
+	return strings.Repeat("*", len(number)-4) + number[len(number)-4:]
+}
+
+// chargeCreditCardRequestJSON has the fields of ChargeCreditCardRequest but not its MarshalJSON method.
+type chargeCreditCardRequestJSON ChargeCreditCardRequest
+
+// MarshalJSON implements json.Marshaler, the card number is masked and the CVV is left out,
+// so the request can be logged or stored safely.
+func (c ChargeCreditCardRequest) MarshalJSON() ([]byte, error) {
+	c.CreditCardNumber = MaskCardNumber(c.CreditCardNumber)
+	return json.Marshal(chargeCreditCardRequestJSON(c))
+}
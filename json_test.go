@@ -0,0 +1,88 @@
+package dpo_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/golang-malawi/go-dpo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyTokenResponseJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	response := dpo.VerifyTokenResponse{Result: "000", ResultExplanation: "Transaction paid"}
+	response.TransactionAmount = "1,000.5"
+	response.TransactionCurrency = "USD"
+	response.TransactionSettlementDate = "2024/01/15 10:30"
+
+	data, err := json.Marshal(response)
+	assert.Nil(err)
+	assert.JSONEq(`{
+		"result": "000",
+		"result_explanation": "Transaction paid",
+		"transaction_amount": "1000.50",
+		"transaction_currency": "USD",
+		"transaction_settlement_date": "2024-01-15T10:30:00Z"
+	}`, string(data))
+
+	var decoded dpo.VerifyTokenResponse
+	assert.Nil(json.Unmarshal(data, &decoded))
+	assert.Equal("1000.50", decoded.TransactionAmount)
+	assert.Equal("000", decoded.Result)
+}
+
+func TestTransactionJSONKeepsInvalidValues(t *testing.T) {
+	assert := assert.New(t)
+
+	transaction := dpo.Transaction{TransToken: "T1", Result: "000", TransactionCreatedDate: "yesterday"}
+	transaction.TransactionAmount = "n/a"
+
+	data, err := json.Marshal(transaction)
+	assert.Nil(err)
+	assert.Contains(string(data), `"transaction_created_date":"yesterday"`)
+	assert.Contains(string(data), `"transaction_amount":"n/a"`)
+}
+
+func TestServiceJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	request := &dpo.CreateTokenRequest{CompanyToken: "secret"}
+	request.AddService("3854", "Test", time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC))
+
+	data, err := json.Marshal(request)
+	assert.Nil(err)
+	assert.Contains(string(data), `"service_date":"2024-01-15T10:30:00Z"`)
+	assert.NotContains(string(data), "secret")
+
+	var decoded dpo.CreateTokenRequest
+	assert.Nil(json.Unmarshal(data, &decoded))
+	assert.Equal("2024/01/15 10:30", decoded.Services[0].ServiceDate)
+
+	var service dpo.Service
+	assert.NotNil(json.Unmarshal([]byte(`{"service_date":"soon"}`), &service))
+}
+
+func TestChargeCreditCardRequestJSONRedactsCard(t *testing.T) {
+	assert := assert.New(t)
+
+	request := dpo.ChargeCreditCardRequest{
+		CompanyToken:     "secret",
+		CreditCardNumber: "4111111111111111",
+		CreditCardExpiry: "1230",
+		CreditCardCVV:    "987",
+		CardHolderName:   "John Doe",
+		ThreeD:           &dpo.ThreeDRequest{Enrolled: "Y", Paresstatus: "Y", Eci: "05", Cavv: "AAABBBCCC", Pares: "eJzVWN"},
+	}
+
+	data, err := json.Marshal(request)
+	assert.Nil(err)
+	assert.Contains(string(data), `"credit_card_number":"************1111"`)
+	assert.NotContains(string(data), "4111111111111111")
+	assert.NotContains(string(data), "987")
+	assert.NotContains(string(data), "AAABBBCCC")
+	assert.NotContains(string(data), "eJzVWN")
+	assert.NotContains(string(data), "secret")
+	assert.Equal("4111111111111111", request.CreditCardNumber)
+}
@@ -0,0 +1,142 @@
+package dpo
+
+import (
+	"context"
+	"encoding/xml"
+	"expvar"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RequestAttempt describes a single HTTP attempt of a request to the DPO API.
+type RequestAttempt struct {
+	Op          string        // Op the API3G request name, e.g. "createToken"
+	Retry       int           // Retry 0 for the first attempt, 1 for the first retry and so on
+	HTTPStatus  int           // HTTPStatus the status code of the response, 0 when no response was received
+	ResultCode  string        // ResultCode the DPO result code of the response, empty when there is none
+	ServiceType string        // ServiceType the service type of the first service of a createToken request, empty for other requests
+	Currency    string        // Currency the currency of a createToken request or of the transaction in a verifyToken response
+	Duration    time.Duration // Duration from sending the request until the response body was read
+	Err         error         // Err the transport error when no response was received
+}
+
+// Metrics receives a RequestAttempt for every HTTP request a Client sends to DPO.
+// ObserveAttempt is called from the goroutine making the request, so it must be safe for concurrent use and
+// should not block.
+type Metrics interface {
+	ObserveAttempt(ctx context.Context, attempt RequestAttempt)
+}
+
+// SetMetrics makes the client report every request attempt to metrics.
+// Passing nil disables the reporting.
+func (c *Client) SetMetrics(metrics Metrics) {
+	c.metrics = metrics
+}
+
+// observeAttempt reports an attempt to the metrics of the client, if any.
+// Only createToken requests carry a service type, neither the verifyToken response nor the PaymentRecord has one,
+// so the ServiceType of every other attempt is empty.
+func (c *Client) observeAttempt(ctx context.Context, attempt RequestAttempt, request any, body []byte) {
+	if c.metrics == nil {
+		return
+	}
+	if attempt.ResultCode == "" && len(body) > 0 {
+		attempt.ResultCode = resultCode(body)
+	}
+	switch r := request.(type) {
+	case *CreateTokenRequest:
+		attempt.Currency = r.Transaction.PaymentCurrency
+		if len(r.Services) > 0 {
+			attempt.ServiceType = r.Services[0].ServiceType
+		}
+	case *VerifyTokenRequest:
+		var response VerifyTokenResponse
+		if xml.Unmarshal(body, &response) == nil {
+			attempt.Currency = response.TransactionCurrency
+		}
+	}
+	c.metrics.ObserveAttempt(ctx, attempt)
+}
+
+// resultCode reads the result code of a DPO response, which is in the Result element for most requests
+// and in the Code element for ChargeTokenMobile.
+func resultCode(body []byte) string {
+	var response struct {
+		Result string `xml:"Result"`
+		Code   string `xml:"Code"`
+	}
+	if err := xml.Unmarshal(body, &response); err != nil {
+		return ""
+	}
+	if response.Result != "" {
+		return response.Result
+	}
+	if code, err := strconv.Atoi(strings.TrimSpace(response.Code)); err == nil {
+		return fmt.Sprintf("%03d", code)
+	}
+	return response.Code
+}
+
+// ExpvarMetrics is a Metrics which publishes counters with the expvar package, e.g. on /debug/vars.
+type ExpvarMetrics struct {
+	Attempts   *expvar.Map // Attempts number of attempts per operation
+	Retries    *expvar.Map // Retries number of attempts after the first one per operation
+	Errors     *expvar.Map // Errors number of attempts without a response per operation
+	HTTPStatus *expvar.Map // HTTPStatus number of responses per operation and status code, keyed "op:status"
+	Results    *expvar.Map // Results number of responses per result code, keyed "op:result:service type:currency"
+	Seconds    *expvar.Map // Seconds total duration of the attempts per operation, divide by Attempts for the mean
+
+	Waits       *expvar.Map // Waits number of attempts which went through a Limit per operation
+	WaitSeconds *expvar.Map // WaitSeconds total time attempts waited for a Limit per operation, divide by Waits for the mean
+}
+
+// NewExpvarMetrics creates an ExpvarMetrics and publishes it as a map under name.
+// Like expvar.Publish it panics if name is already in use.
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	m := &ExpvarMetrics{
+		Attempts:   new(expvar.Map).Init(),
+		Retries:    new(expvar.Map).Init(),
+		Errors:     new(expvar.Map).Init(),
+		HTTPStatus: new(expvar.Map).Init(),
+		Results:    new(expvar.Map).Init(),
+		Seconds:    new(expvar.Map).Init(),
+
+		Waits:       new(expvar.Map).Init(),
+		WaitSeconds: new(expvar.Map).Init(),
+	}
+	root := expvar.NewMap(name)
+	root.Set("attempts", m.Attempts)
+	root.Set("retries", m.Retries)
+	root.Set("errors", m.Errors)
+	root.Set("http_status", m.HTTPStatus)
+	root.Set("results", m.Results)
+	root.Set("seconds", m.Seconds)
+	root.Set("waits", m.Waits)
+	root.Set("wait_seconds", m.WaitSeconds)
+	return m
+}
+
+// ObserveAttempt implements Metrics.
+func (m *ExpvarMetrics) ObserveAttempt(ctx context.Context, attempt RequestAttempt) {
+	m.Attempts.Add(attempt.Op, 1)
+	m.Seconds.AddFloat(attempt.Op, attempt.Duration.Seconds())
+	if attempt.Retry > 0 {
+		m.Retries.Add(attempt.Op, 1)
+	}
+	if attempt.Err != nil || attempt.HTTPStatus == 0 {
+		m.Errors.Add(attempt.Op, 1)
+		return
+	}
+	m.HTTPStatus.Add(attempt.Op+":"+strconv.Itoa(attempt.HTTPStatus), 1)
+	if attempt.ResultCode != "" {
+		m.Results.Add(strings.Join([]string{attempt.Op, attempt.ResultCode, attempt.ServiceType, attempt.Currency}, ":"), 1)
+	}
+}
+
+// ObserveWait implements WaitMetrics.
+func (m *ExpvarMetrics) ObserveWait(ctx context.Context, op string, wait time.Duration) {
+	m.Waits.Add(op, 1)
+	m.WaitSeconds.AddFloat(op, wait.Seconds())
+}
@@ -0,0 +1,86 @@
+package dpo_test
+
+import (
+	"context"
+	"expvar"
+	"math/big"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-malawi/go-dpo"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingMetrics struct {
+	mu       sync.Mutex
+	attempts []dpo.RequestAttempt
+}
+
+func (m *recordingMetrics) ObserveAttempt(ctx context.Context, attempt dpo.RequestAttempt) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.attempts = append(m.attempts, attempt)
+}
+
+func TestMetricsObserveRetries(t *testing.T) {
+	assert := assert.New(t)
+
+	calls := 0
+	client := newStubClientFunc(func(string) (int, string) {
+		calls++
+		if calls < 3 {
+			return http.StatusBadGateway, "bad gateway"
+		}
+		return http.StatusOK, `<API3G><Result>901</Result><ResultExplanation>Declined</ResultExplanation><TransactionCurrency>USD</TransactionCurrency></API3G>`
+	})
+	metrics := &recordingMetrics{}
+	client.SetMetrics(metrics)
+
+	_, err := client.VerifyToken(&dpo.CreateTokenResponse{TransToken: "T1"})
+	assert.Nil(err)
+	assert.Len(metrics.attempts, 3)
+	assert.Equal(0, metrics.attempts[0].Retry)
+	assert.Equal(http.StatusBadGateway, metrics.attempts[0].HTTPStatus)
+	assert.Equal("", metrics.attempts[0].ResultCode)
+
+	last := metrics.attempts[2]
+	assert.Equal("verifyToken", last.Op)
+	assert.Equal(2, last.Retry)
+	assert.Equal(http.StatusOK, last.HTTPStatus)
+	assert.Equal("901", last.ResultCode)
+	assert.Equal("USD", last.Currency)
+}
+
+func TestMetricsCreateTokenLabels(t *testing.T) {
+	assert := assert.New(t)
+
+	client := newStubClient(http.StatusOK, `<API3G><Result>000</Result><ResultExplanation>Created</ResultExplanation><TransToken>T1</TransToken></API3G>`, nil)
+	metrics := &recordingMetrics{}
+	client.SetMetrics(metrics)
+
+	request := client.NewCreateTokenRequest("TOKEN", "MWK", big.NewFloat(100))
+	request.AddService("3854", "Test", time.Now())
+	_, err := client.CreateToken(request)
+	assert.Nil(err)
+	assert.Len(metrics.attempts, 1)
+	assert.Equal("000", metrics.attempts[0].ResultCode)
+	assert.Equal("3854", metrics.attempts[0].ServiceType)
+	assert.Equal("MWK", metrics.attempts[0].Currency)
+}
+
+func TestExpvarMetrics(t *testing.T) {
+	assert := assert.New(t)
+
+	metrics := dpo.NewExpvarMetrics("dpo_test_metrics")
+	metrics.ObserveAttempt(context.Background(), dpo.RequestAttempt{Op: "verifyToken", HTTPStatus: 500, Duration: time.Second})
+	metrics.ObserveAttempt(context.Background(), dpo.RequestAttempt{Op: "verifyToken", Retry: 1, HTTPStatus: 200, ResultCode: "901", Currency: "USD", Duration: time.Second})
+
+	assert.Equal("2", metrics.Attempts.Get("verifyToken").String())
+	assert.Equal("1", metrics.Retries.Get("verifyToken").String())
+	assert.Equal("1", metrics.HTTPStatus.Get("verifyToken:500").String())
+	assert.Equal("1", metrics.Results.Get("verifyToken:901::USD").String())
+	assert.Equal("2", metrics.Seconds.Get("verifyToken").String())
+	assert.NotNil(expvar.Get("dpo_test_metrics"))
+}
@@ -1,25 +1,248 @@
 package dpo
 
-import "encoding/xml"
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+const (
+	opChargeTokenMobile = "ChargeTokenMobile"
+)
+
+// Codes DPO returns in ChargeTokenMobileResponse.Code when a mobile money charge was accepted.
+const (
+	MobileChargeSent    = 0   // MobileChargeSent the charge was processed
+	MobileChargePending = 130 // MobileChargePending the subscriber was asked to approve the payment on their phone
+)
 
 // ChargeTokenMobileRequest is a request to charge a subscriber's mobile money directly.
 type ChargeTokenMobileRequest struct {
-	XMLName          xml.Name `xml:"API3G"`
-	CompanyToken     string   `xml:"CompanyToken"`
-	Request          string   `xml:"Request"`
-	TransactionToken string   `xml:"TransactionToken"`
-	PhoneNumber      string   `xml:"PhoneNumber"`
-	MNO              string   `xml:"MNO"`
-	MNOcountry       string   `xml:"MNOcountry"`
+	XMLName          xml.Name `xml:"API3G" json:"-"`
+	CompanyToken     string   `xml:"CompanyToken" json:"-"`
+	Request          string   `xml:"Request" json:"request"`
+	TransactionToken string   `xml:"TransactionToken" json:"trans_token"`
+	PhoneNumber      string   `xml:"PhoneNumber" json:"phone_number"`
+	MNO              string   `xml:"MNO" json:"mno"`
+	MNOcountry       string   `xml:"MNOcountry" json:"mno_country"`
 }
 
 // ChargeTokenMobileResponse is a response from a ChargeTokenMobileRequest.
 type ChargeTokenMobileResponse struct {
-	XMLName        xml.Name `xml:"API3G"`
-	Code           int      `xml:"Code"`
-	Explanation    string   `xml:"Explanation"`
-	RedirectURL    string   `xml:"RedirectUrl"`
-	DeclinedURL    string   `xml:"declinedUrl"`
-	Instructions   string   `xml:"Instructions"`
-	RedirectOption int      `xml:"RedirectOption"`
+	XMLName        xml.Name `xml:"API3G" json:"-"`
+	Code           int      `xml:"Code" json:"code"`
+	Explanation    string   `xml:"Explanation" json:"explanation"`
+	RedirectURL    string   `xml:"RedirectUrl" json:"redirect_url"`
+	DeclinedURL    string   `xml:"declinedUrl" json:"declined_url"`
+	Instructions   string   `xml:"Instructions" json:"instructions"`
+	RedirectOption int      `xml:"RedirectOption" json:"redirect_option"`
+}
+
+// IsError determines whether the ChargeTokenMobileResponse is an error or not.
+func (c *ChargeTokenMobileResponse) IsError() bool {
+	return c.Code != MobileChargeSent && c.Code != MobileChargePending
+}
+
+// MobileNetwork is a mobile network operator (MNO) supported for mobile money payments.
+type MobileNetwork struct {
+	Name     string   `json:"name"`     // Name the MNO value DPO expects, e.g. "airtel"
+	Label    string   `json:"label"`    // Label human readable name, e.g. "Airtel Money"
+	Prefixes []string `json:"prefixes"` // Prefixes of the national significant number assigned to the network
+}
+
+// MobileCountry is a country supported for mobile money payments.
+type MobileCountry struct {
+	Name         string          `json:"name"`          // Name the MNOcountry value DPO expects, e.g. "malawi"
+	ISOCode      string          `json:"iso_code"`      // ISOCode ISO 3166-1 alpha-2 code, e.g. "MW"
+	DialCode     string          `json:"dial_code"`     // DialCode international dialling code without "+", e.g. "265"
+	NumberLength int             `json:"number_length"` // NumberLength number of digits of a national significant number, i.e. without the trunk prefix 0
+	Networks     []MobileNetwork `json:"networks"`
+}
+
+// mobileCountries is the registry of countries and networks DPO supports for mobile money.
+var mobileCountries = []MobileCountry{
+	{Name: "malawi", ISOCode: "MW", DialCode: "265", NumberLength: 9, Networks: []MobileNetwork{
+		{Name: "airtel", Label: "Airtel Money", Prefixes: []string{"99", "98"}},
+		{Name: "tnm", Label: "TNM Mpamba", Prefixes: []string{"88", "89"}},
+	}},
+	{Name: "kenya", ISOCode: "KE", DialCode: "254", NumberLength: 9, Networks: []MobileNetwork{
+		{Name: "mpesa", Label: "M-Pesa", Prefixes: []string{"70", "71", "72", "74", "757", "758", "759", "768", "769", "79", "11"}},
+		{Name: "airtel", Label: "Airtel Money", Prefixes: []string{"73", "750", "751", "752", "753", "754", "755", "756", "762", "78", "10"}},
+	}},
+	{Name: "tanzania", ISOCode: "TZ", DialCode: "255", NumberLength: 9, Networks: []MobileNetwork{
+		{Name: "vodacom", Label: "Vodacom M-Pesa", Prefixes: []string{"74", "75", "76"}},
+		{Name: "airtel", Label: "Airtel Money", Prefixes: []string{"68", "69", "78"}},
+		{Name: "tigo", Label: "Tigo Pesa", Prefixes: []string{"65", "67", "71"}},
+		{Name: "halotel", Label: "HaloPesa", Prefixes: []string{"61", "62"}},
+	}},
+	{Name: "zambia", ISOCode: "ZM", DialCode: "260", NumberLength: 9, Networks: []MobileNetwork{
+		{Name: "airtel", Label: "Airtel Money", Prefixes: []string{"97", "77"}},
+		{Name: "mtn", Label: "MTN Mobile Money", Prefixes: []string{"96", "76"}},
+		{Name: "zamtel", Label: "Zamtel Kwacha", Prefixes: []string{"95", "75"}},
+	}},
+	{Name: "uganda", ISOCode: "UG", DialCode: "256", NumberLength: 9, Networks: []MobileNetwork{
+		{Name: "mtn", Label: "MTN Mobile Money", Prefixes: []string{"77", "78", "76", "39"}},
+		{Name: "airtel", Label: "Airtel Money", Prefixes: []string{"70", "74", "75", "20"}},
+	}},
+	{Name: "ghana", ISOCode: "GH", DialCode: "233", NumberLength: 9, Networks: []MobileNetwork{
+		{Name: "mtn", Label: "MTN Mobile Money", Prefixes: []string{"24", "25", "53", "54", "55", "59"}},
+		{Name: "vodafone", Label: "Vodafone Cash", Prefixes: []string{"20", "50"}},
+		{Name: "airteltigo", Label: "AirtelTigo Money", Prefixes: []string{"26", "27", "56", "57"}},
+	}},
+	{Name: "rwanda", ISOCode: "RW", DialCode: "250", NumberLength: 9, Networks: []MobileNetwork{
+		{Name: "mtn", Label: "MTN Mobile Money", Prefixes: []string{"78", "79"}},
+		{Name: "airtel", Label: "Airtel Money", Prefixes: []string{"72", "73"}},
+	}},
+}
+
+// MobileCountries returns the countries supported for mobile money payments.
+func MobileCountries() []MobileCountry {
+	countries := make([]MobileCountry, len(mobileCountries))
+	copy(countries, mobileCountries)
+	return countries
+}
+
+// LookupMobileCountry finds a supported country by its DPO name (e.g. "malawi") or ISO code (e.g. "MW").
+func LookupMobileCountry(country string) (*MobileCountry, bool) {
+	country = strings.TrimSpace(country)
+	for i := range mobileCountries {
+		if strings.EqualFold(mobileCountries[i].Name, country) || strings.EqualFold(mobileCountries[i].ISOCode, country) {
+			return &mobileCountries[i], true
+		}
+	}
+	return nil, false
+}
+
+// Network finds a network of the country by its DPO name, e.g. "airtel".
+func (mc *MobileCountry) Network(name string) (*MobileNetwork, bool) {
+	name = strings.ReplaceAll(strings.TrimSpace(name), "-", "")
+	for i := range mc.Networks {
+		if strings.EqualFold(mc.Networks[i].Name, name) {
+			return &mc.Networks[i], true
+		}
+	}
+	return nil, false
+}
+
+// NormalizeNumber converts a phone number in local or international format, e.g. "0991234567", "+265 99 123 4567"
+// or "265991234567", into the international format without "+" that DPO expects.
+func (mc *MobileCountry) NormalizeNumber(phone string) (string, error) {
+	digits := strings.Map(func(r rune) rune {
+		switch {
+		case r >= '0' && r <= '9':
+			return r
+		case r == ' ' || r == '-' || r == '(' || r == ')' || r == '.' || r == '+':
+			return -1
+		default:
+			return 'x'
+		}
+	}, phone)
+	if strings.Contains(digits, "x") {
+		return "", fmt.Errorf("invalid phone number %q: unexpected characters", phone)
+	}
+
+	national := digits
+	switch {
+	case strings.HasPrefix(digits, "00"+mc.DialCode) && len(digits) == 2+len(mc.DialCode)+mc.NumberLength:
+		national = digits[2+len(mc.DialCode):]
+	case strings.HasPrefix(digits, mc.DialCode) && len(digits) == len(mc.DialCode)+mc.NumberLength:
+		national = digits[len(mc.DialCode):]
+	case strings.HasPrefix(digits, "0") && len(digits) == mc.NumberLength+1:
+		national = digits[1:]
+	}
+
+	if len(national) != mc.NumberLength || national[0] == '0' {
+		return "", fmt.Errorf("invalid phone number %q for %s: expected %d digits after the dial code", phone, mc.Name, mc.NumberLength)
+	}
+	return mc.DialCode + national, nil
+}
+
+// DetectNetwork returns the network a normalized phone number belongs to based on its prefix.
+// The longest matching prefix wins.
+func (mc *MobileCountry) DetectNetwork(normalized string) (*MobileNetwork, bool) {
+	national := strings.TrimPrefix(normalized, mc.DialCode)
+
+	var found *MobileNetwork
+	longest := 0
+	for i := range mc.Networks {
+		for _, prefix := range mc.Networks[i].Prefixes {
+			if len(prefix) > longest && strings.HasPrefix(national, prefix) {
+				found = &mc.Networks[i]
+				longest = len(prefix)
+			}
+		}
+	}
+	return found, found != nil
+}
+
+// MobilePayment identifies the mobile money account to charge, validated by NewMobilePayment.
+type MobilePayment struct {
+	PhoneNumber string // PhoneNumber in international format without "+", e.g. "265991234567"
+	MNO         string // MNO the DPO name of the network, e.g. "airtel"
+	Country     string // Country the DPO name of the country, e.g. "malawi"
+}
+
+// NewMobilePayment validates and normalizes the phone number, network and country of a mobile money payment.
+// country may be a DPO country name or ISO code. If mno is empty the network is detected from the number prefix.
+func NewMobilePayment(phone, mno, country string) (*MobilePayment, error) {
+	mobileCountry, ok := LookupMobileCountry(country)
+	if !ok {
+		return nil, fmt.Errorf("unsupported mobile money country %q", country)
+	}
+
+	normalized, err := mobileCountry.NormalizeNumber(phone)
+	if err != nil {
+		return nil, err
+	}
+
+	var network *MobileNetwork
+	if strings.TrimSpace(mno) == "" {
+		network, ok = mobileCountry.DetectNetwork(normalized)
+		if !ok {
+			return nil, fmt.Errorf("could not detect the mobile network of %s in %s, please specify the MNO", normalized, mobileCountry.Name)
+		}
+	} else {
+		network, ok = mobileCountry.Network(mno)
+		if !ok {
+			return nil, fmt.Errorf("unsupported mobile network %q in %s", mno, mobileCountry.Name)
+		}
+	}
+
+	return &MobilePayment{
+		PhoneNumber: normalized,
+		MNO:         network.Name,
+		Country:     mobileCountry.Name,
+	}, nil
+}
+
+// ChargeMobile charges a mobile money account against a token created with client.CreateToken.
+// The phone number, network and country are validated with NewMobilePayment before DPO is called.
+// On success the subscriber usually has to approve the payment on their phone, poll client.VerifyToken for the outcome.
+func (c *Client) ChargeMobile(ctx context.Context, token *CreateTokenResponse, phone, mno, country string) (*ChargeTokenMobileResponse, error) {
+	if token == nil || token.TransToken == "" {
+		return nil, fmt.Errorf("token must not be empty")
+	}
+	payment, err := NewMobilePayment(phone, mno, country)
+	if err != nil {
+		return nil, err
+	}
+
+	mobileRequest := &ChargeTokenMobileRequest{
+		CompanyToken:     c.Token,
+		Request:          opChargeTokenMobile,
+		TransactionToken: token.TransToken,
+		PhoneNumber:      payment.PhoneNumber,
+		MNO:              payment.MNO,
+		MNOcountry:       payment.Country,
+	}
+
+	var mobileResponse ChargeTokenMobileResponse
+	if err := c.post(ctx, opChargeTokenMobile, mobileRequest, &mobileResponse); err != nil {
+		return nil, err
+	}
+	if mobileResponse.IsError() {
+		return &mobileResponse, &Error{Op: opChargeTokenMobile, Code: fmt.Sprintf("%03d", mobileResponse.Code), Explanation: mobileResponse.Explanation}
+	}
+	return &mobileResponse, nil
 }
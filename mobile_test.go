@@ -0,0 +1,69 @@
+package dpo_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/golang-malawi/go-dpo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMobilePayment(t *testing.T) {
+	assert := assert.New(t)
+
+	cases := []struct {
+		phone, mno, country string
+		number, network     string
+	}{
+		{"0991234567", "", "malawi", "265991234567", "airtel"},
+		{"+265 88 123 4567", "", "MW", "265881234567", "tnm"},
+		{"265991234567", "Airtel", "Malawi", "265991234567", "airtel"},
+		{"0712 345 678", "", "KE", "254712345678", "mpesa"},
+		{"0757123456", "", "kenya", "254757123456", "mpesa"},
+		{"0750123456", "", "kenya", "254750123456", "airtel"},
+		{"00255 754 123 456", "", "TZ", "255754123456", "vodacom"},
+	}
+	for _, c := range cases {
+		payment, err := dpo.NewMobilePayment(c.phone, c.mno, c.country)
+		if assert.Nil(err, c.phone) {
+			assert.Equal(c.number, payment.PhoneNumber, c.phone)
+			assert.Equal(c.network, payment.MNO, c.phone)
+		}
+	}
+}
+
+func TestNewMobilePaymentErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := dpo.NewMobilePayment("0991234567", "", "atlantis")
+	assert.ErrorContains(err, "unsupported mobile money country")
+
+	_, err = dpo.NewMobilePayment("099123456", "", "malawi")
+	assert.ErrorContains(err, "invalid phone number")
+
+	_, err = dpo.NewMobilePayment("0991234567", "mpesa", "malawi")
+	assert.ErrorContains(err, "unsupported mobile network")
+
+	_, err = dpo.NewMobilePayment("0111234567", "", "malawi")
+	assert.ErrorContains(err, "could not detect")
+}
+
+func TestChargeMobileValidatesBeforeCall(t *testing.T) {
+	assert := assert.New(t)
+
+	var requests []string
+	client := newStubClient(http.StatusOK, `<API3G><Code>130</Code><Explanation>New invoice</Explanation></API3G>`, &requests)
+	token := &dpo.CreateTokenResponse{TransToken: "T1"}
+
+	_, err := client.ChargeMobile(context.Background(), token, "12345", "", "malawi")
+	assert.NotNil(err)
+	assert.Empty(requests)
+
+	response, err := client.ChargeMobile(context.Background(), token, "0991234567", "", "malawi")
+	assert.Nil(err)
+	assert.Equal(dpo.MobileChargePending, response.Code)
+	assert.Contains(requests[0], "<PhoneNumber>265991234567</PhoneNumber>")
+	assert.Contains(requests[0], "<MNO>airtel</MNO>")
+	assert.Contains(requests[0], "<MNOcountry>malawi</MNOcountry>")
+}
@@ -0,0 +1,153 @@
+package dpo
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount of a currency as used by DPO, which works with two decimal places for all currencies.
+// The amount is kept in hundredths of the currency unit so that sums and comparisons are exact.
+type Money struct {
+	Cents    int64  `json:"cents"`    // Cents the amount in hundredths of the currency unit, e.g. 1050 for 10.50
+	Currency string `json:"currency"` // Currency ISO 4217 code, e.g. "USD" or "MWK"
+}
+
+// NewMoney creates Money from a big.Float amount, rounding to two decimal places.
+func NewMoney(amount *big.Float, currency string) (Money, error) {
+	if amount == nil {
+		return Money{}, fmt.Errorf("amount must not be nil")
+	}
+	return ParseMoney(amount.Text('f', 2), currency)
+}
+
+// ParseMoney parses a decimal amount such as "10.5", "1,000.00" or "-3" as returned by the DPO API.
+// Amounts with more than two decimal places are rejected rather than silently rounded.
+func ParseMoney(amount, currency string) (Money, error) {
+	s := strings.ReplaceAll(strings.TrimSpace(amount), ",", "")
+	if s == "" {
+		return Money{}, fmt.Errorf("invalid amount: empty string")
+	}
+
+	negative := false
+	if s[0] == '-' || s[0] == '+' {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
+
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+	if !isDigits(whole) || !isDigits(frac) || whole+frac == "" {
+		return Money{}, fmt.Errorf("invalid amount %q", amount)
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	if len(frac) > 2 {
+		if strings.TrimRight(frac[2:], "0") != "" {
+			return Money{}, fmt.Errorf("invalid amount %q: more than two decimal places", amount)
+		}
+		frac = frac[:2]
+	}
+	for len(frac) < 2 {
+		frac += "0"
+	}
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units > (math.MaxInt64-99)/100 {
+		return Money{}, fmt.Errorf("invalid amount %q: out of range", amount)
+	}
+	cents, err := strconv.ParseInt(frac, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid amount %q", amount)
+	}
+
+	total := units*100 + cents
+	if negative {
+		total = -total
+	}
+	return Money{Cents: total, Currency: strings.ToUpper(strings.TrimSpace(currency))}, nil
+}
+
+// isDigits reports whether s only consists of the digits 0-9, ParseInt would also accept a sign.
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Decimal formats the amount with two decimal places and without the currency, e.g. "10.50".
+// This is the format DPO expects for amounts in requests.
+func (m Money) Decimal() string {
+	cents := m.Cents
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// Float returns the amount as a big.Float, e.g. for use with client.NewCreateTokenRequest.
+func (m Money) Float() *big.Float {
+	f, _ := new(big.Float).SetString(m.Decimal())
+	return f
+}
+
+// String formats the amount with its currency, e.g. "10.50 USD".
+func (m Money) String() string {
+	if m.Currency == "" {
+		return m.Decimal()
+	}
+	return m.Decimal() + " " + m.Currency
+}
+
+// IsZero reports whether the amount is zero.
+func (m Money) IsZero() bool {
+	return m.Cents == 0
+}
+
+// Add returns m + other. Both amounts must be in the same currency.
+func (m Money) Add(other Money) (Money, error) {
+	if err := m.sameCurrency(other); err != nil {
+		return Money{}, err
+	}
+	return Money{Cents: m.Cents + other.Cents, Currency: m.Currency}, nil
+}
+
+// Sub returns m - other. Both amounts must be in the same currency.
+func (m Money) Sub(other Money) (Money, error) {
+	if err := m.sameCurrency(other); err != nil {
+		return Money{}, err
+	}
+	return Money{Cents: m.Cents - other.Cents, Currency: m.Currency}, nil
+}
+
+// Cmp compares m and other and returns -1, 0 or +1. Both amounts must be in the same currency.
+func (m Money) Cmp(other Money) (int, error) {
+	if err := m.sameCurrency(other); err != nil {
+		return 0, err
+	}
+	switch {
+	case m.Cents < other.Cents:
+		return -1, nil
+	case m.Cents > other.Cents:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+func (m Money) sameCurrency(other Money) error {
+	if !strings.EqualFold(m.Currency, other.Currency) {
+		return fmt.Errorf("currency mismatch: %s and %s", m.Currency, other.Currency)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package dpo_test
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/golang-malawi/go-dpo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMoney(t *testing.T) {
+	assert := assert.New(t)
+
+	m, err := dpo.ParseMoney("1,000.5", "usd")
+	assert.Nil(err)
+	assert.Equal(int64(100050), m.Cents)
+	assert.Equal("1000.50 USD", m.String())
+
+	m, err = dpo.ParseMoney(".5", "USD")
+	assert.Nil(err)
+	assert.Equal(int64(50), m.Cents)
+
+	m, err = dpo.ParseMoney("92233720368547757", "USD")
+	assert.Nil(err)
+	assert.Equal(int64(9223372036854775700), m.Cents)
+
+	m, err = dpo.ParseMoney("-0.05", "USD")
+	assert.Nil(err)
+	assert.Equal("-0.05", m.Decimal())
+
+	for _, invalid := range []string{"1.005", "abc", "--5", "-+5", "+-5", "++5", "1.+5", "1.-5", "1.5-", ".", "-", "+", "-.", "92233720368547758.07", "99999999999999999999"} {
+		_, err = dpo.ParseMoney(invalid, "USD")
+		assert.NotNil(err, invalid)
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	assert := assert.New(t)
+
+	a, err := dpo.NewMoney(big.NewFloat(0.1), "USD")
+	assert.Nil(err)
+	b, err := dpo.NewMoney(big.NewFloat(0.2), "USD")
+	assert.Nil(err)
+	c, err := dpo.NewMoney(big.NewFloat(0.3), "USD")
+	assert.Nil(err)
+
+	sum, err := a.Add(b)
+	assert.Nil(err)
+	cmp, err := sum.Cmp(c)
+	assert.Nil(err)
+	assert.Equal(0, cmp)
+
+	_, err = a.Add(dpo.Money{Cents: 1, Currency: "MWK"})
+	assert.NotNil(err)
+}
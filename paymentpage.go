@@ -0,0 +1,122 @@
+package dpo
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+)
+
+// paymentFormTemplate posts the transaction token to the DPO payment page as soon as it is rendered.
+// The button is only shown when JavaScript is disabled.
+var paymentFormTemplate = template.Must(template.New("dpo_payment_form").Parse(`<form action="{{ .PaymentURL }}" method="post" name="dpo_redirect" id="dpo_redirect">
+  <p>Kindly wait while you're redirected to the DPO Group ...</p>
+  <input name="transToken" type="hidden" value="{{ .TransToken }}" />
+  <noscript><button type="submit">Continue to payment</button></noscript>
+</form>
+<script type="text/javascript">document.getElementById('dpo_redirect').submit();</script>`))
+
+// paymentPageTemplate wraps the payment form in a complete HTML document.
+var paymentPageTemplate = template.Must(template.Must(paymentFormTemplate.Clone()).New("dpo_payment_page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="UTF-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1.0">
+  <title>{{ .Title }}</title>
+</head>
+<body>
+  {{ template "dpo_payment_form" . }}
+</body>
+</html>
+`))
+
+// paymentPageData is the data passed to the payment templates.
+type paymentPageData struct {
+	Title      string
+	PaymentURL string
+	TransToken string
+}
+
+func (c *Client) paymentPageData(token *CreateTokenResponse) (*paymentPageData, error) {
+	if token == nil || token.TransToken == "" {
+		return nil, fmt.Errorf("token must not be empty")
+	}
+	return &paymentPageData{
+		Title:      "Redirecting to payment",
+		PaymentURL: c.MakePaymentURL(token),
+		TransToken: token.TransToken,
+	}, nil
+}
+
+// PaymentForm renders an HTML fragment with a form that automatically posts the token to the DPO payment page.
+// The fragment can be embedded in your own templates.
+func (c *Client) PaymentForm(token *CreateTokenResponse) (template.HTML, error) {
+	data, err := c.paymentPageData(token)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := paymentFormTemplate.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return template.HTML(buf.String()), nil
+}
+
+// WritePaymentPage writes a complete HTML page which redirects the browser to the DPO payment page.
+func (c *Client) WritePaymentPage(w io.Writer, token *CreateTokenResponse) error {
+	data, err := c.paymentPageData(token)
+	if err != nil {
+		return err
+	}
+	return paymentPageTemplate.Execute(w, data)
+}
+
+// PaymentPageHandler returns an http.Handler that serves the redirect page for the token returned by lookup.
+// lookup typically reads an order id from the request and returns the token created for that order.
+// The page is served to customers, so errors are answered with a fixed message and never include err.
+func (c *Client) PaymentPageHandler(lookup func(r *http.Request) (*CreateTokenResponse, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := lookup(r)
+		if err != nil {
+			http.Error(w, "payment not found", http.StatusNotFound)
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := c.WritePaymentPage(&buf, token); err != nil {
+			http.Error(w, "payment page unavailable", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = buf.WriteTo(w)
+	})
+}
+
+// WritePaymentQRCodePNG writes a QR code of the payment URL of token as a PNG image, with scale pixels per module.
+// Customers can scan the code to open the DPO payment page on their phone.
+func (c *Client) WritePaymentQRCodePNG(w io.Writer, token *CreateTokenResponse, scale int) error {
+	code, err := c.paymentQRCode(token)
+	if err != nil {
+		return err
+	}
+	return code.writePNG(w, scale)
+}
+
+// WritePaymentQRCodeSVG writes a QR code of the payment URL of token as an SVG image, with scale pixels per module.
+func (c *Client) WritePaymentQRCodeSVG(w io.Writer, token *CreateTokenResponse, scale int) error {
+	code, err := c.paymentQRCode(token)
+	if err != nil {
+		return err
+	}
+	return code.writeSVG(w, scale)
+}
+
+func (c *Client) paymentQRCode(token *CreateTokenResponse) (*qrCode, error) {
+	if token == nil || token.TransToken == "" {
+		return nil, fmt.Errorf("token must not be empty")
+	}
+	return encodeQR(c.MakePaymentURL(token), qrLevelM)
+}
@@ -0,0 +1,71 @@
+package dpo_test
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-malawi/go-dpo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPaymentForm(t *testing.T) {
+	assert := assert.New(t)
+
+	client := dpo.NewClient("TOKEN", false)
+	token := &dpo.CreateTokenResponse{TransToken: "T1<script>"}
+
+	form, err := client.PaymentForm(token)
+	assert.Nil(err)
+	assert.Contains(string(form), `action="https://secure.3gdirectpay.com/payv2.php?ID=T1%3cscript%3e"`)
+	assert.Contains(string(form), `name="transToken" type="hidden" value="T1&lt;script&gt;"`)
+
+	_, err = client.PaymentForm(nil)
+	assert.NotNil(err)
+}
+
+func TestPaymentPageHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	client := dpo.NewClient("TOKEN", false)
+	handler := client.PaymentPageHandler(func(r *http.Request) (*dpo.CreateTokenResponse, error) {
+		if r.URL.Query().Get("order") != "42" {
+			return nil, errors.New("order not found")
+		}
+		return &dpo.CreateTokenResponse{TransToken: "T1"}, nil
+	})
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/pay?order=42", nil))
+	assert.Equal(http.StatusOK, recorder.Code)
+	assert.True(strings.HasPrefix(recorder.Body.String(), "<!DOCTYPE html>"))
+	assert.Contains(recorder.Body.String(), `value="T1"`)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/pay?order=1", nil))
+	assert.Equal(http.StatusNotFound, recorder.Code)
+	assert.Equal("payment not found\n", recorder.Body.String())
+}
+
+func TestPaymentQRCode(t *testing.T) {
+	assert := assert.New(t)
+
+	client := dpo.NewClient("TOKEN", false)
+	token := &dpo.CreateTokenResponse{TransToken: "8D3DA73D-9D7F-4E09-96D4-3D44E7A83EA3"}
+
+	var buf bytes.Buffer
+	assert.Nil(client.WritePaymentQRCodePNG(&buf, token, 4))
+	img, err := png.Decode(&buf)
+	assert.Nil(err)
+	// an 80 byte URL needs a version 5 symbol of 37 modules, plus a quiet zone of 4 modules on each side
+	assert.Equal((37+8)*4, img.Bounds().Dx())
+
+	buf.Reset()
+	assert.Nil(client.WritePaymentQRCodeSVG(&buf, token, 4))
+	assert.True(strings.HasPrefix(buf.String(), "<svg"))
+	assert.Contains(buf.String(), `viewBox="0 0 45 45"`)
+}
@@ -0,0 +1,529 @@
+package dpo
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+)
+
+// This file contains a small QR code encoder (ISO/IEC 18004) so that payment URLs can be rendered as
+// "scan to pay" codes without pulling in a dependency. Only byte mode is supported, which is all a URL needs.
+
+// qrLevel is a QR code error correction level.
+type qrLevel int
+
+const (
+	qrLevelL qrLevel = iota // recovers 7% of the symbol
+	qrLevelM                // recovers 15% of the symbol
+	qrLevelQ                // recovers 25% of the symbol
+	qrLevelH                // recovers 30% of the symbol
+)
+
+// formatBits are the bits encoding the error correction level in the format information.
+func (l qrLevel) formatBits() int {
+	return [...]int{1, 0, 3, 2}[l]
+}
+
+// qrECCCodewordsPerBlock is indexed by level and version, index 0 is unused.
+var qrECCCodewordsPerBlock = [4][41]int{
+	{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+// qrErrorCorrectionBlocks is indexed by level and version, index 0 is unused.
+var qrErrorCorrectionBlocks = [4][41]int{
+	{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// qrCode is an encoded QR code symbol, modules[y][x] is true for dark modules.
+type qrCode struct {
+	version    int
+	size       int
+	level      qrLevel
+	modules    [][]bool
+	isFunction [][]bool
+}
+
+// encodeQR encodes text in byte mode using the smallest version that fits at the given level.
+func encodeQR(text string, level qrLevel) (*qrCode, error) {
+	data := []byte(text)
+
+	version := 0
+	for v := 1; v <= 40; v++ {
+		countBits := 8
+		if v >= 10 {
+			countBits = 16
+		}
+		if len(data) < 1<<uint(countBits) && 4+countBits+len(data)*8 <= qrNumDataCodewords(v, level)*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("text of %d bytes is too long for a QR code", len(data))
+	}
+
+	var bits qrBitBuffer
+	bits.append(0x4, 4) // byte mode
+	if version >= 10 {
+		bits.append(len(data), 16)
+	} else {
+		bits.append(len(data), 8)
+	}
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+
+	capacity := qrNumDataCodewords(version, level) * 8
+	terminator := capacity - len(bits)
+	if terminator > 4 {
+		terminator = 4
+	}
+	bits.append(0, terminator)
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	codewords := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		if bit {
+			codewords[i>>3] |= 1 << uint(7-i&7)
+		}
+	}
+
+	q := &qrCode{version: version, size: version*4 + 17, level: level}
+	q.modules = make([][]bool, q.size)
+	q.isFunction = make([][]bool, q.size)
+	for i := range q.modules {
+		q.modules[i] = make([]bool, q.size)
+		q.isFunction[i] = make([]bool, q.size)
+	}
+
+	q.drawFunctionPatterns()
+	q.drawCodewords(q.addECCAndInterleave(codewords))
+
+	bestMask, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		q.applyMask(mask)
+		q.drawFormatBits(mask)
+		penalty := q.penalty()
+		if bestPenalty < 0 || penalty < bestPenalty {
+			bestMask, bestPenalty = mask, penalty
+		}
+		q.applyMask(mask) // masking twice undoes it
+	}
+	q.applyMask(bestMask)
+	q.drawFormatBits(bestMask)
+	return q, nil
+}
+
+// qrBitBuffer is a sequence of bits, most significant bit first.
+type qrBitBuffer []bool
+
+func (b *qrBitBuffer) append(value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		*b = append(*b, (value>>uint(i))&1 != 0)
+	}
+}
+
+// qrNumRawDataModules returns the number of modules available for data and error correction in a version.
+func qrNumRawDataModules(version int) int {
+	result := (16*version+128)*version + 64
+	if version >= 2 {
+		numAlign := version/7 + 2
+		result -= (25*numAlign-10)*numAlign - 55
+		if version >= 7 {
+			result -= 36
+		}
+	}
+	return result
+}
+
+// qrNumDataCodewords returns the number of 8-bit data codewords of a version and level.
+func qrNumDataCodewords(version int, level qrLevel) int {
+	return qrNumRawDataModules(version)/8 - qrECCCodewordsPerBlock[level][version]*qrErrorCorrectionBlocks[level][version]
+}
+
+// addECCAndInterleave splits data into blocks, appends the Reed-Solomon codewords of each block and interleaves them.
+func (q *qrCode) addECCAndInterleave(data []byte) []byte {
+	numBlocks := qrErrorCorrectionBlocks[q.level][q.version]
+	blockECCLen := qrECCCodewordsPerBlock[q.level][q.version]
+	rawCodewords := qrNumRawDataModules(q.version) / 8
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortBlockLen := rawCodewords / numBlocks
+
+	divisor := qrReedSolomonDivisor(blockECCLen)
+	blocks := make([][]byte, numBlocks)
+	for i, k := 0, 0; i < numBlocks; i++ {
+		datLen := shortBlockLen - blockECCLen
+		if i >= numShortBlocks {
+			datLen++
+		}
+		block := make([]byte, 0, shortBlockLen+1)
+		block = append(block, data[k:k+datLen]...)
+		k += datLen
+		ecc := qrReedSolomonRemainder(block, divisor)
+		if i < numShortBlocks {
+			block = append(block, 0)
+		}
+		blocks[i] = append(block, ecc...)
+	}
+
+	result := make([]byte, 0, rawCodewords)
+	for i := range blocks[0] {
+		for j, block := range blocks {
+			if i != shortBlockLen-blockECCLen || j >= numShortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+// qrReedSolomonDivisor returns the generator polynomial of the given degree, highest coefficient omitted.
+func qrReedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = qrGFMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = qrGFMultiply(root, 0x02)
+	}
+	return result
+}
+
+// qrReedSolomonRemainder returns the error correction codewords for data.
+func qrReedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coef := range divisor {
+			result[i] ^= qrGFMultiply(coef, factor)
+		}
+	}
+	return result
+}
+
+// qrGFMultiply multiplies two elements of GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func qrGFMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>uint(i))&1) * int(x)
+	}
+	return byte(z)
+}
+
+func (q *qrCode) setFunctionModule(x, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.isFunction[y][x] = true
+}
+
+// drawFunctionPatterns draws the finder, timing and alignment patterns and reserves the format and version areas.
+func (q *qrCode) drawFunctionPatterns() {
+	for i := 0; i < q.size; i++ {
+		q.setFunctionModule(6, i, i%2 == 0)
+		q.setFunctionModule(i, 6, i%2 == 0)
+	}
+
+	for _, center := range [][2]int{{3, 3}, {q.size - 4, 3}, {3, q.size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := center[0]+dx, center[1]+dy
+				if x < 0 || x >= q.size || y < 0 || y >= q.size {
+					continue
+				}
+				dist := qrMaxAbs(dx, dy)
+				q.setFunctionModule(x, y, dist != 2 && dist != 4)
+			}
+		}
+	}
+
+	positions := q.alignmentPatternPositions()
+	n := len(positions)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			if (i == 0 && j == 0) || (i == 0 && j == n-1) || (i == n-1 && j == 0) {
+				continue // overlaps a finder pattern
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					q.setFunctionModule(positions[i]+dx, positions[j]+dy, qrMaxAbs(dx, dy) != 1)
+				}
+			}
+		}
+	}
+
+	q.drawFormatBits(0)
+	q.drawVersion()
+}
+
+func qrMaxAbs(a, b int) int {
+	if a < 0 {
+		a = -a
+	}
+	if b < 0 {
+		b = -b
+	}
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// alignmentPatternPositions returns the centre coordinates of the alignment patterns on both axes.
+func (q *qrCode) alignmentPatternPositions() []int {
+	if q.version == 1 {
+		return nil
+	}
+	numAlign := q.version/7 + 2
+	step := (q.version*8 + numAlign*3 + 5) / (numAlign*4 - 4) * 2
+	result := make([]int, numAlign)
+	result[0] = 6
+	for i, pos := numAlign-1, q.size-7; i >= 1; i, pos = i-1, pos-step {
+		result[i] = pos
+	}
+	return result
+}
+
+// drawFormatBits draws both copies of the format information for mask.
+func (q *qrCode) drawFormatBits(mask int) {
+	data := q.level.formatBits()<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>uint(i))&1 != 0 }
+
+	for i := 0; i <= 5; i++ {
+		q.setFunctionModule(8, i, bit(i))
+	}
+	q.setFunctionModule(8, 7, bit(6))
+	q.setFunctionModule(8, 8, bit(7))
+	q.setFunctionModule(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.setFunctionModule(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		q.setFunctionModule(q.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.setFunctionModule(8, q.size-15+i, bit(i))
+	}
+	q.setFunctionModule(8, q.size-8, true) // always dark
+}
+
+// drawVersion draws both copies of the version information, only present from version 7.
+func (q *qrCode) drawVersion() {
+	if q.version < 7 {
+		return
+	}
+	rem := q.version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := q.version<<12 | rem
+	for i := 0; i < 18; i++ {
+		dark := (bits>>uint(i))&1 != 0
+		a, b := q.size-11+i%3, i/3
+		q.setFunctionModule(a, b, dark)
+		q.setFunctionModule(b, a, dark)
+	}
+}
+
+// drawCodewords places the data and error correction codewords in zigzag order.
+func (q *qrCode) drawCodewords(data []byte) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < q.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = q.size - 1 - vert
+				}
+				if !q.isFunction[y][x] && i < len(data)*8 {
+					q.modules[y][x] = (data[i>>3]>>uint(7-i&7))&1 != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask XORs the data modules with mask pattern mask.
+func (q *qrCode) applyMask(mask int) {
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !q.isFunction[y][x] {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores the symbol, lower is easier to scan.
+func (q *qrCode) penalty() int {
+	result := 0
+	line := make([]bool, q.size)
+	for horizontal := 0; horizontal < 2; horizontal++ {
+		for a := 0; a < q.size; a++ {
+			for b := 0; b < q.size; b++ {
+				if horizontal == 0 {
+					line[b] = q.modules[a][b]
+				} else {
+					line[b] = q.modules[b][a]
+				}
+			}
+			result += qrLinePenalty(line)
+		}
+	}
+
+	dark := 0
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if q.modules[y][x] {
+				dark++
+			}
+			if x+1 < q.size && y+1 < q.size {
+				c := q.modules[y][x]
+				if c == q.modules[y][x+1] && c == q.modules[y+1][x] && c == q.modules[y+1][x+1] {
+					result += 3
+				}
+			}
+		}
+	}
+
+	total := q.size * q.size
+	diff := dark*20 - total*10
+	if diff < 0 {
+		diff = -diff
+	}
+	result += ((diff+total-1)/total - 1) * 10
+	return result
+}
+
+// qrFinderLike are the 1:1:3:1:1 patterns with 4 light modules on one side that look like finder patterns.
+var qrFinderLike = [][]bool{
+	{true, false, true, true, true, false, true, false, false, false, false},
+	{false, false, false, false, true, false, true, true, true, false, true},
+}
+
+// qrLinePenalty scores runs of same coloured modules and finder-like patterns in a row or column.
+func qrLinePenalty(line []bool) int {
+	result := 0
+	run := 1
+	for i := 1; i <= len(line); i++ {
+		if i < len(line) && line[i] == line[i-1] {
+			run++
+			continue
+		}
+		if run >= 5 {
+			result += run - 2
+		}
+		run = 1
+	}
+
+	for _, pattern := range qrFinderLike {
+		for i := 0; i+len(pattern) <= len(line); i++ {
+			match := true
+			for j, dark := range pattern {
+				if line[i+j] != dark {
+					match = false
+					break
+				}
+			}
+			if match {
+				result += 40
+			}
+		}
+	}
+	return result
+}
+
+// qrQuietZone is the number of light modules around the symbol required by the specification.
+const qrQuietZone = 4
+
+// writePNG writes the symbol as a black and white PNG with scale pixels per module.
+func (q *qrCode) writePNG(w io.Writer, scale int) error {
+	if scale < 1 {
+		scale = 1
+	}
+	dim := (q.size + 2*qrQuietZone) * scale
+	img := image.NewPaletted(image.Rect(0, 0, dim, dim), color.Palette{color.White, color.Black})
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if !q.modules[y][x] {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetColorIndex((x+qrQuietZone)*scale+dx, (y+qrQuietZone)*scale+dy, 1)
+				}
+			}
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// writeSVG writes the symbol as an SVG image with scale user units per module.
+func (q *qrCode) writeSVG(w io.Writer, scale int) error {
+	if scale < 1 {
+		scale = 1
+	}
+	dim := q.size + 2*qrQuietZone
+
+	var path strings.Builder
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if q.modules[y][x] {
+				fmt.Fprintf(&path, "M%d,%dh1v1h-1z", x+qrQuietZone, y+qrQuietZone)
+			}
+		}
+	}
+
+	_, err := fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+		`<rect width="100%%" height="100%%" fill="#FFFFFF"/><path d="%s" fill="#000000"/></svg>`,
+		dim*scale, dim*scale, dim, dim, path.String())
+	return err
+}
@@ -0,0 +1,178 @@
+package dpo
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Limit restricts the requests a Client sends to DPO for an operation, see client.SetLimit.
+// Zero fields do not limit anything.
+type Limit struct {
+	Rate        float64 // Rate average number of requests per second
+	Burst       int     // Burst number of requests which may be sent at once when the rate allows, 1 by default
+	MaxInFlight int     // MaxInFlight maximum number of requests waiting for a response at the same time
+}
+
+// WaitMetrics is implemented by Metrics which also want to know how long requests waited because of a Limit.
+type WaitMetrics interface {
+	ObserveWait(ctx context.Context, op string, wait time.Duration)
+}
+
+// SetLimit limits the requests for the API3G request op, e.g. "verifyToken", so that polling for the status of
+// payments cannot starve the creation of tokens. The limit for op "" applies to every operation without a
+// limit of its own, with separate limiters for each operation.
+// Every attempt of a request counts, including retries. Requests waiting for a limit give up with an error
+// when their context is done or its deadline would pass before they are allowed through.
+// Passing the zero Limit removes the limit of op.
+func (c *Client) SetLimit(op string, limit Limit) {
+	c.limitsMu.Lock()
+	defer c.limitsMu.Unlock()
+	if c.limits == nil {
+		c.limits = make(map[string]*limiter)
+	}
+	if op == "" {
+		c.defaultLimit = limit
+		// operations using the default limit pick up the new one on their next request
+		for name, l := range c.limits {
+			if !l.own {
+				delete(c.limits, name)
+			}
+		}
+		return
+	}
+	if limit == (Limit{}) {
+		delete(c.limits, op)
+		return
+	}
+	l := newLimiter(limit)
+	l.own = true
+	c.limits[op] = l
+}
+
+// limiter returns the limiter for op or nil if op is not limited.
+func (c *Client) limiter(op string) *limiter {
+	c.limitsMu.Lock()
+	defer c.limitsMu.Unlock()
+	if l, ok := c.limits[op]; ok {
+		return l
+	}
+	if c.defaultLimit == (Limit{}) {
+		return nil
+	}
+	l := newLimiter(c.defaultLimit)
+	c.limits[op] = l
+	return l
+}
+
+// acquireLimit waits until the limit of op allows another request and returns a function which must be called
+// when the response was received.
+func (c *Client) acquireLimit(ctx context.Context, op string) (func(), error) {
+	l := c.limiter(op)
+	if l == nil {
+		return func() {}, nil
+	}
+
+	start := time.Now()
+	release, err := l.acquire(ctx)
+	if waitMetrics, ok := c.metrics.(WaitMetrics); ok {
+		waitMetrics.ObserveWait(ctx, op, time.Since(start))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("waiting for the %s request limit: %w", op, err)
+	}
+	return release, nil
+}
+
+// limiter is a token bucket combined with a semaphore.
+type limiter struct {
+	own bool // own is true for limiters set for the operation rather than created from the default limit
+
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	inFlight chan struct{} // inFlight has a slot per request in flight, nil without MaxInFlight
+}
+
+func newLimiter(limit Limit) *limiter {
+	l := &limiter{rate: limit.Rate, burst: float64(limit.Burst)}
+	if l.burst < 1 {
+		l.burst = 1
+	}
+	l.tokens = l.burst
+	if limit.MaxInFlight > 0 {
+		l.inFlight = make(chan struct{}, limit.MaxInFlight)
+	}
+	return l
+}
+
+// acquire waits for a token and a free slot.
+func (l *limiter) acquire(ctx context.Context) (func(), error) {
+	if err := l.waitToken(ctx); err != nil {
+		return nil, err
+	}
+	if l.inFlight == nil {
+		return func() {}, nil
+	}
+	select {
+	case l.inFlight <- struct{}{}:
+		return func() { <-l.inFlight }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// waitToken takes a token from the bucket, waiting for it to be refilled if it is empty.
+func (l *limiter) waitToken(ctx context.Context) error {
+	if l.rate <= 0 {
+		return ctx.Err()
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+	l.tokens--
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if delay == 0 {
+		return ctx.Err()
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(now.Add(delay)) {
+		l.cancelToken()
+		return context.DeadlineExceeded
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.cancelToken()
+		return ctx.Err()
+	}
+}
+
+// cancelToken returns a token taken by a request which gave up waiting.
+func (l *limiter) cancelToken() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens++
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+}
@@ -0,0 +1,104 @@
+package dpo_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-malawi/go-dpo"
+	"github.com/stretchr/testify/assert"
+)
+
+const verifyNotPaid = `<API3G><Result>900</Result><ResultExplanation>Transaction not paid yet</ResultExplanation></API3G>`
+
+type waitMetrics struct {
+	recordingMetrics
+	waits int64
+}
+
+func (m *waitMetrics) ObserveWait(ctx context.Context, op string, wait time.Duration) {
+	atomic.AddInt64(&m.waits, 1)
+}
+
+func TestLimitMaxInFlight(t *testing.T) {
+	assert := assert.New(t)
+
+	var inFlight, maxInFlight int64
+	client := newStubClientFunc(func(string) (int, string) {
+		n := atomic.AddInt64(&inFlight, 1)
+		defer atomic.AddInt64(&inFlight, -1)
+		for {
+			max := atomic.LoadInt64(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt64(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return http.StatusOK, verifyNotPaid
+	})
+	client.SetLimit("verifyToken", dpo.Limit{MaxInFlight: 2})
+	metrics := &waitMetrics{}
+	client.SetMetrics(metrics)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.VerifyToken(&dpo.CreateTokenResponse{TransToken: "T1"})
+			assert.Nil(err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(int64(2), maxInFlight)
+	assert.Equal(int64(6), atomic.LoadInt64(&metrics.waits))
+}
+
+func TestLimitRateRespectsDeadline(t *testing.T) {
+	assert := assert.New(t)
+
+	client := newStubClient(http.StatusOK, verifyNotPaid, nil)
+	client.SetLimit("verifyToken", dpo.Limit{Rate: 1})
+	token := &dpo.CreateTokenResponse{TransToken: "T1"}
+
+	_, err := client.VerifyToken(token)
+	assert.Nil(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = client.VerifyTokenContext(ctx, token)
+	assert.True(errors.Is(err, context.DeadlineExceeded))
+	assert.Less(int64(time.Since(start)), int64(50*time.Millisecond), "should fail without waiting")
+
+	// other operations are not limited
+	_, err = client.CancelToken("T1")
+	assert.NotNil(err) // the stub answers 900
+	assert.Equal("900", dpo.ErrorCode(err))
+}
+
+func TestLimitRateWaits(t *testing.T) {
+	assert := assert.New(t)
+
+	client := newStubClient(http.StatusOK, verifyNotPaid, nil)
+	client.SetLimit("", dpo.Limit{Rate: 20, Burst: 2})
+	token := &dpo.CreateTokenResponse{TransToken: "T1"}
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		_, err := client.VerifyToken(token)
+		assert.Nil(err)
+	}
+	// two requests are allowed at once, the other two wait 50ms each
+	assert.GreaterOrEqual(int64(time.Since(start)), int64(90*time.Millisecond))
+
+	// every operation has its own bucket
+	start = time.Now()
+	_, err := client.CancelToken("T1")
+	assert.Equal("900", dpo.ErrorCode(err))
+	assert.Less(int64(time.Since(start)), int64(40*time.Millisecond))
+}
@@ -0,0 +1,314 @@
+// Package reconcile compares the payments recorded in a dpo.Store against the transactions known to DPO
+// and reports the differences, e.g. payments DPO marked paid which the application never recorded because
+// the customer's browser never returned from the payment page.
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/golang-malawi/go-dpo"
+)
+
+// Kind classifies a discrepancy between the local store and DPO.
+type Kind string
+
+const (
+	MissingLocally  Kind = "missing_locally"  // MissingLocally DPO knows the transaction but the store does not
+	StatusMismatch  Kind = "status_mismatch"  // StatusMismatch the store and DPO disagree on the status
+	AmountMismatch  Kind = "amount_mismatch"  // AmountMismatch the store and DPO disagree on the amount
+	OrphanedPending Kind = "orphaned_pending" // OrphanedPending the payment has been pending for longer than expected
+)
+
+// Source selects where the reconciler gets the DPO side of the comparison from.
+type Source int
+
+const (
+	// SourceReport walks the transaction report for the date range. It is the only source that finds
+	// transactions missing from the store.
+	SourceReport Source = iota
+	// SourceVerify calls verifyToken for every payment in the store, for accounts without report access.
+	// The statuses are checked with client.CheckToken, so nothing is recorded by the client.
+	SourceVerify
+)
+
+// Discrepancy is a difference found between a local payment and DPO.
+type Discrepancy struct {
+	Kind       Kind
+	TransToken string
+	CompanyRef string
+	Detail     string
+
+	Local  *dpo.PaymentRecord // Local the stored payment, nil for MissingLocally
+	Remote *dpo.Transaction   // Remote what DPO reported, nil when DPO does not know the token
+
+	Repaired    bool   // Repaired is true when the Repair callback succeeded
+	RepairError string // RepairError holds the error returned by the Repair callback
+}
+
+// Report is the outcome of a reconciliation run.
+type Report struct {
+	From          time.Time
+	To            time.Time
+	Source        Source
+	Checked       int // Checked number of payments compared
+	Discrepancies []Discrepancy
+}
+
+// Count returns the number of discrepancies of kind.
+func (r *Report) Count(kind Kind) int {
+	n := 0
+	for _, d := range r.Discrepancies {
+		if d.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteText writes the report as a human readable table.
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Reconciliation %s to %s: %d checked, %d discrepancies\n",
+		r.From.Format("2006-01-02"), r.To.Format("2006-01-02"), r.Checked, len(r.Discrepancies))
+	if len(r.Discrepancies) > 0 {
+		fmt.Fprintln(tw, "KIND\tTRANS TOKEN\tCOMPANY REF\tREPAIRED\tDETAIL")
+	}
+	for _, d := range r.Discrepancies {
+		repaired := "no"
+		if d.Repaired {
+			repaired = "yes"
+		} else if d.RepairError != "" {
+			repaired = "failed: " + d.RepairError
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", d.Kind, d.TransToken, d.CompanyRef, repaired, d.Detail)
+	}
+	return tw.Flush()
+}
+
+// Reconciler compares a dpo.Store against DPO.
+// Only the Repair callback changes the store.
+type Reconciler struct {
+	client *dpo.Client
+	store  dpo.Store
+
+	// Source of the DPO data, SourceReport by default.
+	Source Source
+	// PendingTimeout is how long a payment may stay unpaid before it is reported as OrphanedPending.
+	PendingTimeout time.Duration
+	// Repair is called for each discrepancy when set, e.g. with StoreRepair to update the store from DPO.
+	Repair func(ctx context.Context, d *Discrepancy) error
+	// now returns the current time, replaced in tests.
+	now func() time.Time
+}
+
+// New creates a Reconciler using the transaction report as source and a PendingTimeout of 6 hours.
+// client may record into store as well, the reconciler only reads from DPO without recording.
+func New(client *dpo.Client, store dpo.Store) *Reconciler {
+	return &Reconciler{
+		client:         client,
+		store:          store,
+		Source:         SourceReport,
+		PendingTimeout: 6 * time.Hour,
+		now:            time.Now,
+	}
+}
+
+// Run reconciles the payments created between from and to.
+func (r *Reconciler) Run(ctx context.Context, from, to time.Time) (*Report, error) {
+	locals, err := r.store.Payments(ctx, dpo.PaymentFilter{CreatedAfter: from, CreatedBefore: to})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load local payments: %w", err)
+	}
+
+	report := &Report{From: from, To: to, Source: r.Source}
+	switch r.Source {
+	case SourceReport:
+		err = r.compareReport(ctx, report, locals)
+	case SourceVerify:
+		err = r.compareVerify(ctx, report, locals)
+	default:
+		err = fmt.Errorf("unknown source %d", r.Source)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Repair != nil {
+		for i := range report.Discrepancies {
+			if err := r.Repair(ctx, &report.Discrepancies[i]); err != nil {
+				report.Discrepancies[i].RepairError = err.Error()
+			} else {
+				report.Discrepancies[i].Repaired = true
+			}
+		}
+	}
+	return report, nil
+}
+
+// compareReport compares locals with the transaction report of the date range.
+func (r *Reconciler) compareReport(ctx context.Context, report *Report, locals []dpo.PaymentRecord) error {
+	byToken := make(map[string]*dpo.PaymentRecord, len(locals))
+	for i := range locals {
+		byToken[locals[i].TransToken] = &locals[i]
+	}
+	seen := make(map[string]bool)
+
+	it := r.client.Transactions(ctx, report.From, report.To, dpo.TransactionFilter{})
+	for it.Next() {
+		remote := it.Transaction()
+		seen[remote.TransToken] = true
+		report.Checked++
+
+		local, ok := byToken[remote.TransToken]
+		if !ok {
+			// the payment may have been created just outside the date range
+			stored, err := r.store.Payment(ctx, remote.TransToken)
+			if err != nil && !errors.Is(err, dpo.ErrPaymentNotFound) {
+				return err
+			}
+			local = stored
+		}
+		if local == nil {
+			report.Discrepancies = append(report.Discrepancies, Discrepancy{
+				Kind:       MissingLocally,
+				TransToken: remote.TransToken,
+				CompanyRef: remote.CompanyRef,
+				Detail:     fmt.Sprintf("DPO reports status %s (%s)", remote.Result, remote.ResultExplanation),
+				Remote:     &remote,
+			})
+			continue
+		}
+		r.compare(report, local, &remote)
+	}
+	if err := it.Err(); err != nil {
+		return fmt.Errorf("failed to read transaction report: %w", err)
+	}
+
+	for i := range locals {
+		if !seen[locals[i].TransToken] {
+			report.Checked++
+			r.checkOrphaned(report, &locals[i], nil)
+		}
+	}
+	return nil
+}
+
+// compareVerify compares each local payment with the result of verifyToken.
+func (r *Reconciler) compareVerify(ctx context.Context, report *Report, locals []dpo.PaymentRecord) error {
+	for i := range locals {
+		local := &locals[i]
+		verifyResponse, err := r.client.CheckToken(ctx, local.TransToken)
+		if err != nil {
+			return fmt.Errorf("failed to verify %s: %w", local.TransToken, err)
+		}
+		report.Checked++
+
+		remote := &dpo.Transaction{
+			TransToken:         local.TransToken,
+			CompanyRef:         local.CompanyRef,
+			Result:             verifyResponse.Result,
+			ResultExplanation:  verifyResponse.ResultExplanation,
+			TransactionDetails: verifyResponse.TransactionDetails,
+		}
+		r.compare(report, local, remote)
+	}
+	return nil
+}
+
+// compare records the discrepancies between a local payment and what DPO reports for it.
+func (r *Reconciler) compare(report *Report, local *dpo.PaymentRecord, remote *dpo.Transaction) {
+	if local.Status != remote.Result {
+		report.Discrepancies = append(report.Discrepancies, Discrepancy{
+			Kind:       StatusMismatch,
+			TransToken: local.TransToken,
+			CompanyRef: local.CompanyRef,
+			Detail:     fmt.Sprintf("local status %s, DPO status %s (%s)", local.Status, remote.Result, remote.ResultExplanation),
+			Local:      local,
+			Remote:     remote,
+		})
+	}
+
+	if remote.TransactionAmount != "" {
+		amount, err := dpo.ParseMoney(remote.TransactionAmount, remote.TransactionCurrency)
+		cmp := 0
+		if err == nil {
+			cmp, err = amount.Cmp(local.Amount)
+		}
+		if err != nil || cmp != 0 {
+			report.Discrepancies = append(report.Discrepancies, Discrepancy{
+				Kind:       AmountMismatch,
+				TransToken: local.TransToken,
+				CompanyRef: local.CompanyRef,
+				Detail:     fmt.Sprintf("local amount %s, DPO amount %s %s", local.Amount, remote.TransactionAmount, remote.TransactionCurrency),
+				Local:      local,
+				Remote:     remote,
+			})
+		}
+	}
+
+	r.checkOrphaned(report, local, remote)
+}
+
+// checkOrphaned reports payments that are still unpaid long after they were created.
+func (r *Reconciler) checkOrphaned(report *Report, local *dpo.PaymentRecord, remote *dpo.Transaction) {
+	if local.IsSettled() || r.now().Sub(local.CreatedAt) < r.PendingTimeout {
+		return
+	}
+	if remote != nil && remote.Result != local.Status {
+		// already reported as a status mismatch
+		return
+	}
+	detail := fmt.Sprintf("pending since %s", local.CreatedAt.Format(time.RFC3339))
+	if remote == nil {
+		detail += ", unknown to DPO"
+	}
+	report.Discrepancies = append(report.Discrepancies, Discrepancy{
+		Kind:       OrphanedPending,
+		TransToken: local.TransToken,
+		CompanyRef: local.CompanyRef,
+		Detail:     detail,
+		Local:      local,
+		Remote:     remote,
+	})
+}
+
+// StoreRepair returns a Repair callback that brings store in line with DPO: transactions missing locally
+// are created and mismatched statuses are updated. Amount mismatches and orphaned payments need a human
+// decision and are left alone, the callback returns an error for them so they show up as not repaired.
+func StoreRepair(store dpo.Store) func(ctx context.Context, d *Discrepancy) error {
+	return func(ctx context.Context, d *Discrepancy) error {
+		now := time.Now()
+		switch d.Kind {
+		case MissingLocally:
+			amount, err := dpo.ParseMoney(d.Remote.TransactionAmount, d.Remote.TransactionCurrency)
+			if err != nil {
+				return err
+			}
+			change := dpo.StatusChange{Status: d.Remote.Result, Explanation: d.Remote.ResultExplanation, At: now}
+			return store.CreatePayment(ctx, &dpo.PaymentRecord{
+				CompanyRef:        d.Remote.CompanyRef,
+				TransToken:        d.Remote.TransToken,
+				TransRef:          d.Remote.TransRef,
+				Amount:            amount,
+				Status:            change.Status,
+				StatusExplanation: change.Explanation,
+				History:           []dpo.StatusChange{change},
+				CreatedAt:         now,
+				UpdatedAt:         now,
+			})
+		case StatusMismatch:
+			return store.UpdateStatus(ctx, d.TransToken, dpo.StatusChange{
+				Status:      d.Remote.Result,
+				Explanation: d.Remote.ResultExplanation,
+				At:          now,
+			})
+		default:
+			return fmt.Errorf("%s needs manual review", d.Kind)
+		}
+	}
+}
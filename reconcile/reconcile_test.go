@@ -0,0 +1,164 @@
+package reconcile_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-malawi/go-dpo"
+	"github.com/golang-malawi/go-dpo/reconcile"
+	"github.com/stretchr/testify/assert"
+)
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func newStubClient(respond func(requestBody string) string) *dpo.Client {
+	client := dpo.NewClient("TOKEN", false)
+	client.SetHTTPClient(&http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			data, _ := io.ReadAll(req.Body)
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(respond(string(data)))),
+				Header:     make(http.Header),
+			}, nil
+		}),
+	})
+	return client
+}
+
+func newTestStore(t *testing.T, created time.Time) dpo.Store {
+	store := dpo.NewMemoryStore()
+	records := []dpo.PaymentRecord{
+		{CompanyRef: "R1", TransToken: "T1", Amount: dpo.Money{Cents: 100, Currency: "USD"}, Status: dpo.StatusNotPaid},
+		{CompanyRef: "R2", TransToken: "T2", Amount: dpo.Money{Cents: 100, Currency: "USD"}, Status: dpo.StatusPaid},
+		{CompanyRef: "R4", TransToken: "T4", Amount: dpo.Money{Cents: 400, Currency: "USD"}, Status: dpo.StatusNotPaid},
+	}
+	for i := range records {
+		records[i].CreatedAt = created
+		records[i].UpdatedAt = created
+		if err := store.CreatePayment(context.Background(), &records[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+const reportResponse = `<API3G><Result>000</Result><TotalPages>1</TotalPages><Transactions>
+<Transaction><TransactionToken>T1</TransactionToken><CompanyRef>R1</CompanyRef><Result>000</Result><TransactionAmount>1.00</TransactionAmount><TransactionCurrency>USD</TransactionCurrency></Transaction>
+<Transaction><TransactionToken>T2</TransactionToken><CompanyRef>R2</CompanyRef><Result>000</Result><TransactionAmount>2.00</TransactionAmount><TransactionCurrency>USD</TransactionCurrency></Transaction>
+<Transaction><TransactionToken>T3</TransactionToken><CompanyRef>R3</CompanyRef><Result>000</Result><TransactionAmount>3.00</TransactionAmount><TransactionCurrency>USD</TransactionCurrency></Transaction>
+</Transactions></API3G>`
+
+func TestRunReport(t *testing.T) {
+	assert := assert.New(t)
+
+	created := time.Now().Add(-24 * time.Hour)
+	store := newTestStore(t, created)
+	client := newStubClient(func(string) string { return reportResponse })
+
+	r := reconcile.New(client, store)
+	report, err := r.Run(context.Background(), created.Add(-time.Hour), created.Add(time.Hour))
+	assert.Nil(err)
+	assert.Equal(4, report.Checked)
+	assert.Equal(1, report.Count(reconcile.StatusMismatch))
+	assert.Equal(1, report.Count(reconcile.AmountMismatch))
+	assert.Equal(1, report.Count(reconcile.MissingLocally))
+	assert.Equal(1, report.Count(reconcile.OrphanedPending))
+
+	var buf bytes.Buffer
+	assert.Nil(report.WriteText(&buf))
+	assert.Contains(buf.String(), "missing_locally")
+}
+
+func TestRunVerify(t *testing.T) {
+	assert := assert.New(t)
+
+	created := time.Now().Add(-time.Hour)
+	store := newTestStore(t, created)
+	client := newStubClient(func(requestBody string) string {
+		if strings.Contains(requestBody, "<TransactionToken>T1</TransactionToken>") {
+			return `<API3G><Result>000</Result><ResultExplanation>Paid</ResultExplanation><TransactionAmount>1.00</TransactionAmount><TransactionCurrency>USD</TransactionCurrency></API3G>`
+		}
+		return `<API3G><Result>900</Result><ResultExplanation>Not paid</ResultExplanation></API3G>`
+	})
+
+	r := reconcile.New(client, store)
+	r.Source = reconcile.SourceVerify
+	report, err := r.Run(context.Background(), created.Add(-time.Hour), created.Add(time.Hour))
+	assert.Nil(err)
+	assert.Equal(3, report.Checked)
+	assert.Equal(2, report.Count(reconcile.StatusMismatch))
+	assert.Equal(0, report.Count(reconcile.OrphanedPending))
+}
+
+func TestStoreRepair(t *testing.T) {
+	assert := assert.New(t)
+
+	created := time.Now().Add(-24 * time.Hour)
+	store := newTestStore(t, created)
+	client := newStubClient(func(string) string { return reportResponse })
+
+	r := reconcile.New(client, store)
+	r.Repair = reconcile.StoreRepair(store)
+	report, err := r.Run(context.Background(), created.Add(-time.Hour), created.Add(time.Hour))
+	assert.Nil(err)
+
+	for _, d := range report.Discrepancies {
+		switch d.Kind {
+		case reconcile.MissingLocally, reconcile.StatusMismatch:
+			assert.True(d.Repaired, d.Kind)
+		default:
+			assert.False(d.Repaired, d.Kind)
+			assert.NotEmpty(d.RepairError)
+		}
+	}
+
+	payment, err := store.Payment(context.Background(), "T3")
+	assert.Nil(err)
+	assert.Equal(int64(300), payment.Amount.Cents)
+
+	payment, err = store.Payment(context.Background(), "T1")
+	assert.Nil(err)
+	assert.Equal(dpo.StatusPaid, payment.Status)
+}
+
+func TestRunWithoutRepairKeepsStore(t *testing.T) {
+	assert := assert.New(t)
+
+	created := time.Now().Add(-time.Hour)
+	store := newTestStore(t, created)
+	client := newStubClient(func(requestBody string) string {
+		return `<API3G><Result>000</Result><ResultExplanation>Paid</ResultExplanation><TransactionAmount>1.00</TransactionAmount><TransactionCurrency>USD</TransactionCurrency></API3G>`
+	})
+	// the client records into the same store and publishes events
+	client.SetStore(store)
+	var published []dpo.Event
+	events := dpo.NewEvents(nil)
+	events.Subscribe(func(ctx context.Context, event dpo.Event) error {
+		published = append(published, event)
+		return nil
+	})
+	client.SetEvents(events)
+	before, err := store.Payments(context.Background(), dpo.PaymentFilter{})
+	assert.Nil(err)
+
+	r := reconcile.New(client, store)
+	r.Source = reconcile.SourceVerify
+	report, err := r.Run(context.Background(), created.Add(-time.Hour), created.Add(time.Hour))
+	assert.Nil(err)
+	assert.NotEmpty(report.Discrepancies)
+
+	after, err := store.Payments(context.Background(), dpo.PaymentFilter{})
+	assert.Nil(err)
+	assert.Equal(before, after)
+	assert.Empty(published)
+}
@@ -0,0 +1,101 @@
+package dpo
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// PaymentRedirect holds the query parameters DPO appends to the RedirectURL when the browser returns from the payment page
+// or from a 3-D Secure challenge.
+type PaymentRedirect struct {
+	TransID     string `json:"trans_id"`     // TransID DPO transaction reference
+	CCDApproval string `json:"ccd_approval"` // CCDApproval approval code of the card payment
+	PnrID       string `json:"pnr_id"`
+	TransToken  string `json:"trans_token"` // TransToken the TransactionToken of the payment
+	CompanyRef  string `json:"company_ref"` // CompanyRef the reference passed when creating the token
+}
+
+// ParsePaymentRedirect reads the DPO redirect parameters from the query of r.
+// The parameters are not trusted, verify the payment with client.VerifyRedirect or client.VerifyToken.
+func ParsePaymentRedirect(r *http.Request) (*PaymentRedirect, error) {
+	query := r.URL.Query()
+	redirect := &PaymentRedirect{
+		TransID:     query.Get("TransID"),
+		CCDApproval: query.Get("CCDapproval"),
+		PnrID:       query.Get("PnrID"),
+		TransToken:  query.Get("TransactionToken"),
+		CompanyRef:  query.Get("CompanyRef"),
+	}
+	if redirect.TransToken == "" {
+		return nil, fmt.Errorf("redirect is missing the TransactionToken parameter")
+	}
+	return redirect, nil
+}
+
+// VerifyRedirect parses the DPO redirect parameters of r and verifies the payment they refer to.
+// The VerifyTokenResponse is returned as is, check its Result to see whether the payment succeeded.
+func (c *Client) VerifyRedirect(ctx context.Context, r *http.Request) (*PaymentRedirect, *VerifyTokenResponse, error) {
+	redirect, err := ParsePaymentRedirect(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	verifyResponse, err := c.verifyToken(ctx, redirect.TransToken)
+	if err != nil {
+		return redirect, nil, err
+	}
+	return redirect, verifyResponse, nil
+}
+
+// maxPushNotificationSize limits the body read from a push notification.
+const maxPushNotificationSize = 1 << 20
+
+// PushNotification is the XML message DPO posts to the notification URL configured for the company when the status of a
+// transaction changes. Like redirects, notifications are not authenticated and must be confirmed with client.VerifyToken.
+type PushNotification struct {
+	XMLName xml.Name `xml:"API3G" json:"-"`
+
+	Result            string `xml:"Result" json:"result"`
+	ResultExplanation string `xml:"ResultExplanation" json:"result_explanation"`
+	TransToken        string `xml:"TransactionToken" json:"trans_token"`
+	TransRef          string `xml:"TransactionRef" json:"trans_ref"`
+	CompanyRef        string `xml:"CompanyRef" json:"company_ref"`
+	TransactionDetails
+}
+
+// ParsePushNotification reads a DPO push notification from the body of r.
+func ParsePushNotification(r *http.Request) (*PushNotification, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPushNotificationSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notification: %v", err)
+	}
+
+	var notification PushNotification
+	if err := xml.Unmarshal(body, &notification); err != nil {
+		return nil, fmt.Errorf("failed unmarshal notification: %v", err)
+	}
+	if notification.TransToken == "" {
+		return nil, fmt.Errorf("notification is missing the TransactionToken")
+	}
+	return &notification, nil
+}
+
+// pushAcknowledgement is the reply DPO expects to a push notification.
+type pushAcknowledgement struct {
+	XMLName  xml.Name `xml:"API3G"`
+	Response string   `xml:"Response"`
+}
+
+// WritePushAcknowledgement answers a push notification so that DPO stops resending it.
+func WritePushAcknowledgement(w http.ResponseWriter) error {
+	data, err := xmlMarshalWithHeader(&pushAcknowledgement{Response: "OK"})
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	_, err = w.Write(data)
+	return err
+}
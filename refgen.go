@@ -0,0 +1,246 @@
+package dpo
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// MaxCompanyRefLength is the longest CompanyRef accepted by DPO.
+const MaxCompanyRefLength = 50
+
+// crockfordAlphabet is Crockford's base32 alphabet, which leaves out I, L, O and U to avoid misreading.
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// RefGenerator generates the CompanyRef of new tokens.
+type RefGenerator interface {
+	NewRef() (string, error)
+}
+
+// RefGeneratorFunc adapts a function to a RefGenerator.
+type RefGeneratorFunc func() (string, error)
+
+// NewRef implements RefGenerator.
+func (f RefGeneratorFunc) NewRef() (string, error) {
+	return f()
+}
+
+// ValidateCompanyRef checks that ref is non-empty, at most MaxCompanyRefLength long and only made of
+// letters, digits, '-' and '_', which keeps it readable on statements and in DPO's back office.
+func ValidateCompanyRef(ref string) error {
+	if len(ref) > MaxCompanyRefLength {
+		return fmt.Errorf("company ref %q is longer than %d characters", ref, MaxCompanyRefLength)
+	}
+	if !isRefSafe(ref) {
+		return fmt.Errorf("company ref %q must only contain letters, digits, '-' and '_'", ref)
+	}
+	return nil
+}
+
+// isRefSafe reports whether s is non-empty and only contains characters that are safe in a CompanyRef.
+func isRefSafe(s string) bool {
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return s != ""
+}
+
+// randomReader returns r, or crypto/rand when r is nil.
+func randomReader(r io.Reader) io.Reader {
+	if r == nil {
+		return rand.Reader
+	}
+	return r
+}
+
+// ULIDGenerator generates 26 character, time sortable references in the ULID format:
+// 48 bits of milliseconds since the epoch followed by 80 random bits, in Crockford base32.
+// It is the default generator of the Client.
+type ULIDGenerator struct {
+	Prefix string           // Prefix added in front of every reference
+	Now    func() time.Time // Now returns the current time, time.Now when nil
+	Rand   io.Reader        // Rand source of randomness, crypto/rand when nil
+}
+
+// NewRef implements RefGenerator.
+func (g ULIDGenerator) NewRef() (string, error) {
+	now := time.Now
+	if g.Now != nil {
+		now = g.Now
+	}
+	ms := uint64(now().UnixNano() / int64(time.Millisecond))
+
+	var b [16]byte
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+	if _, err := io.ReadFull(randomReader(g.Rand), b[6:]); err != nil {
+		return "", fmt.Errorf("failed to generate company ref: %w", err)
+	}
+
+	// 128 bits as 26 base32 characters, the first character only carries 3 bits
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		bit := 128 - 5*(26-i) // offset of the lowest bit of character i, counted from the most significant bit
+		var v int
+		for j := 0; j < 5; j++ {
+			pos := bit + j
+			if pos < 0 {
+				continue
+			}
+			if b[pos/8]&(0x80>>(pos%8)) != 0 {
+				v |= 1 << (4 - j)
+			}
+		}
+		out[i] = crockfordAlphabet[v]
+	}
+
+	ref := g.Prefix + string(out[:])
+	return ref, ValidateCompanyRef(ref)
+}
+
+// RefCounter hands out increasing numbers for SequentialRefGenerator.
+// Implementations backed by a database let several processes share a sequence.
+type RefCounter interface {
+	Next() (uint64, error)
+}
+
+// MemoryRefCounter is a RefCounter kept in memory, starting after the value it is initialised with.
+type MemoryRefCounter struct {
+	value uint64
+}
+
+// NewMemoryRefCounter creates a counter whose first number is start+1.
+func NewMemoryRefCounter(start uint64) *MemoryRefCounter {
+	return &MemoryRefCounter{value: start}
+}
+
+// Next implements RefCounter.
+func (c *MemoryRefCounter) Next() (uint64, error) {
+	return atomic.AddUint64(&c.value, 1), nil
+}
+
+// SequentialRefGenerator generates references made of a prefix and a zero padded number, such as "INV-00000042".
+type SequentialRefGenerator struct {
+	Prefix  string
+	Width   int // Width minimum number of digits, 8 when zero
+	Counter RefCounter
+}
+
+// NewRef implements RefGenerator.
+func (g SequentialRefGenerator) NewRef() (string, error) {
+	if g.Counter == nil {
+		return "", fmt.Errorf("sequential ref generator has no counter")
+	}
+	n, err := g.Counter.Next()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate company ref: %w", err)
+	}
+	width := g.Width
+	if width <= 0 {
+		width = 8
+	}
+	digits := strconv.FormatUint(n, 10)
+	if len(digits) < width {
+		digits = strings.Repeat("0", width-len(digits)) + digits
+	}
+	ref := g.Prefix + digits
+	return ref, ValidateCompanyRef(ref)
+}
+
+// ShortCodeGenerator generates short random references that are easy to read out over the phone, such as
+// "7KQ3XM2P9". The code uses Crockford's base32 alphabet and ends with a Luhn mod 32 check character, so
+// typos can be caught with Valid before looking a payment up.
+type ShortCodeGenerator struct {
+	Prefix string
+	Length int       // Length number of random characters before the check character, 8 when zero
+	Rand   io.Reader // Rand source of randomness, crypto/rand when nil
+}
+
+// NewRef implements RefGenerator.
+func (g ShortCodeGenerator) NewRef() (string, error) {
+	length := g.Length
+	if length <= 0 {
+		length = 8
+	}
+	b := make([]byte, length)
+	if _, err := io.ReadFull(randomReader(g.Rand), b); err != nil {
+		return "", fmt.Errorf("failed to generate company ref: %w", err)
+	}
+	code := make([]byte, length, length+1)
+	for i := range b {
+		code[i] = crockfordAlphabet[b[i]%32]
+	}
+	code = append(code, crockfordAlphabet[luhnMod32CheckValue(code)])
+
+	ref := g.Prefix + string(code)
+	return ref, ValidateCompanyRef(ref)
+}
+
+// Valid reports whether ref was generated with the prefix of g and has a correct check character.
+// Lower case letters are accepted.
+func (g ShortCodeGenerator) Valid(ref string) bool {
+	if len(ref) < len(g.Prefix) || !strings.EqualFold(ref[:len(g.Prefix)], g.Prefix) {
+		return false
+	}
+	code := strings.ToUpper(ref[len(g.Prefix):])
+	if len(code) < 2 {
+		return false
+	}
+	for i := 0; i < len(code); i++ {
+		if strings.IndexByte(crockfordAlphabet, code[i]) < 0 {
+			return false
+		}
+	}
+	return luhnMod32CheckValue([]byte(code[:len(code)-1])) == strings.IndexByte(crockfordAlphabet, code[len(code)-1])
+}
+
+// luhnMod32CheckValue returns the index of the Luhn mod N check character for code, which must only contain
+// characters of crockfordAlphabet.
+func luhnMod32CheckValue(code []byte) int {
+	const n = len(crockfordAlphabet)
+	factor := 2
+	sum := 0
+	for i := len(code) - 1; i >= 0; i-- {
+		addend := factor * strings.IndexByte(crockfordAlphabet, code[i])
+		factor = 3 - factor
+		sum += addend/n + addend%n
+	}
+	return (n - sum%n) % n
+}
+
+// UUIDRefGenerator generates random version 4 UUIDs, 36 characters long.
+type UUIDRefGenerator struct {
+	Rand io.Reader // Rand source of randomness, crypto/rand when nil
+}
+
+// NewRef implements RefGenerator.
+func (g UUIDRefGenerator) NewRef() (string, error) {
+	var b [16]byte
+	if _, err := io.ReadFull(randomReader(g.Rand), b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate company ref: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+
+	h := hex.EncodeToString(b[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], nil
+}
+
+// newCompanyRef generates a CompanyRef with c.GenerateRef.
+func (c *Client) newCompanyRef() (string, error) {
+	if c.GenerateRef == nil {
+		return ULIDGenerator{}.NewRef()
+	}
+	return c.GenerateRef.NewRef()
+}
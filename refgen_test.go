@@ -0,0 +1,101 @@
+package dpo_test
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/golang-malawi/go-dpo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestULIDGenerator(t *testing.T) {
+	assert := assert.New(t)
+
+	// timestamp from the ULID specification
+	now := time.Unix(0, 1469918176385*int64(time.Millisecond))
+	g := dpo.ULIDGenerator{Now: func() time.Time { return now }, Rand: bytes.NewReader(make([]byte, 10))}
+	ref, err := g.NewRef()
+	assert.Nil(err)
+	assert.Equal("01ARYZ6S410000000000000000", ref)
+
+	first, err := dpo.ULIDGenerator{}.NewRef()
+	assert.Nil(err)
+	time.Sleep(2 * time.Millisecond)
+	second, err := dpo.ULIDGenerator{}.NewRef()
+	assert.Nil(err)
+	assert.Len(first, 26)
+	assert.True(first < second)
+}
+
+func TestSequentialRefGenerator(t *testing.T) {
+	assert := assert.New(t)
+
+	g := dpo.SequentialRefGenerator{Prefix: "INV-", Counter: dpo.NewMemoryRefCounter(41)}
+	ref, err := g.NewRef()
+	assert.Nil(err)
+	assert.Equal("INV-00000042", ref)
+
+	g.Prefix = "INV/"
+	_, err = g.NewRef()
+	assert.NotNil(err)
+
+	_, err = dpo.SequentialRefGenerator{}.NewRef()
+	assert.NotNil(err)
+}
+
+func TestShortCodeGenerator(t *testing.T) {
+	assert := assert.New(t)
+
+	g := dpo.ShortCodeGenerator{Prefix: "PAY-"}
+	for i := 0; i < 20; i++ {
+		ref, err := g.NewRef()
+		assert.Nil(err)
+		assert.Len(ref, 13)
+		assert.True(g.Valid(ref), ref)
+		assert.True(g.Valid(strings.ToLower(ref)), ref)
+
+		// changing a single character must be detected
+		code := []byte(ref)
+		if code[6] == '0' {
+			code[6] = '1'
+		} else {
+			code[6] = '0'
+		}
+		assert.False(g.Valid(string(code)), string(code))
+	}
+	assert.False(g.Valid("OTHER-1234"))
+}
+
+func TestUUIDRefGenerator(t *testing.T) {
+	assert := assert.New(t)
+
+	ref, err := dpo.UUIDRefGenerator{}.NewRef()
+	assert.Nil(err)
+	assert.Regexp(regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), ref)
+	assert.Nil(dpo.ValidateCompanyRef(ref))
+}
+
+func TestRefGeneratorRandomFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	failing := iotest.ErrReader(errors.New("no entropy"))
+	_, err := dpo.ULIDGenerator{Rand: failing}.NewRef()
+	assert.NotNil(err)
+	_, err = dpo.ShortCodeGenerator{Rand: failing}.NewRef()
+	assert.NotNil(err)
+	_, err = dpo.UUIDRefGenerator{Rand: failing}.NewRef()
+	assert.NotNil(err)
+
+	client := newStubClient(200, `<API3G><Result>000</Result><TransToken>T1</TransToken></API3G>`, nil)
+	client.GenerateRef = dpo.ULIDGenerator{Rand: failing}
+	request := client.NewCreateTokenRequest(client.Token, "USD", big.NewFloat(1))
+	assert.Equal("", request.Transaction.CompanyRef)
+	_, err = client.CreateToken(request)
+	assert.NotNil(err)
+}
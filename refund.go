@@ -0,0 +1,359 @@
+package dpo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	opRefundToken = "refundToken"
+
+	// refundRoundingTolerance is the largest difference between a RefundToken amount and its two decimal form
+	// which is treated as the representation error of a float, a thousandth of a cent.
+	refundRoundingTolerance = 0.00001
+)
+
+// ErrRefundExceedsCaptured is returned when a refund would take the total refunded on a token above the captured amount.
+var ErrRefundExceedsCaptured = errors.New("dpo: refund exceeds captured amount")
+
+// RefundStatus is the outcome of a refund request.
+type RefundStatus string
+
+const (
+	RefundCompleted       RefundStatus = "completed"        // RefundCompleted DPO accepted and processed the refund
+	RefundPendingApproval RefundStatus = "pending_approval" // RefundPendingApproval the refund waits for a checker to approve it in DPO
+	RefundUnknown         RefundStatus = "unknown"          // RefundUnknown the request failed after it may have reached DPO
+)
+
+// Refund describes a full or partial refund of a paid transaction.
+type Refund struct {
+	TransToken  string // TransToken the token of the paid transaction
+	Amount      Money  // Amount to refund, the currency defaults to the currency of the transaction
+	Description string // Description reason for the refund, mandatory
+	Ref         string // Ref optional reference of the refund in your system
+
+	// RequiresApproval submits the refund for maker/checker approval in DPO instead of processing it immediately.
+	RequiresApproval bool
+}
+
+// RefundResult is the outcome of a refund.
+type RefundResult struct {
+	TransToken  string
+	Ref         string
+	Amount      Money        // Amount refunded by this request
+	Captured    Money        // Captured amount of the transaction as reported by verifyToken
+	Refunded    Money        // Refunded total refunded on the token including this refund, only complete with a RefundLedger
+	Status      RefundStatus // Status whether the refund completed, waits for approval or has an unknown outcome
+	Explanation string       // Explanation as returned by DPO
+	LedgerID    string       // LedgerID the ID of the refund in the RefundLedger, empty without a ledger
+
+	Response *RefundTokenResponse
+}
+
+// RefundEntry is a refund tracked by a RefundLedger.
+type RefundEntry struct {
+	ID         string // ID assigned by the ledger when the refund is reserved
+	TransToken string
+	Ref        string
+	Amount     Money
+	Completed  bool // Completed is false while the refund is in flight or waits for approval
+	CreatedAt  time.Time
+}
+
+// RefundLedger keeps track of the refunds made per token so that several partial refunds never exceed the captured amount.
+// Implementations must make Reserve atomic per token so that concurrent refunds cannot both pass the check.
+type RefundLedger interface {
+	// Reserve records entry as in flight if the amounts of all completed and in flight refunds for entry.TransToken
+	// plus entry.Amount do not exceed captured, otherwise it returns ErrRefundExceedsCaptured.
+	// The returned entry has its ID set.
+	Reserve(ctx context.Context, entry RefundEntry, captured Money) (RefundEntry, error)
+	// Complete marks a reserved refund as completed.
+	Complete(ctx context.Context, id string) error
+	// Release removes a reserved refund that DPO did not accept.
+	Release(ctx context.Context, id string) error
+	// Entries returns the completed and in flight refunds for transToken.
+	Entries(ctx context.Context, transToken string) ([]RefundEntry, error)
+}
+
+// SetRefundLedger makes client.Refund track refunds in ledger.
+// Without a ledger only single refunds are checked against the captured amount.
+func (c *Client) SetRefundLedger(ledger RefundLedger) {
+	c.refundLedger = ledger
+}
+
+// Refund refunds all or part of a paid transaction.
+// The transaction is verified first and the refund is rejected locally if the transaction is not paid,
+// or if the refund would exceed the captured amount. With a RefundLedger set, earlier refunds on the same
+// token count towards the captured amount too.
+//
+// A refund with RequiresApproval stays reserved in the ledger until client.ResolveRefund is called with the decision.
+// When DPO accepted the refund but the ledger could not be updated, the result is returned together with the error.
+// When the request failed after it may have reached DPO, a result with Status RefundUnknown is returned together
+// with the error. Its amount stays reserved until client.ResolveRefund is called once the outcome was checked in DPO.
+func (c *Client) Refund(ctx context.Context, refund Refund) (*RefundResult, error) {
+	if refund.TransToken == "" {
+		return nil, fmt.Errorf("refund token must not be empty")
+	}
+	if refund.Description == "" {
+		return nil, fmt.Errorf("refund description must not be empty")
+	}
+	if refund.Amount.Cents <= 0 {
+		return nil, fmt.Errorf("refund amount must be greater than zero")
+	}
+
+	verifyResponse, err := c.verifyToken(ctx, refund.TransToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify token: %w", err)
+	}
+	if verifyResponse.Result != StatusPaid {
+		return nil, &Error{Op: "verifyToken", Code: verifyResponse.Result, Explanation: verifyResponse.ResultExplanation}
+	}
+	captured, err := ParseMoney(verifyResponse.TransactionAmount, verifyResponse.TransactionCurrency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read captured amount: %v", err)
+	}
+
+	amount := refund.Amount
+	if amount.Currency == "" {
+		amount.Currency = captured.Currency
+	}
+	cmp, err := amount.Cmp(captured)
+	if err != nil {
+		return nil, err
+	}
+	if cmp > 0 {
+		return nil, fmt.Errorf("%w: %s refund on %s captured", ErrRefundExceedsCaptured, amount, captured)
+	}
+
+	refunded := amount
+	var entry RefundEntry
+	if c.refundLedger != nil {
+		entry, err = c.refundLedger.Reserve(ctx, RefundEntry{
+			TransToken: refund.TransToken,
+			Ref:        refund.Ref,
+			Amount:     amount,
+			CreatedAt:  time.Now(),
+		}, captured)
+		if err != nil {
+			return nil, err
+		}
+
+		entries, err := c.refundLedger.Entries(ctx, refund.TransToken)
+		if err != nil {
+			c.releaseRefund(ctx, entry.ID)
+			return nil, err
+		}
+		refunded = Money{Currency: captured.Currency}
+		for _, e := range entries {
+			refunded.Cents += e.Amount.Cents
+		}
+	}
+
+	refundRequest := &RefundTokenRequest{
+		CompanyToken:  c.Token,
+		Request:       opRefundToken,
+		Token:         refund.TransToken,
+		RefundAmount:  amount.Decimal(),
+		RefundDetails: refund.Description,
+		RefundRef:     refund.Ref,
+	}
+	if refund.RequiresApproval {
+		refundRequest.RefundApproval = 1
+	}
+
+	c.publish(ctx, Event{
+		ID:         refundEventID(EventRefundRequested, refund.TransToken, refund.Ref),
+		Type:       EventRefundRequested,
+		TransToken: refund.TransToken,
+		Amount:     amount,
+		RefundRef:  refund.Ref,
+	})
+
+	result := &RefundResult{
+		TransToken: refund.TransToken,
+		Ref:        refund.Ref,
+		Amount:     amount,
+		Captured:   captured,
+		Refunded:   refunded,
+		Status:     RefundCompleted,
+		LedgerID:   entry.ID,
+	}
+
+	var refundTokenResponse RefundTokenResponse
+	if err := c.post(ctx, opRefundToken, refundRequest, &refundTokenResponse); err != nil {
+		if requestNotSent(err) {
+			c.releaseRefund(ctx, entry.ID)
+			return nil, err
+		}
+		// the outcome is unknown, keep the reservation so the amount cannot be refunded twice
+		result.Status = RefundUnknown
+		return result, err
+	}
+	if refundTokenResponse.IsError() {
+		c.releaseRefund(ctx, entry.ID)
+		return nil, &Error{Op: opRefundToken, Code: refundTokenResponse.Result, Explanation: refundTokenResponse.ResultExplanation}
+	}
+	result.Explanation = refundTokenResponse.ResultExplanation
+	result.Response = &refundTokenResponse
+	if refund.RequiresApproval {
+		// the refund stays reserved until client.ResolveRefund records the decision of the checker
+		result.Status = RefundPendingApproval
+		return result, nil
+	}
+
+	if c.refundLedger != nil {
+		if err := c.refundLedger.Complete(ctx, entry.ID); err != nil {
+			return result, fmt.Errorf("refund succeeded but ledger update failed: %w", err)
+		}
+	}
+	c.publish(ctx, Event{
+		ID:          refundEventID(EventRefundCompleted, refund.TransToken, refund.Ref),
+		Type:        EventRefundCompleted,
+		TransToken:  refund.TransToken,
+		Amount:      amount,
+		Status:      refundTokenResponse.Result,
+		Explanation: refundTokenResponse.ResultExplanation,
+		RefundRef:   refund.Ref,
+	})
+	return result, nil
+}
+
+// ResolveRefund records the decision on a refund submitted with RequiresApproval, or the outcome of a refund with
+// Status RefundUnknown, id is the LedgerID of its RefundResult.
+// An approved refund is marked as completed, a rejected one is released so that its amount can be refunded again.
+func (c *Client) ResolveRefund(ctx context.Context, id string, approved bool) error {
+	if c.refundLedger == nil {
+		return fmt.Errorf("no refund ledger set")
+	}
+	if approved {
+		return c.refundLedger.Complete(ctx, id)
+	}
+	return c.refundLedger.Release(ctx, id)
+}
+
+// releaseRefund releases a ledger reservation, id is empty when no ledger is used.
+func (c *Client) releaseRefund(ctx context.Context, id string) {
+	if c.refundLedger == nil || id == "" {
+		return
+	}
+	_ = c.refundLedger.Release(ctx, id)
+}
+
+// RefundToken initiates a refund of refundAmount in the currency of the transaction.
+// It is a shorthand for client.Refund, see there for the validation performed.
+// Amounts with more than two decimal places are rejected rather than rounded.
+func (c *Client) RefundToken(tokenStr string, refundAmount *big.Float, refundRef, description string, requiresApproval bool) (*RefundTokenResponse, error) {
+	if refundAmount == nil {
+		return nil, fmt.Errorf("refund amount must not be nil")
+	}
+	amount, err := NewMoney(refundAmount, "")
+	if err != nil {
+		return nil, err
+	}
+	// a float64 such as 10.1 is not exact, only differences beyond its representation error are extra decimals
+	diff := new(big.Float).Sub(refundAmount, amount.Float())
+	if diff.Abs(diff).Cmp(big.NewFloat(refundRoundingTolerance)) > 0 {
+		return nil, fmt.Errorf("invalid refund amount %s: more than two decimal places", refundAmount.Text('f', -1))
+	}
+
+	result, err := c.Refund(context.Background(), Refund{
+		TransToken:       tokenStr,
+		Amount:           amount,
+		Description:      description,
+		Ref:              refundRef,
+		RequiresApproval: requiresApproval,
+	})
+	if result == nil {
+		return nil, err
+	}
+	return result.Response, err
+}
+
+// MemoryRefundLedger is a RefundLedger that keeps refunds in memory.
+// It is suitable for a single process, use a persistent implementation when refunds are issued from several processes.
+type MemoryRefundLedger struct {
+	mu      sync.Mutex
+	nextID  int
+	entries map[string][]RefundEntry
+}
+
+// NewMemoryRefundLedger creates an empty MemoryRefundLedger.
+func NewMemoryRefundLedger() *MemoryRefundLedger {
+	return &MemoryRefundLedger{
+		entries: make(map[string][]RefundEntry),
+	}
+}
+
+// Reserve implements RefundLedger.
+func (l *MemoryRefundLedger) Reserve(ctx context.Context, entry RefundEntry, captured Money) (RefundEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	total := entry.Amount
+	for _, e := range l.entries[entry.TransToken] {
+		var err error
+		if total, err = total.Add(e.Amount); err != nil {
+			return RefundEntry{}, err
+		}
+	}
+	cmp, err := total.Cmp(captured)
+	if err != nil {
+		return RefundEntry{}, err
+	}
+	if cmp > 0 {
+		return RefundEntry{}, fmt.Errorf("%w: %s refunded in total on %s captured", ErrRefundExceedsCaptured, total, captured)
+	}
+
+	l.nextID++
+	entry.ID = strconv.Itoa(l.nextID)
+	entry.Completed = false
+	l.entries[entry.TransToken] = append(l.entries[entry.TransToken], entry)
+	return entry, nil
+}
+
+// Complete implements RefundLedger.
+func (l *MemoryRefundLedger) Complete(ctx context.Context, id string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for token, entries := range l.entries {
+		for i := range entries {
+			if entries[i].ID == id {
+				l.entries[token][i].Completed = true
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("refund %s not found", id)
+}
+
+// Release implements RefundLedger.
+func (l *MemoryRefundLedger) Release(ctx context.Context, id string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for token, entries := range l.entries {
+		for i := range entries {
+			if entries[i].ID == id {
+				l.entries[token] = append(entries[:i:i], entries[i+1:]...)
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("refund %s not found", id)
+}
+
+// Entries implements RefundLedger.
+func (l *MemoryRefundLedger) Entries(ctx context.Context, transToken string) ([]RefundEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := make([]RefundEntry, len(l.entries[transToken]))
+	copy(entries, l.entries[transToken])
+	return entries, nil
+}
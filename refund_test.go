@@ -0,0 +1,263 @@
+package dpo_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-malawi/go-dpo"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRefundStubClient(refundResult string, refunds *[]string) *dpo.Client {
+	return newStubClientFunc(func(requestBody string) (int, string) {
+		if strings.Contains(requestBody, "<Request>verifyToken</Request>") {
+			return http.StatusOK, `<API3G><Result>000</Result><ResultExplanation>Transaction Paid</ResultExplanation>
+<TransactionCurrency>USD</TransactionCurrency><TransactionAmount>10.00</TransactionAmount></API3G>`
+		}
+		*refunds = append(*refunds, requestBody)
+		return http.StatusOK, `<API3G><Result>` + refundResult + `</Result><ResultExplanation>Refund result</ResultExplanation></API3G>`
+	})
+}
+
+func TestRefundPartial(t *testing.T) {
+	assert := assert.New(t)
+
+	var refunds []string
+	client := newRefundStubClient("000", &refunds)
+	client.SetRefundLedger(dpo.NewMemoryRefundLedger())
+
+	result, err := client.Refund(context.Background(), dpo.Refund{
+		TransToken:  "T1",
+		Amount:      dpo.Money{Cents: 600},
+		Description: "damaged item",
+	})
+	assert.Nil(err)
+	assert.Equal(dpo.RefundCompleted, result.Status)
+	assert.Equal("6.00 USD", result.Refunded.String())
+	assert.Contains(refunds[0], "<refundAmount>6.00</refundAmount>")
+
+	result, err = client.Refund(context.Background(), dpo.Refund{
+		TransToken:       "T1",
+		Amount:           dpo.Money{Cents: 400, Currency: "USD"},
+		Description:      "goodwill",
+		RequiresApproval: true,
+	})
+	assert.Nil(err)
+	assert.Equal(dpo.RefundPendingApproval, result.Status)
+	assert.Equal("10.00 USD", result.Refunded.String())
+	assert.Contains(refunds[1], "<refundApproval>1</refundApproval>")
+
+	_, err = client.Refund(context.Background(), dpo.Refund{
+		TransToken:  "T1",
+		Amount:      dpo.Money{Cents: 1},
+		Description: "one cent too many",
+	})
+	assert.True(errors.Is(err, dpo.ErrRefundExceedsCaptured))
+	assert.Len(refunds, 2)
+}
+
+func TestRefundExceedsCapturedWithoutLedger(t *testing.T) {
+	assert := assert.New(t)
+
+	var refunds []string
+	client := newRefundStubClient("000", &refunds)
+
+	_, err := client.Refund(context.Background(), dpo.Refund{
+		TransToken:  "T1",
+		Amount:      dpo.Money{Cents: 1001, Currency: "USD"},
+		Description: "too much",
+	})
+	assert.True(errors.Is(err, dpo.ErrRefundExceedsCaptured))
+	assert.Empty(refunds)
+}
+
+func TestRefundErrorReleasesReservation(t *testing.T) {
+	assert := assert.New(t)
+
+	var refunds []string
+	client := newRefundStubClient("999", &refunds)
+	ledger := dpo.NewMemoryRefundLedger()
+	client.SetRefundLedger(ledger)
+
+	_, err := client.Refund(context.Background(), dpo.Refund{
+		TransToken:  "T1",
+		Amount:      dpo.Money{Cents: 1000},
+		Description: "declined",
+	})
+	assert.Equal("999", dpo.ErrorCode(err))
+	assert.Len(refunds, 1)
+
+	entries, err := ledger.Entries(context.Background(), "T1")
+	assert.Nil(err)
+	assert.Empty(entries)
+}
+
+func TestRefundIsNotRetried(t *testing.T) {
+	assert := assert.New(t)
+
+	var refunds []string
+	client := newStubClientFunc(func(requestBody string) (int, string) {
+		if strings.Contains(requestBody, "<Request>verifyToken</Request>") {
+			return http.StatusOK, `<API3G><Result>000</Result><TransactionCurrency>USD</TransactionCurrency><TransactionAmount>10.00</TransactionAmount></API3G>`
+		}
+		refunds = append(refunds, requestBody)
+		return http.StatusInternalServerError, "server error"
+	})
+
+	_, err := client.Refund(context.Background(), dpo.Refund{
+		TransToken:  "T1",
+		Amount:      dpo.Money{Cents: 500},
+		Description: "damaged item",
+	})
+	assert.NotNil(err)
+	assert.Len(refunds, 1)
+}
+
+func TestRefundApprovalStaysReserved(t *testing.T) {
+	assert := assert.New(t)
+
+	var refunds []string
+	client := newRefundStubClient("000", &refunds)
+	ledger := dpo.NewMemoryRefundLedger()
+	client.SetRefundLedger(ledger)
+	full := dpo.Refund{TransToken: "T1", Amount: dpo.Money{Cents: 1000}, Description: "returned", RequiresApproval: true}
+
+	result, err := client.Refund(context.Background(), full)
+	assert.Nil(err)
+	assert.Equal(dpo.RefundPendingApproval, result.Status)
+	entries, err := ledger.Entries(context.Background(), "T1")
+	assert.Nil(err)
+	if assert.Len(entries, 1) {
+		assert.False(entries[0].Completed)
+	}
+
+	_, err = client.Refund(context.Background(), full)
+	assert.True(errors.Is(err, dpo.ErrRefundExceedsCaptured))
+
+	// the checker rejected the refund, the amount can be refunded again
+	assert.Nil(client.ResolveRefund(context.Background(), result.LedgerID, false))
+	result, err = client.Refund(context.Background(), full)
+	assert.Nil(err)
+	assert.Nil(client.ResolveRefund(context.Background(), result.LedgerID, true))
+
+	entries, err = ledger.Entries(context.Background(), "T1")
+	assert.Nil(err)
+	if assert.Len(entries, 1) {
+		assert.True(entries[0].Completed)
+	}
+	assert.Len(refunds, 2)
+}
+
+// failingCompleteLedger is a RefundLedger whose Complete always fails.
+type failingCompleteLedger struct {
+	*dpo.MemoryRefundLedger
+}
+
+func (l failingCompleteLedger) Complete(ctx context.Context, id string) error {
+	return errors.New("disk full")
+}
+
+func TestRefundLedgerFailureReturnsResult(t *testing.T) {
+	assert := assert.New(t)
+
+	var refunds []string
+	client := newRefundStubClient("000", &refunds)
+	client.SetRefundLedger(failingCompleteLedger{dpo.NewMemoryRefundLedger()})
+
+	result, err := client.Refund(context.Background(), dpo.Refund{
+		TransToken:  "T1",
+		Amount:      dpo.Money{Cents: 500},
+		Description: "damaged item",
+	})
+	assert.ErrorContains(err, "disk full")
+	if assert.NotNil(result) {
+		assert.Equal(dpo.RefundCompleted, result.Status)
+		assert.Equal("000", result.Response.Result)
+	}
+}
+
+func TestRefundTokenRejectsFractionalCents(t *testing.T) {
+	assert := assert.New(t)
+
+	var refunds []string
+	client := newRefundStubClient("000", &refunds)
+
+	_, err := client.RefundToken("T1", big.NewFloat(5.005), "", "damaged item", false)
+	assert.ErrorContains(err, "more than two decimal places")
+
+	_, err = client.RefundToken("T1", big.NewFloat(5.1), "", "damaged item", false)
+	assert.Nil(err)
+	// the shortest decimal of a float64 widened to 128 bits has many digits
+	_, err = client.RefundToken("T1", new(big.Float).SetPrec(128).SetFloat64(0.1), "", "damaged item", false)
+	assert.Nil(err)
+	if assert.Len(refunds, 2) {
+		assert.Contains(refunds[0], "<refundAmount>5.10</refundAmount>")
+		assert.Contains(refunds[1], "<refundAmount>0.10</refundAmount>")
+	}
+}
+
+func TestRefundNotSentReleasesReservation(t *testing.T) {
+	assert := assert.New(t)
+
+	var refunds []string
+	client := newRefundStubClient("000", &refunds)
+	ledger := dpo.NewMemoryRefundLedger()
+	client.SetRefundLedger(ledger)
+	client.SetLimit("refundToken", dpo.Limit{Rate: 0.001})
+
+	_, err := client.Refund(context.Background(), dpo.Refund{TransToken: "T1", Amount: dpo.Money{Cents: 200}, Description: "first"})
+	assert.Nil(err)
+
+	// the limit only allows the next refund long after the deadline, so it is never sent
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	result, err := client.Refund(ctx, dpo.Refund{TransToken: "T1", Amount: dpo.Money{Cents: 300}, Description: "second"})
+	assert.True(errors.Is(err, context.DeadlineExceeded))
+	assert.Nil(result)
+	assert.Len(refunds, 1)
+
+	entries, err := ledger.Entries(context.Background(), "T1")
+	assert.Nil(err)
+	if assert.Len(entries, 1) {
+		assert.Equal(int64(200), entries[0].Amount.Cents)
+	}
+}
+
+func TestRefundUnknownOutcomeStaysReserved(t *testing.T) {
+	assert := assert.New(t)
+
+	client := newStubClientFunc(func(requestBody string) (int, string) {
+		if strings.Contains(requestBody, "<Request>verifyToken</Request>") {
+			return http.StatusOK, `<API3G><Result>000</Result><TransactionCurrency>USD</TransactionCurrency><TransactionAmount>10.00</TransactionAmount></API3G>`
+		}
+		return http.StatusBadGateway, "bad gateway"
+	})
+	ledger := dpo.NewMemoryRefundLedger()
+	client.SetRefundLedger(ledger)
+
+	result, err := client.Refund(context.Background(), dpo.Refund{TransToken: "T1", Amount: dpo.Money{Cents: 1000}, Description: "returned"})
+	assert.NotNil(err)
+	if !assert.NotNil(result) {
+		return
+	}
+	assert.Equal(dpo.RefundUnknown, result.Status)
+	assert.NotEmpty(result.LedgerID)
+	assert.Nil(result.Response)
+
+	entries, err := ledger.Entries(context.Background(), "T1")
+	assert.Nil(err)
+	if assert.Len(entries, 1) {
+		assert.False(entries[0].Completed)
+	}
+
+	// DPO did not process the refund, the amount can be refunded again
+	assert.Nil(client.ResolveRefund(context.Background(), result.LedgerID, false))
+	entries, err = ledger.Entries(context.Background(), "T1")
+	assert.Nil(err)
+	assert.Empty(entries)
+}
@@ -0,0 +1,100 @@
+package dpo_test
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-malawi/go-dpo"
+	"github.com/golang-malawi/go-dpo/dpotest"
+	"github.com/stretchr/testify/assert"
+)
+
+// The fixtures in testdata/replay are scrubbed exchanges with the DPO API, replayed with dpotest.
+
+// newReplayClient returns a client answered by the fixtures in testdata/replay/name.
+// The returned function checks that every fixture was used.
+func newReplayClient(t *testing.T, name string) (*dpo.Client, func()) {
+	replayer, err := dpotest.NewReplayer(filepath.Join("testdata", "replay", name))
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	client := dpo.NewClient("TOKEN", true)
+	client.SetDebugOutput(nil)
+	client.GenerateRef = dpo.RefGeneratorFunc(func() (string, error) {
+		return "ORDER-1001", nil
+	})
+	client.SetHTTPClient(&http.Client{Transport: replayer})
+	return client, func() {
+		assert.Empty(t, replayer.Unused(), "fixtures without a request")
+	}
+}
+
+func TestReplayCreateAndVerifyToken(t *testing.T) {
+	assert := assert.New(t)
+	client, checkUsed := newReplayClient(t, "create-verify")
+	defer checkUsed()
+
+	request := client.NewCreateTokenRequest(client.Token, "USD", big.NewFloat(10.5))
+	request.AddService("3854", "Shoes", time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC))
+	token, err := client.CreateToken(request)
+	assert.Nil(err)
+	assert.Equal("8D3DA73D-9D7F-4E09-96D4-3D44E7A83EA3", token.TransToken)
+	assert.Equal("R38474029", token.TransRef)
+
+	verified, err := client.VerifyToken(token)
+	assert.Nil(err)
+	assert.Equal(dpo.StatusPaid, verified.Result)
+	assert.Equal("10.50", verified.TransactionAmount)
+	assert.Equal("USD", verified.TransactionCurrency)
+	assert.Equal("1111", verified.CustomerCredit)
+}
+
+func TestReplayCancelToken(t *testing.T) {
+	assert := assert.New(t)
+	client, checkUsed := newReplayClient(t, "cancel")
+	defer checkUsed()
+
+	response, err := client.CancelToken("8D3DA73D-9D7F-4E09-96D4-3D44E7A83EA3")
+	assert.Nil(err)
+	assert.Equal("000", response.Result)
+}
+
+func TestReplayRefundToken(t *testing.T) {
+	assert := assert.New(t)
+	client, checkUsed := newReplayClient(t, "refund") // verifyToken for the paid amount, then refundToken
+	defer checkUsed()
+
+	response, err := client.RefundToken("8D3DA73D-9D7F-4E09-96D4-3D44E7A83EA3", big.NewFloat(5), "REFUND-1", "Returned shoes", false)
+	assert.Nil(err)
+	assert.Equal("000", response.Result)
+}
+
+func TestReplayChargeMobile(t *testing.T) {
+	assert := assert.New(t)
+	client, checkUsed := newReplayClient(t, "mobile")
+	defer checkUsed()
+
+	token := &dpo.CreateTokenResponse{TransToken: "8D3DA73D-9D7F-4E09-96D4-3D44E7A83EA3"}
+	response, err := client.ChargeMobile(context.Background(), token, "0991234567", "", "MW")
+	assert.Nil(err)
+	assert.Equal(dpo.MobileChargePending, response.Code)
+	assert.NotEmpty(response.Instructions)
+}
+
+func TestReplayTransactionByRef(t *testing.T) {
+	assert := assert.New(t)
+	client, checkUsed := newReplayClient(t, "transaction-by-ref")
+	defer checkUsed()
+
+	transactions, err := client.TransactionByRef(context.Background(), "ORDER-1001", nil)
+	assert.Nil(err)
+	if assert.Len(transactions, 2) {
+		assert.Equal(dpo.StatusCancelled, transactions[0].Result)
+		assert.True(transactions[1].IsPaid())
+		assert.Equal("8D3DA73D-9D7F-4E09-96D4-3D44E7A83EA3", transactions[1].TransToken)
+	}
+}
@@ -0,0 +1,218 @@
+package dpo
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	opGetTransactionsReport = "getTransactionsReport"
+
+	reportDateFormat      = "2006-01-02"
+	defaultReportPageSize = 100
+)
+
+// TransactionFilter narrows down the transactions returned by client.Transactions.
+// Zero values are not sent to DPO, so the zero TransactionFilter returns every transaction in the date range.
+type TransactionFilter struct {
+	Status      string // Status only return transactions with this result code, see the Status constants
+	Currency    string // Currency only return transactions in this currency, e.g. "USD"
+	ServiceType string // ServiceType only return transactions for this service type code
+	PageSize    int    // PageSize number of transactions fetched per request, defaults to 100
+}
+
+// TransactionsReportRequest is a request for one page of the transaction report.
+type TransactionsReportRequest struct {
+	XMLName xml.Name `xml:"API3G"`
+
+	CompanyToken      string `xml:"CompanyToken"`
+	Request           string `xml:"Request"`
+	StartDate         string `xml:"StartDate"`
+	EndDate           string `xml:"EndDate"`
+	TransactionStatus string `xml:"TransactionStatus,omitempty"`
+	Currency          string `xml:"Currency,omitempty"`
+	ServiceType       string `xml:"ServiceType,omitempty"`
+	PageNumber        int    `xml:"PageNumber"`
+	RecordsPerPage    int    `xml:"RecordsPerPage"`
+}
+
+// TransactionsReportResponse is one page of the transaction report and depending on the Result may be an error response or not.
+type TransactionsReportResponse struct {
+	XMLName xml.Name `xml:"API3G"`
+
+	Result            string        `xml:"Result"`
+	ResultExplanation string        `xml:"ResultExplanation"`
+	TotalPages        int           `xml:"TotalPages"`
+	Transactions      []Transaction `xml:"Transactions>Transaction"`
+}
+
+// IsError determines whether the TransactionsReportResponse is an error or not.
+func (t *TransactionsReportResponse) IsError() bool {
+	return t.Result != "000"
+}
+
+// TransactionIterator pages through the transaction report.
+// Call Next until it returns false, then check Err.
+//
+//	it := client.Transactions(ctx, from, to, dpo.TransactionFilter{Currency: "USD"})
+//	for it.Next() {
+//		transaction := it.Transaction()
+//		// ...
+//	}
+//	if err := it.Err(); err != nil {
+//		// ...
+//	}
+type TransactionIterator struct {
+	ctx     context.Context
+	client  *Client
+	request TransactionsReportRequest
+
+	page    []Transaction
+	current Transaction
+	done    bool
+	err     error
+}
+
+// Transactions returns an iterator over all transactions between from and to (inclusive) that match filter.
+// Pages are fetched from DPO lazily as the iterator advances.
+func (c *Client) Transactions(ctx context.Context, from, to time.Time, filter TransactionFilter) *TransactionIterator {
+	it := &TransactionIterator{
+		ctx:    ctx,
+		client: c,
+		request: TransactionsReportRequest{
+			CompanyToken:      c.Token,
+			Request:           opGetTransactionsReport,
+			StartDate:         from.Format(reportDateFormat),
+			EndDate:           to.Format(reportDateFormat),
+			TransactionStatus: filter.Status,
+			Currency:          filter.Currency,
+			ServiceType:       filter.ServiceType,
+			PageNumber:        0,
+			RecordsPerPage:    filter.PageSize,
+		},
+	}
+	if it.request.RecordsPerPage <= 0 {
+		it.request.RecordsPerPage = defaultReportPageSize
+	}
+	if to.Before(from) {
+		it.err = fmt.Errorf("invalid date range: %s is before %s", it.request.EndDate, it.request.StartDate)
+		it.done = true
+	}
+	return it
+}
+
+// Next advances the iterator to the next transaction, fetching the next page when needed.
+// It returns false when there are no more transactions or an error occurred.
+func (it *TransactionIterator) Next() bool {
+	for len(it.page) == 0 {
+		if it.done {
+			return false
+		}
+		it.fetch()
+	}
+	it.current = it.page[0]
+	it.page = it.page[1:]
+	return true
+}
+
+// fetch loads the next page of the report into it.page.
+func (it *TransactionIterator) fetch() {
+	it.request.PageNumber++
+
+	var response TransactionsReportResponse
+	if err := it.client.post(it.ctx, opGetTransactionsReport, &it.request, &response); err != nil {
+		it.err = err
+		it.done = true
+		return
+	}
+	if response.IsError() {
+		it.err = &Error{Op: opGetTransactionsReport, Code: response.Result, Explanation: response.ResultExplanation}
+		it.done = true
+		return
+	}
+
+	it.page = response.Transactions
+	if len(response.Transactions) == 0 || it.request.PageNumber >= response.TotalPages {
+		it.done = true
+	}
+}
+
+// Transaction returns the transaction the iterator currently points at.
+func (it *TransactionIterator) Transaction() Transaction {
+	return it.current
+}
+
+// Err returns the first error encountered while paging through the report.
+func (it *TransactionIterator) Err() error {
+	return it.err
+}
+
+// CollectTransactions reads all remaining transactions from it into a slice.
+func CollectTransactions(it *TransactionIterator) ([]Transaction, error) {
+	transactions := make([]Transaction, 0)
+	for it.Next() {
+		transactions = append(transactions, it.Transaction())
+	}
+	return transactions, it.Err()
+}
+
+// transactionCSVHeader lists the columns written by WriteTransactionsCSV.
+var transactionCSVHeader = []string{
+	"TransactionToken", "TransactionRef", "CompanyRef", "Result", "ResultExplanation",
+	"TransactionCreatedDate", "TransactionPaymentDate", "TransactionCurrency", "TransactionAmount",
+	"TransactionNetAmount", "TransactionSettlementDate", "CustomerName", "CustomerCreditType", "TransactionApproval",
+}
+
+// WriteTransactionsCSV streams all remaining transactions from it to w as CSV with a header row.
+func WriteTransactionsCSV(w io.Writer, it *TransactionIterator) error {
+	csvWriter := csv.NewWriter(w)
+	if err := csvWriter.Write(transactionCSVHeader); err != nil {
+		return err
+	}
+	for it.Next() {
+		t := it.Transaction()
+		record := []string{
+			t.TransToken, t.TransRef, t.CompanyRef, t.Result, t.ResultExplanation,
+			t.TransactionCreatedDate, t.TransactionPaymentDate, t.TransactionCurrency, t.TransactionAmount,
+			t.TransactionNetAmount, t.TransactionSettlementDate, t.CustomerName, t.CustomerCreditType, t.TransactionApproval,
+		}
+		if err := csvWriter.Write(record); err != nil {
+			return err
+		}
+	}
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return err
+	}
+	return it.Err()
+}
+
+// WriteTransactionsJSON streams all remaining transactions from it to w as a JSON array.
+func WriteTransactionsJSON(w io.Writer, it *TransactionIterator) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	for i := 0; it.Next(); i++ {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		data, err := json.Marshal(it.Transaction())
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	if _, err := io.WriteString(w, "]\n"); err != nil {
+		return err
+	}
+	return it.Err()
+}
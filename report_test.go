@@ -0,0 +1,80 @@
+package dpo_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-malawi/go-dpo"
+	"github.com/stretchr/testify/assert"
+)
+
+func newReportStubClient() *dpo.Client {
+	return newStubClientFunc(func(requestBody string) (int, string) {
+		if strings.Contains(requestBody, "<PageNumber>1</PageNumber>") {
+			return http.StatusOK, `<API3G><Result>000</Result><TotalPages>2</TotalPages><Transactions>
+<Transaction><TransactionToken>T1</TransactionToken><Result>000</Result><TransactionAmount>1.00</TransactionAmount></Transaction>
+<Transaction><TransactionToken>T2</TransactionToken><Result>901</Result><TransactionAmount>2.00</TransactionAmount></Transaction>
+</Transactions></API3G>`
+		}
+		return http.StatusOK, `<API3G><Result>000</Result><TotalPages>2</TotalPages><Transactions>
+<Transaction><TransactionToken>T3</TransactionToken><Result>000</Result><TransactionAmount>3.00</TransactionAmount></Transaction>
+</Transactions></API3G>`
+	})
+}
+
+func TestTransactionsPaging(t *testing.T) {
+	assert := assert.New(t)
+
+	client := newReportStubClient()
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+
+	transactions, err := dpo.CollectTransactions(client.Transactions(context.Background(), from, to, dpo.TransactionFilter{PageSize: 2}))
+	assert.Nil(err)
+	assert.Len(transactions, 3)
+	assert.Equal("T1", transactions[0].TransToken)
+	assert.Equal("T3", transactions[2].TransToken)
+}
+
+func TestTransactionsInvalidRange(t *testing.T) {
+	assert := assert.New(t)
+
+	client := newReportStubClient()
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	it := client.Transactions(context.Background(), from, from.AddDate(0, 0, -1), dpo.TransactionFilter{})
+	assert.False(it.Next())
+	assert.NotNil(it.Err())
+}
+
+func TestWriteTransactionsCSV(t *testing.T) {
+	assert := assert.New(t)
+
+	client := newReportStubClient()
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	err := dpo.WriteTransactionsCSV(&buf, client.Transactions(context.Background(), from, from, dpo.TransactionFilter{}))
+	assert.Nil(err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(lines, 4)
+	assert.True(strings.HasPrefix(lines[1], "T1,"))
+}
+
+func TestWriteTransactionsJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	client := newReportStubClient()
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	err := dpo.WriteTransactionsJSON(&buf, client.Transactions(context.Background(), from, from, dpo.TransactionFilter{}))
+	assert.Nil(err)
+	assert.Contains(buf.String(), `"trans_token":"T2"`)
+	assert.True(strings.HasPrefix(buf.String(), "["))
+}
@@ -0,0 +1,191 @@
+package dpo
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+//go:generate go run ./internal/schemagen -out schema
+
+const (
+	jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+	jsonSchemaBaseURL = "https://github.com/golang-malawi/go-dpo/schema/"
+
+	// amountPattern matches amounts as written by the MarshalJSON methods, e.g. "1000.50".
+	amountPattern = `^-?[0-9]+\.[0-9]{2}$`
+)
+
+// JSONSchema is a JSON Schema (draft 2020-12) document describing the JSON form of a type of this package.
+type JSONSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	ID                   string                 `json:"$id,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Type                 any                    `json:"type,omitempty"` // Type a type name or, for nullable values, a list of type names
+	Format               string                 `json:"format,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	AdditionalProperties *JSONSchema            `json:"additionalProperties,omitempty"`
+}
+
+// jsonSchemaTypes are the types JSONSchemas describes, by the name of their schema document.
+var jsonSchemaTypes = []struct {
+	name  string
+	value any
+}{
+	{"create-token-request", CreateTokenRequest{}},
+	{"create-token-response", CreateTokenResponse{}},
+	{"verify-token-request", VerifyTokenRequest{}},
+	{"verify-token-response", VerifyTokenResponse{}},
+	{"cancel-token-request", CancelTokenRequest{}},
+	{"cancel-token-response", CancelTokenResponse{}},
+	{"refund-token-request", RefundTokenRequest{}},
+	{"refund-token-response", RefundTokenResponse{}},
+	{"charge-credit-card-request", ChargeCreditCardRequest{}},
+	{"charge-credit-card-response", ChargeCreditCardResponse{}},
+	{"charge-credit-card-result", ChargeCreditCardResult{}},
+	{"charge-token-mobile-request", ChargeTokenMobileRequest{}},
+	{"charge-token-mobile-response", ChargeTokenMobileResponse{}},
+	{"mobile-country", MobileCountry{}},
+	{"transaction-by-ref-request", TransactionByRefRequest{}},
+	{"transaction-by-ref-response", TransactionByRefResponse{}},
+	{"transaction", Transaction{}},
+	{"payment-redirect", PaymentRedirect{}},
+	{"push-notification", PushNotification{}},
+	{"payment-record", PaymentRecord{}},
+	{"event", Event{}},
+}
+
+// jsonSchemaEnums lists the values of the string types which are enumerations.
+var jsonSchemaEnums = map[reflect.Type][]string{
+	reflect.TypeOf(CardBrand("")): {
+		string(BrandVisa), string(BrandMastercard), string(BrandAmex), string(BrandDiscover), string(BrandDinersClub),
+		string(BrandJCB), string(BrandUnionPay), string(BrandMaestro), string(BrandUnknown),
+	},
+	reflect.TypeOf(CardChargeStatus("")): {string(CardChargeApproved), string(CardChargeChallengeRequired)},
+	reflect.TypeOf(EventType("")): {
+		string(EventTokenCreated), string(EventPaymentSucceeded), string(EventPaymentFailed), string(EventPaymentExpired),
+		string(EventTokenCancelled), string(EventRefundRequested), string(EventRefundCompleted),
+	},
+}
+
+// JSONSchemas returns a schema for the JSON form of the requests, responses, notifications, payment records and events
+// of this package, keyed by the name of the document, e.g. "event" for https://github.com/golang-malawi/go-dpo/schema/event.schema.json.
+// The documents are also committed in the schema directory of the repository.
+func JSONSchemas() map[string]*JSONSchema {
+	schemas := make(map[string]*JSONSchema, len(jsonSchemaTypes))
+	for _, t := range jsonSchemaTypes {
+		schemas[t.name] = NewJSONSchema(t.name, t.value)
+	}
+	return schemas
+}
+
+// NewJSONSchema returns the schema document named name for the JSON form of v, which is a struct or a pointer to one.
+// Fields follow their json struct tags, a field is required unless it is omitempty.
+// String fields tagged jsonschema:"date-time" or jsonschema:"amount" are described as RFC 3339 dates or two decimal amounts.
+func NewJSONSchema(name string, v any) *JSONSchema {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	schema := schemaForType(t)
+	schema.Schema = jsonSchemaDialect
+	schema.ID = jsonSchemaBaseURL + name + ".schema.json"
+	schema.Title = t.Name()
+	return schema
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaForType describes values of t.
+func schemaForType(t reflect.Type) *JSONSchema {
+	if t == timeType {
+		return &JSONSchema{Type: "string", Format: "date-time"}
+	}
+	if t == reflect.TypeOf(Card{}) {
+		// Card implements json.Marshaler, see Card.MarshalJSON
+		return &JSONSchema{
+			Type: "object",
+			Properties: map[string]*JSONSchema{
+				"holder":       {Type: "string"},
+				"brand":        schemaForType(reflect.TypeOf(CardBrand(""))),
+				"last4":        {Type: "string", Pattern: "^[0-9]{4}$"},
+				"expiry_month": {Type: "integer"},
+				"expiry_year":  {Type: "integer"},
+			},
+			Required: []string{"holder", "brand", "last4", "expiry_month", "expiry_year"},
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaForType(t.Elem())
+	case reflect.String:
+		return &JSONSchema{Type: "string", Enum: jsonSchemaEnums[t]}
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JSONSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &JSONSchema{Type: "array", Items: schemaForType(t.Elem())}
+	case reflect.Map:
+		return &JSONSchema{Type: "object", AdditionalProperties: schemaForType(t.Elem())}
+	case reflect.Struct:
+		schema := &JSONSchema{Type: "object", Properties: make(map[string]*JSONSchema)}
+		addStructProperties(schema, t)
+		return schema
+	default:
+		return &JSONSchema{}
+	}
+}
+
+// addStructProperties adds the fields of the struct type t to schema, the fields of embedded structs are inlined
+// the way encoding/json does.
+func addStructProperties(schema *JSONSchema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		omitEmpty := strings.Contains(","+options+",", ",omitempty,")
+
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			addStructProperties(schema, field.Type)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := schemaForType(field.Type)
+		switch field.Tag.Get("jsonschema") {
+		case "date-time":
+			property.Format = "date-time"
+		case "amount":
+			property.Pattern = amountPattern
+		}
+		switch field.Type.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map:
+			if !omitEmpty {
+				// nil values are written as null
+				property.Type = []string{property.Type.(string), "null"}
+			}
+		}
+
+		schema.Properties[name] = property
+		if !omitEmpty {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package dpo_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-malawi/go-dpo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONSchemasUpToDate(t *testing.T) {
+	assert := assert.New(t)
+
+	schemas := dpo.JSONSchemas()
+	files, err := filepath.Glob(filepath.Join("schema", "*.schema.json"))
+	assert.Nil(err)
+	assert.Len(files, len(schemas), "run go generate to update the schema directory")
+
+	for name, schema := range schemas {
+		want, err := json.MarshalIndent(schema, "", "  ")
+		assert.Nil(err)
+		got, err := os.ReadFile(filepath.Join("schema", name+".schema.json"))
+		assert.Nil(err)
+		assert.Equal(string(want)+"\n", string(got), "%s is out of date, run go generate", name)
+	}
+}
+
+func TestEventJSONSchema(t *testing.T) {
+	assert := assert.New(t)
+
+	schema := dpo.JSONSchemas()["event"]
+	assert.Equal("https://github.com/golang-malawi/go-dpo/schema/event.schema.json", schema.ID)
+	assert.Equal("Event", schema.Title)
+	assert.Equal([]string{"id", "type", "trans_token", "amount", "at"}, schema.Required)
+	assert.Contains(schema.Properties["type"].Enum, string(dpo.EventPaymentSucceeded))
+	assert.Equal("date-time", schema.Properties["at"].Format)
+	assert.Equal([]string{"cents", "currency"}, schema.Properties["amount"].Required)
+
+	transaction := dpo.JSONSchemas()["transaction"]
+	assert.NotEmpty(transaction.Properties["transaction_amount"].Pattern)
+	assert.Equal("date-time", transaction.Properties["transaction_created_date"].Format)
+	assert.NotContains(transaction.Required, "transaction_amount")
+}
@@ -0,0 +1,223 @@
+package dpo
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	opGetServices   = "getServices"
+	opCreateService = "createService"
+)
+
+// ServiceType is a service type configured for the company in DPO.
+// The ID is the typeCode passed to CreateTokenRequest.AddService.
+type ServiceType struct {
+	ID   string `xml:"ServiceID"`
+	Name string `xml:"ServiceName"`
+}
+
+// ServicesRequest is a request to list the service types configured for the company.
+type ServicesRequest struct {
+	XMLName xml.Name `xml:"API3G"`
+
+	CompanyToken string `xml:"CompanyToken"`
+	Request      string `xml:"Request"`
+}
+
+// ServicesResponse is returned after processing a ServicesRequest and depending on the Result may be an error response or not.
+type ServicesResponse struct {
+	XMLName xml.Name `xml:"API3G"`
+
+	Result            string        `xml:"Result"`
+	ResultExplanation string        `xml:"ResultExplanation"`
+	Services          []ServiceType `xml:"Services>Service"`
+}
+
+// IsError determines whether the ServicesResponse is an error or not.
+func (s *ServicesResponse) IsError() bool {
+	return s.Result != "000"
+}
+
+// CreateServiceRequest is a request to register a new service type for the company.
+type CreateServiceRequest struct {
+	XMLName xml.Name `xml:"API3G"`
+
+	CompanyToken string `xml:"CompanyToken"`
+	Request      string `xml:"Request"`
+	ServiceName  string `xml:"ServiceName"`
+}
+
+// CreateServiceResponse is returned after processing a CreateServiceRequest and depending on the Result may be an error response or not.
+type CreateServiceResponse struct {
+	XMLName xml.Name `xml:"API3G"`
+
+	Result            string `xml:"Result"`
+	ResultExplanation string `xml:"ResultExplanation"`
+	ServiceID         string `xml:"ServiceID"`
+}
+
+// IsError determines whether the CreateServiceResponse is an error or not.
+func (s *CreateServiceResponse) IsError() bool {
+	return s.Result != "000"
+}
+
+// Services lists the service types configured for the company.
+func (c *Client) Services(ctx context.Context) ([]ServiceType, error) {
+	request := &ServicesRequest{
+		CompanyToken: c.Token,
+		Request:      opGetServices,
+	}
+
+	var response ServicesResponse
+	if err := c.post(ctx, opGetServices, request, &response); err != nil {
+		return nil, err
+	}
+	if response.IsError() {
+		return nil, &Error{Op: opGetServices, Code: response.Result, Explanation: response.ResultExplanation}
+	}
+
+	return response.Services, nil
+}
+
+// CreateService registers a new service type for the company and returns it.
+func (c *Client) CreateService(ctx context.Context, name string) (*ServiceType, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, fmt.Errorf("service name must not be empty")
+	}
+
+	request := &CreateServiceRequest{
+		CompanyToken: c.Token,
+		Request:      opCreateService,
+		ServiceName:  name,
+	}
+
+	var response CreateServiceResponse
+	if err := c.post(ctx, opCreateService, request, &response); err != nil {
+		return nil, err
+	}
+	if response.IsError() {
+		return nil, &Error{Op: opCreateService, Code: response.Result, Explanation: response.ResultExplanation}
+	}
+
+	return &ServiceType{ID: response.ServiceID, Name: name}, nil
+}
+
+// ServiceCatalog caches the service types of the company so that CreateTokenRequests can be validated locally.
+// The catalog is loaded on first use and reloaded once it is older than its TTL.
+// A ServiceCatalog is safe for concurrent use.
+type ServiceCatalog struct {
+	client *Client
+	ttl    time.Duration
+
+	mu       sync.RWMutex
+	services map[string]ServiceType
+	loadedAt time.Time
+}
+
+// NewServiceCatalog creates a catalog backed by client.Services.
+// ttl controls how long the loaded service types are trusted, a ttl of 0 never reloads them.
+func NewServiceCatalog(client *Client, ttl time.Duration) *ServiceCatalog {
+	return &ServiceCatalog{
+		client: client,
+		ttl:    ttl,
+	}
+}
+
+// Refresh reloads the service types from DPO.
+func (s *ServiceCatalog) Refresh(ctx context.Context) error {
+	services, err := s.client.Services(ctx)
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[string]ServiceType, len(services))
+	for _, service := range services {
+		byID[service.ID] = service
+	}
+
+	s.mu.Lock()
+	s.services = byID
+	s.loadedAt = time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+// ensureLoaded loads the catalog if it was never loaded or has expired.
+func (s *ServiceCatalog) ensureLoaded(ctx context.Context) error {
+	s.mu.RLock()
+	stale := s.services == nil || (s.ttl > 0 && time.Since(s.loadedAt) > s.ttl)
+	s.mu.RUnlock()
+
+	if !stale {
+		return nil
+	}
+	return s.Refresh(ctx)
+}
+
+// List returns all known service types.
+func (s *ServiceCatalog) List(ctx context.Context) ([]ServiceType, error) {
+	if err := s.ensureLoaded(ctx); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	services := make([]ServiceType, 0, len(s.services))
+	for _, service := range s.services {
+		services = append(services, service)
+	}
+	return services, nil
+}
+
+// Lookup returns the service type with the given code and whether it exists.
+func (s *ServiceCatalog) Lookup(ctx context.Context, typeCode string) (ServiceType, bool, error) {
+	if err := s.ensureLoaded(ctx); err != nil {
+		return ServiceType{}, false, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	service, ok := s.services[typeCode]
+	return service, ok, nil
+}
+
+// Create registers a new service type with DPO and adds it to the catalog.
+func (s *ServiceCatalog) Create(ctx context.Context, name string) (*ServiceType, error) {
+	service, err := s.client.CreateService(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if s.services != nil {
+		s.services[service.ID] = *service
+	}
+	s.mu.Unlock()
+	return service, nil
+}
+
+// Validate checks that token has at least one service and that every service type is known to the catalog.
+func (s *ServiceCatalog) Validate(ctx context.Context, token *CreateTokenRequest) error {
+	if token == nil {
+		return fmt.Errorf("token must not be nil")
+	}
+	if len(token.Services) == 0 {
+		return fmt.Errorf("token must have at least one service")
+	}
+
+	for _, service := range token.Services {
+		_, ok, err := s.Lookup(ctx, service.ServiceType)
+		if err != nil {
+			return fmt.Errorf("failed to load service catalog: %v", err)
+		}
+		if !ok {
+			return fmt.Errorf("unknown service type %q", service.ServiceType)
+		}
+	}
+	return nil
+}
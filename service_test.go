@@ -0,0 +1,72 @@
+package dpo_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-malawi/go-dpo"
+	"github.com/stretchr/testify/assert"
+)
+
+const servicesResponse = `<API3G><Result>000</Result><ResultExplanation>OK</ResultExplanation><Services>
+<Service><ServiceID>3854</ServiceID><ServiceName>Ecommerce</ServiceName></Service>
+<Service><ServiceID>5525</ServiceID><ServiceName>Subscriptions</ServiceName></Service>
+</Services></API3G>`
+
+func TestServices(t *testing.T) {
+	assert := assert.New(t)
+
+	client := newStubClient(http.StatusOK, servicesResponse, nil)
+
+	services, err := client.Services(context.Background())
+	assert.Nil(err)
+	assert.Len(services, 2)
+	assert.Equal(dpo.ServiceType{ID: "3854", Name: "Ecommerce"}, services[0])
+}
+
+func TestServiceCatalogValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	calls := 0
+	client := newStubClientFunc(func(requestBody string) (int, string) {
+		calls++
+		if strings.Contains(requestBody, "<Request>createService</Request>") {
+			return http.StatusOK, `<API3G><Result>000</Result><ServiceID>9000</ServiceID></API3G>`
+		}
+		return http.StatusOK, servicesResponse
+	})
+	catalog := dpo.NewServiceCatalog(client, time.Hour)
+
+	token := &dpo.CreateTokenRequest{}
+	token.AddService("3854", "Ecommerce", time.Now())
+	assert.Nil(catalog.Validate(context.Background(), token))
+
+	token.AddService("1234", "Unknown", time.Now())
+	assert.ErrorContains(catalog.Validate(context.Background(), token), `unknown service type "1234"`)
+
+	service, err := catalog.Create(context.Background(), "Donations")
+	assert.Nil(err)
+	_, ok, err := catalog.Lookup(context.Background(), service.ID)
+	assert.Nil(err)
+	assert.True(ok)
+	assert.Equal(2, calls)
+}
+
+func TestCreateTokenValidatesServices(t *testing.T) {
+	assert := assert.New(t)
+
+	var requests []string
+	client := newStubClient(http.StatusOK, servicesResponse, &requests)
+	client.SetServiceCatalog(dpo.NewServiceCatalog(client, 0))
+
+	token := &dpo.CreateTokenRequest{}
+	token.AddService("1234", "Unknown", time.Now())
+
+	_, err := client.CreateToken(token)
+	assert.NotNil(err)
+	assert.Len(requests, 1)
+	assert.Contains(requests[0], "getServices")
+}
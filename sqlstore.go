@@ -0,0 +1,469 @@
+package dpo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SQLDialect describes the differences between the SQL databases supported by SQLStore.
+type SQLDialect struct {
+	Name string
+
+	// placeholder returns the bind parameter for the n-th (1-based) argument.
+	placeholder func(n int) string
+	// types maps the logical column types used in migrations to database types.
+	types map[string]string
+}
+
+var (
+	// SQLite is the dialect for SQLite databases.
+	SQLite = SQLDialect{
+		Name:        "sqlite",
+		placeholder: func(n int) string { return "?" },
+		types: map[string]string{
+			"serial":    "INTEGER PRIMARY KEY AUTOINCREMENT",
+			"timestamp": "TIMESTAMP",
+		},
+	}
+
+	// Postgres is the dialect for PostgreSQL databases.
+	Postgres = SQLDialect{
+		Name:        "postgres",
+		placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+		types: map[string]string{
+			"serial":    "BIGSERIAL PRIMARY KEY",
+			"timestamp": "TIMESTAMPTZ",
+		},
+	}
+)
+
+// rebind replaces the '?' bind parameters of query with the placeholders of the dialect
+// and expands the {type} markers used by migrations.
+func (d SQLDialect) rebind(query string) string {
+	for name, dbType := range d.types {
+		query = strings.ReplaceAll(query, "{"+name+"}", dbType)
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString(d.placeholder(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// sqlMigrations are applied in order, each one exactly once. Never edit a released migration, append a new one.
+var sqlMigrations = []string{
+	`CREATE TABLE dpo_payments (
+		trans_token TEXT NOT NULL PRIMARY KEY,
+		company_ref TEXT NOT NULL,
+		trans_ref TEXT NOT NULL,
+		amount_cents BIGINT NOT NULL,
+		currency TEXT NOT NULL,
+		status TEXT NOT NULL,
+		status_explanation TEXT NOT NULL,
+		created_at {timestamp} NOT NULL,
+		updated_at {timestamp} NOT NULL
+	)`,
+	`CREATE INDEX dpo_payments_company_ref ON dpo_payments (company_ref)`,
+	`CREATE INDEX dpo_payments_status ON dpo_payments (status, created_at)`,
+	`CREATE TABLE dpo_payment_status_history (
+		id {serial},
+		trans_token TEXT NOT NULL REFERENCES dpo_payments (trans_token),
+		status TEXT NOT NULL,
+		explanation TEXT NOT NULL,
+		changed_at {timestamp} NOT NULL
+	)`,
+	`CREATE INDEX dpo_payment_status_history_token ON dpo_payment_status_history (trans_token, id)`,
+	`CREATE TABLE dpo_events (
+		seq {serial},
+		id TEXT NOT NULL UNIQUE,
+		payload TEXT NOT NULL,
+		created_at {timestamp} NOT NULL,
+		delivered_at {timestamp}
+	)`,
+	`CREATE INDEX dpo_events_pending ON dpo_events (delivered_at, seq)`,
+	`CREATE TABLE dpo_audit (
+		id {serial},
+		op TEXT NOT NULL,
+		company_ref TEXT NOT NULL,
+		trans_token TEXT NOT NULL,
+		attempt INTEGER NOT NULL,
+		http_status INTEGER NOT NULL,
+		request TEXT NOT NULL,
+		response TEXT NOT NULL,
+		error TEXT NOT NULL,
+		sent_at {timestamp} NOT NULL,
+		received_at {timestamp} NOT NULL
+	)`,
+	`CREATE INDEX dpo_audit_token ON dpo_audit (trans_token, id)`,
+	`ALTER TABLE dpo_payments ADD COLUMN order_id TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE dpo_payments ADD COLUMN completed_at {timestamp}`,
+}
+
+// SQLStore is a Store backed by a database/sql database. Call Migrate once before using it.
+// Register the database driver of your choice, SQLStore does not import any.
+type SQLStore struct {
+	db      *sql.DB
+	dialect SQLDialect
+}
+
+// NewSQLStore creates a store using db, queries are written for dialect.
+func NewSQLStore(db *sql.DB, dialect SQLDialect) *SQLStore {
+	return &SQLStore{db: db, dialect: dialect}
+}
+
+// Migrate creates or upgrades the tables used by the store.
+// Applied migrations are tracked in the dpo_schema_migrations table.
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS dpo_schema_migrations (version INTEGER NOT NULL PRIMARY KEY)`); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	var current int
+	row := s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM dpo_schema_migrations`)
+	if err := row.Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for version := current + 1; version <= len(sqlMigrations); version++ {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, s.dialect.rebind(sqlMigrations[version-1])); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", version, err)
+		}
+		if _, err := tx.ExecContext(ctx, s.dialect.rebind(`INSERT INTO dpo_schema_migrations (version) VALUES (?)`), version); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %d failed: %w", version, err)
+		}
+	}
+	return nil
+}
+
+// CreatePayment implements Store.
+func (s *SQLStore) CreatePayment(ctx context.Context, record *PaymentRecord) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, s.dialect.rebind(`INSERT INTO dpo_payments
+		(trans_token, company_ref, trans_ref, order_id, amount_cents, currency, status, status_explanation, created_at, updated_at, completed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		record.TransToken, record.CompanyRef, record.TransRef, record.OrderID, record.Amount.Cents, record.Amount.Currency,
+		record.Status, record.StatusExplanation, record.CreatedAt.UTC(), record.UpdatedAt.UTC(), sqlNullTime(record.CompletedAt))
+	if err != nil {
+		tx.Rollback()
+		return s.insertError(ctx, err, ErrPaymentExists, `SELECT COUNT(*) FROM dpo_payments WHERE trans_token = ?`, record.TransToken)
+	}
+	for _, change := range record.History {
+		if err := s.insertStatusChange(ctx, tx, record.TransToken, change); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// insertError maps a failed INSERT to exists when query finds the row it conflicted with.
+// The unique constraint decides which of several concurrent inserts wins, drivers report its violation
+// with their own error types, so the row is looked up instead. The lookup runs outside the failed transaction,
+// which PostgreSQL aborts.
+func (s *SQLStore) insertError(ctx context.Context, err, exists error, query string, key string) error {
+	var n int
+	if s.db.QueryRowContext(ctx, s.dialect.rebind(query), key).Scan(&n) == nil && n > 0 {
+		return exists
+	}
+	return err
+}
+
+func (s *SQLStore) insertStatusChange(ctx context.Context, tx *sql.Tx, transToken string, change StatusChange) error {
+	_, err := tx.ExecContext(ctx, s.dialect.rebind(`INSERT INTO dpo_payment_status_history
+		(trans_token, status, explanation, changed_at) VALUES (?, ?, ?, ?)`),
+		transToken, change.Status, change.Explanation, change.At.UTC())
+	return err
+}
+
+const sqlPaymentColumns = `trans_token, company_ref, trans_ref, order_id, amount_cents, currency, status, status_explanation,
+	created_at, updated_at, completed_at`
+
+// scanPayment reads a row selected with sqlPaymentColumns.
+func scanPayment(scanner interface{ Scan(...any) error }) (*PaymentRecord, error) {
+	var record PaymentRecord
+	var completedAt sql.NullTime
+	err := scanner.Scan(&record.TransToken, &record.CompanyRef, &record.TransRef, &record.OrderID, &record.Amount.Cents,
+		&record.Amount.Currency, &record.Status, &record.StatusExplanation, &record.CreatedAt, &record.UpdatedAt, &completedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPaymentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if completedAt.Valid {
+		record.CompletedAt = &completedAt.Time
+	}
+	return &record, nil
+}
+
+// sqlNullTime converts an optional time for a nullable column.
+func sqlNullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+// loadHistory fills in the status history of record.
+func (s *SQLStore) loadHistory(ctx context.Context, record *PaymentRecord) error {
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(`SELECT status, explanation, changed_at
+		FROM dpo_payment_status_history WHERE trans_token = ? ORDER BY id`), record.TransToken)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	record.History = nil
+	for rows.Next() {
+		var change StatusChange
+		if err := rows.Scan(&change.Status, &change.Explanation, &change.At); err != nil {
+			return err
+		}
+		record.History = append(record.History, change)
+	}
+	return rows.Err()
+}
+
+// Payment implements Store.
+func (s *SQLStore) Payment(ctx context.Context, transToken string) (*PaymentRecord, error) {
+	row := s.db.QueryRowContext(ctx, s.dialect.rebind(`SELECT `+sqlPaymentColumns+` FROM dpo_payments WHERE trans_token = ?`), transToken)
+	record, err := scanPayment(row)
+	if err != nil {
+		return nil, err
+	}
+	return record, s.loadHistory(ctx, record)
+}
+
+// PaymentByRef implements Store.
+func (s *SQLStore) PaymentByRef(ctx context.Context, companyRef string) (*PaymentRecord, error) {
+	row := s.db.QueryRowContext(ctx, s.dialect.rebind(`SELECT `+sqlPaymentColumns+` FROM dpo_payments
+		WHERE company_ref = ? ORDER BY created_at DESC LIMIT 1`), companyRef)
+	record, err := scanPayment(row)
+	if err != nil {
+		return nil, err
+	}
+	return record, s.loadHistory(ctx, record)
+}
+
+// UpdateStatus implements Store.
+func (s *SQLStore) UpdateStatus(ctx context.Context, transToken string, change StatusChange) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current string
+	err = tx.QueryRowContext(ctx, s.dialect.rebind(`SELECT status FROM dpo_payments WHERE trans_token = ?`), transToken).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrPaymentNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if current == change.Status {
+		_, err = tx.ExecContext(ctx, s.dialect.rebind(`UPDATE dpo_payments SET updated_at = ? WHERE trans_token = ?`), change.At.UTC(), transToken)
+	} else {
+		_, err = tx.ExecContext(ctx, s.dialect.rebind(`UPDATE dpo_payments SET status = ?, status_explanation = ?, updated_at = ?
+			WHERE trans_token = ?`), change.Status, change.Explanation, change.At.UTC(), transToken)
+		if err == nil {
+			err = s.insertStatusChange(ctx, tx, transToken, change)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CompletePayment implements Store.
+func (s *SQLStore) CompletePayment(ctx context.Context, transToken string, at time.Time) (bool, error) {
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind(`UPDATE dpo_payments SET completed_at = ?
+		WHERE trans_token = ? AND completed_at IS NULL`), at.UTC(), transToken)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n > 0 {
+		return true, nil
+	}
+	// either the payment was completed before or it does not exist
+	if _, err := s.Payment(ctx, transToken); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// Payments implements Store.
+func (s *SQLStore) Payments(ctx context.Context, filter PaymentFilter) ([]PaymentRecord, error) {
+	var where []string
+	var args []any
+	if filter.Unsettled {
+		where = append(where, `status NOT IN (?, ?, ?, ?, ?)`)
+		args = append(args, StatusPaid, StatusDeclined, StatusDataMismatch, StatusExpired, StatusCancelled)
+	}
+	if filter.Status != "" {
+		where = append(where, `status = ?`)
+		args = append(args, filter.Status)
+	}
+	if !filter.CreatedAfter.IsZero() {
+		where = append(where, `created_at >= ?`)
+		args = append(args, filter.CreatedAfter.UTC())
+	}
+	if !filter.CreatedBefore.IsZero() {
+		where = append(where, `created_at < ?`)
+		args = append(args, filter.CreatedBefore.UTC())
+	}
+
+	query := `SELECT ` + sqlPaymentColumns + ` FROM dpo_payments`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY created_at, trans_token`
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]PaymentRecord, 0)
+	for rows.Next() {
+		record, err := scanPayment(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		records = append(records, *record)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range records {
+		if err := s.loadHistory(ctx, &records[i]); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// AddEvent implements EventOutbox.
+func (s *SQLStore) AddEvent(ctx context.Context, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, s.dialect.rebind(`INSERT INTO dpo_events (id, payload, created_at) VALUES (?, ?, ?)`),
+		event.ID, string(payload), event.At.UTC())
+	if err != nil {
+		tx.Rollback()
+		return s.insertError(ctx, err, ErrEventExists, `SELECT COUNT(*) FROM dpo_events WHERE id = ?`, event.ID)
+	}
+	return tx.Commit()
+}
+
+// PendingEvents implements EventOutbox, a limit of 0 returns all pending events.
+func (s *SQLStore) PendingEvents(ctx context.Context, limit int) ([]Event, error) {
+	query := `SELECT payload FROM dpo_events WHERE delivered_at IS NULL ORDER BY seq`
+	var args []any
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]Event, 0)
+	for rows.Next() {
+		var payload string
+		if err := rows.Scan(&payload); err != nil {
+			return nil, err
+		}
+		var event Event
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// MarkEventDelivered implements EventOutbox.
+func (s *SQLStore) MarkEventDelivered(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, s.dialect.rebind(`UPDATE dpo_events SET delivered_at = ? WHERE id = ? AND delivered_at IS NULL`),
+		time.Now().UTC(), id)
+	return err
+}
+
+// WriteAudit implements AuditSink.
+func (s *SQLStore) WriteAudit(ctx context.Context, record AuditRecord) error {
+	_, err := s.db.ExecContext(ctx, s.dialect.rebind(`INSERT INTO dpo_audit
+		(op, company_ref, trans_token, attempt, http_status, request, response, error, sent_at, received_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		record.Op, record.CompanyRef, record.TransToken, record.Attempt, record.HTTPStatus, record.Request, record.Response,
+		record.Error, record.SentAt.UTC(), record.ReceivedAt.UTC())
+	return err
+}
+
+// AuditHistory implements AuditLog.
+func (s *SQLStore) AuditHistory(ctx context.Context, transToken string) ([]AuditRecord, error) {
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(`SELECT op, company_ref, trans_token, attempt, http_status, request,
+		response, error, sent_at, received_at FROM dpo_audit WHERE trans_token = ? ORDER BY id`), transToken)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make([]AuditRecord, 0)
+	for rows.Next() {
+		var record AuditRecord
+		err := rows.Scan(&record.Op, &record.CompanyRef, &record.TransToken, &record.Attempt, &record.HTTPStatus, &record.Request,
+			&record.Response, &record.Error, &record.SentAt, &record.ReceivedAt)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,16 @@
+module github.com/golang-malawi/go-dpo/sqlstoretest
+
+go 1.18
+
+require (
+	github.com/golang-malawi/go-dpo v0.0.0-20261019020319-24e75f55d469
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.16
+	github.com/stretchr/testify v1.8.1
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
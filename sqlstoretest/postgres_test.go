@@ -0,0 +1,38 @@
+package sqlstoretest_test
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/golang-malawi/go-dpo"
+	_ "github.com/lib/pq"
+)
+
+// openPostgres connects to DPO_TEST_POSTGRES_URL and drops the tables of the store when the test ends.
+func openPostgres(t *testing.T) *sql.DB {
+	url := os.Getenv("DPO_TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("DPO_TEST_POSTGRES_URL not set")
+	}
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_, err := db.Exec(`DROP TABLE IF EXISTS dpo_audit, dpo_events, dpo_payment_status_history, dpo_payments, dpo_schema_migrations`)
+		if err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+	return db
+}
+
+func TestPostgres(t *testing.T) {
+	testSQLStore(t, openPostgres(t), dpo.Postgres)
+}
+
+func TestPostgresConcurrentCreate(t *testing.T) {
+	testConcurrentCreate(t, openPostgres(t), dpo.Postgres)
+}
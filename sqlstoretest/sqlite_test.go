@@ -0,0 +1,28 @@
+package sqlstoretest_test
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-malawi/go-dpo"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openSQLite(t *testing.T) *sql.DB {
+	path := filepath.Join(t.TempDir(), "dpo.db")
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000&_foreign_keys=on")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestSQLite(t *testing.T) {
+	testSQLStore(t, openSQLite(t), dpo.SQLite)
+}
+
+func TestSQLiteConcurrentCreate(t *testing.T) {
+	testConcurrentCreate(t, openSQLite(t), dpo.SQLite)
+}
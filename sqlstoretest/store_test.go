@@ -0,0 +1,186 @@
+package sqlstoretest_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-malawi/go-dpo"
+	"github.com/stretchr/testify/assert"
+)
+
+// testSQLStore runs the Store, EventOutbox and AuditLog methods of a store on an empty database.
+func testSQLStore(t *testing.T, db *sql.DB, dialect dpo.SQLDialect) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	store := dpo.NewSQLStore(db, dialect)
+
+	assert.Nil(store.Migrate(ctx))
+	assert.Nil(store.Migrate(ctx), "migrating twice must be a no-op")
+	var versions int
+	assert.Nil(db.QueryRow(`SELECT COUNT(*) FROM dpo_schema_migrations`).Scan(&versions))
+	assert.Greater(versions, 0)
+
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	record := &dpo.PaymentRecord{
+		CompanyRef: "REF-1",
+		TransToken: "T1",
+		TransRef:   "R1",
+		OrderID:    "order-1",
+		Amount:     dpo.Money{Cents: 1050, Currency: "USD"},
+		Status:     dpo.StatusNotPaid,
+		History:    []dpo.StatusChange{{Status: dpo.StatusNotPaid, Explanation: "created", At: created}},
+		CreatedAt:  created,
+		UpdatedAt:  created,
+	}
+	assert.Nil(store.CreatePayment(ctx, record))
+	assert.ErrorIs(store.CreatePayment(ctx, record), dpo.ErrPaymentExists)
+
+	assert.Nil(store.UpdateStatus(ctx, "T1", dpo.StatusChange{Status: dpo.StatusNotPaid, At: created.Add(time.Minute)}))
+	assert.Nil(store.UpdateStatus(ctx, "T1", dpo.StatusChange{Status: dpo.StatusPaid, Explanation: "paid", At: created.Add(2 * time.Minute)}))
+	assert.ErrorIs(store.UpdateStatus(ctx, "T2", dpo.StatusChange{Status: dpo.StatusPaid, At: created}), dpo.ErrPaymentNotFound)
+
+	payment, err := store.Payment(ctx, "T1")
+	if assert.Nil(err) {
+		assert.Equal("REF-1", payment.CompanyRef)
+		assert.Equal("R1", payment.TransRef)
+		assert.Equal("order-1", payment.OrderID)
+		assert.Equal(dpo.Money{Cents: 1050, Currency: "USD"}, payment.Amount)
+		assert.Equal(dpo.StatusPaid, payment.Status)
+		assert.Equal("paid", payment.StatusExplanation)
+		assert.True(payment.CreatedAt.Equal(created))
+		assert.True(payment.UpdatedAt.Equal(created.Add(2 * time.Minute)))
+		assert.Nil(payment.CompletedAt)
+		if assert.Len(payment.History, 2) {
+			assert.Equal(dpo.StatusNotPaid, payment.History[0].Status)
+			assert.Equal(dpo.StatusPaid, payment.History[1].Status)
+		}
+	}
+	_, err = store.Payment(ctx, "T2")
+	assert.ErrorIs(err, dpo.ErrPaymentNotFound)
+
+	later := *record
+	later.TransToken = "T2"
+	later.OrderID = ""
+	later.History = nil
+	later.CreatedAt = created.Add(time.Hour)
+	later.UpdatedAt = later.CreatedAt
+	assert.Nil(store.CreatePayment(ctx, &later))
+	payment, err = store.PaymentByRef(ctx, "REF-1")
+	if assert.Nil(err) {
+		assert.Equal("T2", payment.TransToken)
+		assert.Empty(payment.History)
+	}
+	_, err = store.PaymentByRef(ctx, "REF-2")
+	assert.ErrorIs(err, dpo.ErrPaymentNotFound)
+
+	tests := []struct {
+		filter dpo.PaymentFilter
+		want   []string
+	}{
+		{dpo.PaymentFilter{}, []string{"T1", "T2"}},
+		{dpo.PaymentFilter{Unsettled: true}, []string{"T2"}},
+		{dpo.PaymentFilter{Status: dpo.StatusPaid}, []string{"T1"}},
+		{dpo.PaymentFilter{CreatedAfter: created.Add(time.Minute)}, []string{"T2"}},
+		{dpo.PaymentFilter{CreatedBefore: created.Add(time.Hour)}, []string{"T1"}},
+	}
+	for _, tt := range tests {
+		payments, err := store.Payments(ctx, tt.filter)
+		assert.Nil(err)
+		var tokens []string
+		for _, p := range payments {
+			tokens = append(tokens, p.TransToken)
+		}
+		assert.Equal(tt.want, tokens, "%+v", tt.filter)
+	}
+
+	completed, err := store.CompletePayment(ctx, "T1", created.Add(3*time.Minute))
+	assert.Nil(err)
+	assert.True(completed)
+	completed, err = store.CompletePayment(ctx, "T1", created.Add(4*time.Minute))
+	assert.Nil(err)
+	assert.False(completed)
+	_, err = store.CompletePayment(ctx, "T3", created)
+	assert.ErrorIs(err, dpo.ErrPaymentNotFound)
+	payment, err = store.Payment(ctx, "T1")
+	if assert.Nil(err) && assert.NotNil(payment.CompletedAt) {
+		assert.True(payment.CompletedAt.Equal(created.Add(3 * time.Minute)))
+	}
+
+	event := dpo.Event{ID: "token.created:T1", Type: dpo.EventTokenCreated, TransToken: "T1", At: created}
+	assert.Nil(store.AddEvent(ctx, event))
+	assert.ErrorIs(store.AddEvent(ctx, event), dpo.ErrEventExists)
+	assert.Nil(store.AddEvent(ctx, dpo.Event{ID: "token.created:T2", Type: dpo.EventTokenCreated, TransToken: "T2", At: created}))
+	pending, err := store.PendingEvents(ctx, 1)
+	assert.Nil(err)
+	if assert.Len(pending, 1) {
+		assert.Equal(event.ID, pending[0].ID)
+	}
+	assert.Nil(store.MarkEventDelivered(ctx, event.ID))
+	pending, err = store.PendingEvents(ctx, 0)
+	assert.Nil(err)
+	if assert.Len(pending, 1) {
+		assert.Equal("token.created:T2", pending[0].ID)
+	}
+	assert.ErrorIs(store.AddEvent(ctx, event), dpo.ErrEventExists, "delivered events stay known")
+
+	audit := dpo.AuditRecord{Op: "verifyToken", TransToken: "T1", Request: "<API3G/>", HTTPStatus: 200, SentAt: created, ReceivedAt: created}
+	assert.Nil(store.WriteAudit(ctx, audit))
+	audit.Attempt = 1
+	assert.Nil(store.WriteAudit(ctx, audit))
+	history, err := store.AuditHistory(ctx, "T1")
+	assert.Nil(err)
+	if assert.Len(history, 2) {
+		assert.Equal(0, history[0].Attempt)
+		assert.Equal(1, history[1].Attempt)
+		assert.Equal("<API3G/>", history[1].Request)
+	}
+}
+
+// testConcurrentCreate creates the same payment from several goroutines, exactly one of them must succeed.
+func testConcurrentCreate(t *testing.T, db *sql.DB, dialect dpo.SQLDialect) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	store := dpo.NewSQLStore(db, dialect)
+	assert.Nil(store.Migrate(ctx))
+
+	const workers = 8
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			now := time.Now()
+			errs[i] = store.CreatePayment(ctx, &dpo.PaymentRecord{
+				CompanyRef: fmt.Sprintf("REF-%d", i),
+				TransToken: "RACE",
+				Amount:     dpo.Money{Cents: 100, Currency: "USD"},
+				Status:     dpo.StatusNotPaid,
+				History:    []dpo.StatusChange{{Status: dpo.StatusNotPaid, At: now}},
+				CreatedAt:  now,
+				UpdatedAt:  now,
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, dpo.ErrPaymentExists):
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	assert.Equal(1, created)
+	payment, err := store.Payment(ctx, "RACE")
+	if assert.Nil(err) {
+		assert.Len(payment.History, 1)
+	}
+}
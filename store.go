@@ -0,0 +1,332 @@
+package dpo
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Errors returned by Store implementations.
+var (
+	ErrPaymentNotFound = errors.New("dpo: payment not found")
+	ErrPaymentExists   = errors.New("dpo: payment already exists")
+)
+
+// PaymentRecord is what a Store remembers about a payment token.
+type PaymentRecord struct {
+	CompanyRef        string         `json:"company_ref"`
+	TransToken        string         `json:"trans_token"`
+	TransRef          string         `json:"trans_ref,omitempty"`
+	OrderID           string         `json:"order_id,omitempty"` // OrderID the order paid for when the payment was started with Checkout.Start
+	Amount            Money          `json:"amount"`
+	Status            string         `json:"status"` // Status the latest DPO result code, see the Status constants
+	StatusExplanation string         `json:"status_explanation,omitempty"`
+	History           []StatusChange `json:"history,omitempty"` // History every status the payment went through, oldest first
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	CompletedAt       *time.Time     `json:"completed_at,omitempty"` // CompletedAt when Checkout.OnComplete handled the final status, nil until then
+}
+
+// IsSettled reports whether the payment reached a final status.
+func (p *PaymentRecord) IsSettled() bool {
+	return checkoutStatusFor(p.Status).IsFinal()
+}
+
+// StatusChange is an entry in the status history of a payment.
+type StatusChange struct {
+	Status      string    `json:"status"`
+	Explanation string    `json:"explanation,omitempty"`
+	At          time.Time `json:"at"`
+}
+
+// PaymentFilter selects payments from a Store. Zero fields match everything.
+type PaymentFilter struct {
+	Unsettled     bool      // Unsettled only returns payments that have not reached a final status
+	Status        string    // Status only returns payments with this DPO result code
+	CreatedAfter  time.Time // CreatedAfter only returns payments created at or after this time
+	CreatedBefore time.Time // CreatedBefore only returns payments created before this time
+}
+
+// matches reports whether record is selected by f.
+func (f PaymentFilter) matches(record *PaymentRecord) bool {
+	if f.Unsettled && record.IsSettled() {
+		return false
+	}
+	if f.Status != "" && record.Status != f.Status {
+		return false
+	}
+	if !f.CreatedAfter.IsZero() && record.CreatedAt.Before(f.CreatedAfter) {
+		return false
+	}
+	if !f.CreatedBefore.IsZero() && !record.CreatedAt.Before(f.CreatedBefore) {
+		return false
+	}
+	return true
+}
+
+// Store persists payment records. Set one on a client with client.SetStore to record every token created
+// with CreateToken and every status seen by VerifyToken.
+type Store interface {
+	// CreatePayment stores a new payment, or returns ErrPaymentExists if the TransToken is already known.
+	CreatePayment(ctx context.Context, record *PaymentRecord) error
+	// Payment returns the payment for transToken or ErrPaymentNotFound.
+	Payment(ctx context.Context, transToken string) (*PaymentRecord, error)
+	// PaymentByRef returns the most recent payment for companyRef or ErrPaymentNotFound.
+	PaymentByRef(ctx context.Context, companyRef string) (*PaymentRecord, error)
+	// UpdateStatus records a status of the payment for transToken. The history only grows when the status changes.
+	UpdateStatus(ctx context.Context, transToken string, change StatusChange) error
+	// Payments lists the payments matching filter, oldest first.
+	Payments(ctx context.Context, filter PaymentFilter) ([]PaymentRecord, error)
+	// CompletePayment sets the CompletedAt time of the payment for transToken unless it is already set.
+	// It reports whether this call set it.
+	CompletePayment(ctx context.Context, transToken string, at time.Time) (bool, error)
+}
+
+// SetStore makes the client record payments in store, pass nil to stop recording.
+func (c *Client) SetStore(store Store) {
+	c.store = store
+}
+
+// recordCreatedToken stores a payment for a token that was just created, orderID is empty unless it was created by a Checkout.
+func (c *Client) recordCreatedToken(ctx context.Context, request *CreateTokenRequest, response *CreateTokenResponse, orderID string) error {
+	amount, err := ParseMoney(request.Transaction.PaymentAmount, request.Transaction.PaymentCurrency)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	change := StatusChange{Status: StatusNotPaid, Explanation: response.ResultExplanation, At: now}
+	return c.store.CreatePayment(ctx, &PaymentRecord{
+		CompanyRef:        request.Transaction.CompanyRef,
+		TransToken:        response.TransToken,
+		TransRef:          response.TransRef,
+		OrderID:           orderID,
+		Amount:            amount,
+		Status:            change.Status,
+		StatusExplanation: change.Explanation,
+		History:           []StatusChange{change},
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	})
+}
+
+// recordVerifiedToken stores the status of a verified token. Tokens unknown to the store are ignored.
+func (c *Client) recordVerifiedToken(ctx context.Context, transToken string, response *VerifyTokenResponse) error {
+	if isRequestError(response.Result) {
+		return nil
+	}
+	err := c.store.UpdateStatus(ctx, transToken, StatusChange{
+		Status:      response.Result,
+		Explanation: response.ResultExplanation,
+		At:          time.Now(),
+	})
+	if errors.Is(err, ErrPaymentNotFound) {
+		return nil
+	}
+	return err
+}
+
+// applyStatusChange updates record with change, appending to the history when the status differs.
+func applyStatusChange(record *PaymentRecord, change StatusChange) bool {
+	record.UpdatedAt = change.At
+	if record.Status == change.Status && len(record.History) > 0 {
+		return false
+	}
+	record.Status = change.Status
+	record.StatusExplanation = change.Explanation
+	record.History = append(record.History, change)
+	return true
+}
+
+// clonePaymentRecord copies record so callers cannot modify stored history.
+func clonePaymentRecord(record *PaymentRecord) *PaymentRecord {
+	clone := *record
+	clone.History = append([]StatusChange(nil), record.History...)
+	return &clone
+}
+
+var (
+	_ Store = (*MemoryStore)(nil)
+	_ Store = (*FileStore)(nil)
+	_ Store = (*SQLStore)(nil)
+
+	_ EventOutbox = (*MemoryStore)(nil)
+	_ EventOutbox = (*FileStore)(nil)
+	_ EventOutbox = (*SQLStore)(nil)
+)
+
+// MemoryStore is a Store that keeps payments in memory.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	payments map[string]*PaymentRecord
+
+	events   []Event         // events pending in the outbox, in the order added
+	eventIDs map[string]bool // eventIDs every event ID ever added
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		payments: make(map[string]*PaymentRecord),
+		eventIDs: make(map[string]bool),
+	}
+}
+
+// CreatePayment implements Store.
+func (m *MemoryStore) CreatePayment(ctx context.Context, record *PaymentRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.payments[record.TransToken]; ok {
+		return ErrPaymentExists
+	}
+	m.payments[record.TransToken] = clonePaymentRecord(record)
+	return nil
+}
+
+// Payment implements Store.
+func (m *MemoryStore) Payment(ctx context.Context, transToken string) (*PaymentRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	record, ok := m.payments[transToken]
+	if !ok {
+		return nil, ErrPaymentNotFound
+	}
+	return clonePaymentRecord(record), nil
+}
+
+// PaymentByRef implements Store.
+func (m *MemoryStore) PaymentByRef(ctx context.Context, companyRef string) (*PaymentRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var found *PaymentRecord
+	for _, record := range m.payments {
+		if record.CompanyRef == companyRef && (found == nil || record.CreatedAt.After(found.CreatedAt)) {
+			found = record
+		}
+	}
+	if found == nil {
+		return nil, ErrPaymentNotFound
+	}
+	return clonePaymentRecord(found), nil
+}
+
+// UpdateStatus implements Store.
+func (m *MemoryStore) UpdateStatus(ctx context.Context, transToken string, change StatusChange) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record, ok := m.payments[transToken]
+	if !ok {
+		return ErrPaymentNotFound
+	}
+	applyStatusChange(record, change)
+	return nil
+}
+
+// CompletePayment implements Store.
+func (m *MemoryStore) CompletePayment(ctx context.Context, transToken string, at time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record, ok := m.payments[transToken]
+	if !ok {
+		return false, ErrPaymentNotFound
+	}
+	if record.CompletedAt != nil {
+		return false, nil
+	}
+	record.CompletedAt = &at
+	return true, nil
+}
+
+// Payments implements Store.
+func (m *MemoryStore) Payments(ctx context.Context, filter PaymentFilter) ([]PaymentRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	records := make([]PaymentRecord, 0)
+	for _, record := range m.payments {
+		if filter.matches(record) {
+			records = append(records, *clonePaymentRecord(record))
+		}
+	}
+	sortPaymentRecords(records)
+	return records, nil
+}
+
+// AddEvent implements EventOutbox.
+func (m *MemoryStore) AddEvent(ctx context.Context, event Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.eventIDs[event.ID] {
+		return ErrEventExists
+	}
+	m.eventIDs[event.ID] = true
+	m.events = append(m.events, event)
+	return nil
+}
+
+// hasEvent reports whether an event with id was ever added.
+func (m *MemoryStore) hasEvent(id string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.eventIDs[id]
+}
+
+// rememberEvent records id as added without keeping an event for it, for events that were already delivered.
+func (m *MemoryStore) rememberEvent(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.eventIDs[id] = true
+}
+
+// deliveredEventIDs returns the sorted IDs of the events which were added and are no longer pending.
+func (m *MemoryStore) deliveredEventIDs() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	pending := make(map[string]bool, len(m.events))
+	for _, event := range m.events {
+		pending[event.ID] = true
+	}
+	var ids []string
+	for id := range m.eventIDs {
+		if id != "" && !pending[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// PendingEvents implements EventOutbox, a limit of 0 returns all pending events.
+func (m *MemoryStore) PendingEvents(ctx context.Context, limit int) ([]Event, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if limit <= 0 || limit > len(m.events) {
+		limit = len(m.events)
+	}
+	return append([]Event{}, m.events[:limit]...), nil
+}
+
+// MarkEventDelivered implements EventOutbox. Delivered events are dropped from memory.
+func (m *MemoryStore) MarkEventDelivered(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pending := m.events[:0]
+	for _, event := range m.events {
+		if event.ID != id {
+			pending = append(pending, event)
+		}
+	}
+	m.events = pending
+	return nil
+}
+
+// sortPaymentRecords orders records by creation time, then token.
+func sortPaymentRecords(records []PaymentRecord) {
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].CreatedAt.Equal(records[j].CreatedAt) {
+			return records[i].CreatedAt.Before(records[j].CreatedAt)
+		}
+		return strings.Compare(records[i].TransToken, records[j].TransToken) < 0
+	})
+}
@@ -0,0 +1,218 @@
+package dpo_test
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-malawi/go-dpo"
+	"github.com/stretchr/testify/assert"
+)
+
+func testStore(t *testing.T, store dpo.Store) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	record := &dpo.PaymentRecord{
+		CompanyRef: "REF-1",
+		TransToken: "T1",
+		OrderID:    "order-1",
+		Amount:     dpo.Money{Cents: 1000, Currency: "USD"},
+		Status:     dpo.StatusNotPaid,
+		History:    []dpo.StatusChange{{Status: dpo.StatusNotPaid, At: created}},
+		CreatedAt:  created,
+		UpdatedAt:  created,
+	}
+	assert.Nil(store.CreatePayment(ctx, record))
+	assert.ErrorIs(store.CreatePayment(ctx, record), dpo.ErrPaymentExists)
+
+	assert.Nil(store.UpdateStatus(ctx, "T1", dpo.StatusChange{Status: dpo.StatusNotPaid, At: created.Add(time.Minute)}))
+	assert.Nil(store.UpdateStatus(ctx, "T1", dpo.StatusChange{Status: dpo.StatusPaid, Explanation: "Transaction Paid", At: created.Add(2 * time.Minute)}))
+	assert.ErrorIs(store.UpdateStatus(ctx, "T2", dpo.StatusChange{Status: dpo.StatusPaid}), dpo.ErrPaymentNotFound)
+
+	payment, err := store.PaymentByRef(ctx, "REF-1")
+	assert.Nil(err)
+	assert.Equal(dpo.StatusPaid, payment.Status)
+	assert.Len(payment.History, 2)
+	assert.True(payment.IsSettled())
+
+	unsettled, err := store.Payments(ctx, dpo.PaymentFilter{Unsettled: true})
+	assert.Nil(err)
+	assert.Empty(unsettled)
+
+	all, err := store.Payments(ctx, dpo.PaymentFilter{CreatedAfter: created, CreatedBefore: created.Add(time.Hour)})
+	assert.Nil(err)
+	assert.Len(all, 1)
+
+	completed, err := store.CompletePayment(ctx, "T1", created.Add(3*time.Minute))
+	assert.Nil(err)
+	assert.True(completed)
+	completed, err = store.CompletePayment(ctx, "T1", created.Add(4*time.Minute))
+	assert.Nil(err)
+	assert.False(completed)
+	_, err = store.CompletePayment(ctx, "T2", created)
+	assert.ErrorIs(err, dpo.ErrPaymentNotFound)
+
+	payment, err = store.Payment(ctx, "T1")
+	assert.Nil(err)
+	assert.Equal("order-1", payment.OrderID)
+	if assert.NotNil(payment.CompletedAt) {
+		assert.True(payment.CompletedAt.Equal(created.Add(3 * time.Minute)))
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, dpo.NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "payments.jsonl")
+
+	store, err := dpo.OpenFileStore(path)
+	assert.Nil(err)
+	testStore(t, store)
+	assert.Nil(store.Compact())
+	assert.Nil(store.Close())
+
+	reopened, err := dpo.OpenFileStore(path)
+	assert.Nil(err)
+	defer reopened.Close()
+	payment, err := reopened.Payment(context.Background(), "T1")
+	assert.Nil(err)
+	assert.Equal(dpo.StatusPaid, payment.Status)
+	assert.Len(payment.History, 2)
+	assert.NotNil(payment.CompletedAt)
+}
+
+func TestFileStoreWriteFailure(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	store, err := dpo.OpenFileStore(filepath.Join(t.TempDir(), "payments.jsonl"))
+	assert.Nil(err)
+	record := &dpo.PaymentRecord{TransToken: "T1", Status: dpo.StatusNotPaid, CreatedAt: time.Now()}
+	assert.Nil(store.CreatePayment(ctx, record))
+	assert.Nil(store.Close())
+
+	// the file is closed, so no change must reach memory
+	assert.NotNil(store.CreatePayment(ctx, &dpo.PaymentRecord{TransToken: "T2", Status: dpo.StatusNotPaid}))
+	_, err = store.Payment(ctx, "T2")
+	assert.ErrorIs(err, dpo.ErrPaymentNotFound)
+
+	assert.NotNil(store.UpdateStatus(ctx, "T1", dpo.StatusChange{Status: dpo.StatusPaid, At: time.Now()}))
+	payment, err := store.Payment(ctx, "T1")
+	assert.Nil(err)
+	assert.Equal(dpo.StatusNotPaid, payment.Status)
+
+	assert.NotNil(store.AddEvent(ctx, dpo.Event{ID: "E1"}))
+	pending, err := store.PendingEvents(ctx, 0)
+	assert.Nil(err)
+	assert.Empty(pending)
+}
+
+func TestFileStorePartialLastLine(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "payments.jsonl")
+
+	store, err := dpo.OpenFileStore(path)
+	assert.Nil(err)
+	assert.Nil(store.CreatePayment(ctx, &dpo.PaymentRecord{TransToken: "T1", Status: dpo.StatusNotPaid, CreatedAt: time.Now()}))
+	assert.Nil(store.Close())
+
+	// a crash in the middle of an append
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	assert.Nil(err)
+	_, err = file.WriteString(`{"trans_token":"T2","sta`)
+	assert.Nil(err)
+	assert.Nil(file.Close())
+
+	store, err = dpo.OpenFileStore(path)
+	if !assert.Nil(err) {
+		return
+	}
+	_, err = store.Payment(ctx, "T2")
+	assert.ErrorIs(err, dpo.ErrPaymentNotFound)
+	assert.Nil(store.CreatePayment(ctx, &dpo.PaymentRecord{TransToken: "T3", Status: dpo.StatusNotPaid, CreatedAt: time.Now()}))
+	assert.Nil(store.Close())
+
+	store, err = dpo.OpenFileStore(path)
+	if !assert.Nil(err) {
+		return
+	}
+	defer store.Close()
+	for _, token := range []string{"T1", "T3"} {
+		_, err = store.Payment(ctx, token)
+		assert.Nil(err, token)
+	}
+}
+
+func TestFileStoreCompactKeepsDeliveredEvents(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "payments.jsonl")
+
+	store, err := dpo.OpenFileStore(path)
+	assert.Nil(err)
+	assert.Nil(store.AddEvent(ctx, dpo.Event{ID: "payment_succeeded:T1", Type: dpo.EventPaymentSucceeded}))
+	assert.Nil(store.AddEvent(ctx, dpo.Event{ID: "payment_succeeded:T2", Type: dpo.EventPaymentSucceeded}))
+	assert.Nil(store.MarkEventDelivered(ctx, "payment_succeeded:T1"))
+	assert.Nil(store.Compact())
+	assert.ErrorIs(store.AddEvent(ctx, dpo.Event{ID: "payment_succeeded:T1"}), dpo.ErrEventExists)
+	assert.Nil(store.Close())
+
+	store, err = dpo.OpenFileStore(path)
+	assert.Nil(err)
+	defer store.Close()
+	assert.ErrorIs(store.AddEvent(ctx, dpo.Event{ID: "payment_succeeded:T1"}), dpo.ErrEventExists)
+	pending, err := store.PendingEvents(ctx, 0)
+	assert.Nil(err)
+	if assert.Len(pending, 1) {
+		assert.Equal("payment_succeeded:T2", pending[0].ID)
+	}
+}
+
+func TestClientStoreHook(t *testing.T) {
+	assert := assert.New(t)
+
+	client := newStubClientFunc(func(requestBody string) (int, string) {
+		if strings.Contains(requestBody, "<Request>createToken</Request>") {
+			return http.StatusOK, `<API3G><Result>000</Result><TransToken>T1</TransToken><TransRef>R1</TransRef></API3G>`
+		}
+		return http.StatusOK, `<API3G><Result>000</Result><ResultExplanation>Transaction Paid</ResultExplanation></API3G>`
+	})
+	store := dpo.NewMemoryStore()
+	client.SetStore(store)
+
+	request := client.NewCreateTokenRequest(client.Token, "USD", big.NewFloat(1000000))
+	request.AddService("3854", "Ecommerce", time.Now())
+	token, err := client.CreateToken(request)
+	assert.Nil(err)
+
+	payment, err := store.Payment(context.Background(), "T1")
+	assert.Nil(err)
+	assert.Equal(request.Transaction.CompanyRef, payment.CompanyRef)
+	assert.Equal("1000000.00 USD", payment.Amount.String())
+	assert.Equal(dpo.StatusNotPaid, payment.Status)
+
+	// CheckToken only asks DPO
+	response, err := client.CheckToken(context.Background(), "T1")
+	assert.Nil(err)
+	assert.Equal(dpo.StatusPaid, response.Result)
+	payment, err = store.Payment(context.Background(), "T1")
+	assert.Nil(err)
+	assert.Equal(dpo.StatusNotPaid, payment.Status)
+
+	_, err = client.VerifyToken(token)
+	assert.Nil(err)
+	payment, err = store.Payment(context.Background(), "T1")
+	assert.Nil(err)
+	assert.Equal(dpo.StatusPaid, payment.Status)
+}
@@ -8,24 +8,27 @@ import (
 
 // CreateTokenRequest is a request to create a token that will be used to process (i.e. initiate, complete, cancel, revoke) payments.
 type CreateTokenRequest struct {
-	XMLName xml.Name `xml:"API3G"`
+	XMLName xml.Name `xml:"API3G" json:"-"`
 
-	CompanyToken string                 `xml:"CompanyToken"`
-	Request      string                 `xml:"Request"`
-	Transaction  CreateTokenTransaction `xml:"Transaction"`
-	Services     []Service              `xml:"Services>Service"`
+	CompanyToken string                 `xml:"CompanyToken" json:"-"`
+	Request      string                 `xml:"Request" json:"request"`
+	Transaction  CreateTokenTransaction `xml:"Transaction" json:"transaction"`
+	Services     []Service              `xml:"Services>Service" json:"services"`
 }
 
 // NewCreateTokenRequest creates a new token that can be used in client.VerifyToken calls.
+// The CompanyRef is generated with client.GenerateRef. If that fails the CompanyRef is left empty and
+// client.CreateToken generates it again, returning the error if it still fails.
 func (c *Client) NewCreateTokenRequest(companyToken string, paymentCurrency string, amount *big.Float) *CreateTokenRequest {
 	// TODO: add validation before creating token
+	companyRef, _ := c.newCompanyRef()
 	return &CreateTokenRequest{
 		CompanyToken: companyToken,
 		Request:      "createToken",
 		Transaction: CreateTokenTransaction{
-			PaymentAmount:    amount.String(),
+			PaymentAmount:    amount.Text('f', 2),
 			PaymentCurrency:  paymentCurrency,
-			CompanyRef:       c.GenerateRef(),
+			CompanyRef:       companyRef,
 			RedirectURL:      c.RedirectURL,
 			BackURL:          c.BackURL,
 			CompanyRefUnique: 0, // 0 - not unique, 1 - duplicate request
@@ -40,7 +43,7 @@ func (c *CreateTokenRequest) AddService(typeCode, description string, serviceDat
 	service := &Service{
 		ServiceType:        typeCode,
 		ServiceDescription: description,
-		ServiceDate:        serviceDate.Format("2006/01/02 15:04"),
+		ServiceDate:        serviceDate.Format(serviceDateLayout),
 	}
 	if c.Services == nil || len(c.Services) < 1 {
 		c.Services = make([]Service, 0)
@@ -56,6 +59,32 @@ func (c *CreateTokenRequest) SetBackURL(backURL string) {
 	c.Transaction.BackURL = backURL
 }
 
+// SetCustomer sets the customer details that DPO uses to prefill the payment page.
+func (c *CreateTokenRequest) SetCustomer(customer Customer) {
+	c.Transaction.CustomerFirstName = customer.FirstName
+	c.Transaction.CustomerLastName = customer.LastName
+	c.Transaction.CustomerEmail = customer.Email
+	c.Transaction.CustomerPhone = customer.Phone
+	c.Transaction.CustomerDialCode = customer.DialCode
+	c.Transaction.CustomerAddress = customer.Address
+	c.Transaction.CustomerCity = customer.City
+	c.Transaction.CustomerCountry = customer.Country
+	c.Transaction.CustomerZip = customer.Zip
+}
+
+// Customer is the person paying, all fields are optional.
+type Customer struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+	Phone     string `json:"phone"`
+	DialCode  string `json:"dial_code"` // DialCode ISO 3166-1 alpha-2 code of the phone number's country, e.g. "MW"
+	Address   string `json:"address"`
+	City      string `json:"city"`
+	Country   string `json:"country"` // Country ISO 3166-1 alpha-2 code, e.g. "MW"
+	Zip       string `json:"zip"`
+}
+
 // SetRedirectURL sets the URL that DPO will redirect to when user completes the payment flow
 func (c *CreateTokenRequest) SetRedirectURL(redirectURL string) {
 	c.Transaction.RedirectURL = redirectURL
@@ -63,31 +92,41 @@ func (c *CreateTokenRequest) SetRedirectURL(redirectURL string) {
 
 // Service is a product or service that users can pay for through DPO
 type Service struct {
-	ServiceType        string `xml:"ServiceType"`
-	ServiceDescription string `xml:"ServiceDescription"`
-	ServiceDate        string `xml:"ServiceDate"`
+	ServiceType        string `xml:"ServiceType" json:"service_type"`
+	ServiceDescription string `xml:"ServiceDescription" json:"service_description"`
+	ServiceDate        string `xml:"ServiceDate" json:"service_date" jsonschema:"date-time"`
 }
 
 // CreateTokenTransaction TODO: add docs
 type CreateTokenTransaction struct {
-	PaymentAmount    string `xml:"PaymentAmount"`
-	PaymentCurrency  string `xml:"PaymentCurrency"`
-	CompanyRef       string `xml:"CompanyRef"`
-	RedirectURL      string `xml:"RedirectURL"`
-	BackURL          string `xml:"BackURL"`
-	CompanyRefUnique int    `xml:"CompanyRefUnique"`
-	PTL              string `xml:"PTL"`
+	PaymentAmount    string `xml:"PaymentAmount" json:"payment_amount"`
+	PaymentCurrency  string `xml:"PaymentCurrency" json:"payment_currency"`
+	CompanyRef       string `xml:"CompanyRef" json:"company_ref"`
+	RedirectURL      string `xml:"RedirectURL" json:"redirect_url"`
+	BackURL          string `xml:"BackURL" json:"back_url"`
+	CompanyRefUnique int    `xml:"CompanyRefUnique" json:"company_ref_unique"`
+	PTL              string `xml:"PTL" json:"ptl"`
+
+	CustomerFirstName string `xml:"customerFirstName,omitempty" json:"customer_first_name,omitempty"`
+	CustomerLastName  string `xml:"customerLastName,omitempty" json:"customer_last_name,omitempty"`
+	CustomerEmail     string `xml:"customerEmail,omitempty" json:"customer_email,omitempty"`
+	CustomerPhone     string `xml:"customerPhone,omitempty" json:"customer_phone,omitempty"`
+	CustomerDialCode  string `xml:"customerDialCode,omitempty" json:"customer_dial_code,omitempty"` // CustomerDialCode ISO 3166-1 alpha-2 code of the phone number's country, e.g. "MW"
+	CustomerAddress   string `xml:"customerAddress,omitempty" json:"customer_address,omitempty"`
+	CustomerCity      string `xml:"customerCity,omitempty" json:"customer_city,omitempty"`
+	CustomerCountry   string `xml:"customerCountry,omitempty" json:"customer_country,omitempty"` // CustomerCountry ISO 3166-1 alpha-2 code, e.g. "MW"
+	CustomerZip       string `xml:"customerZip,omitempty" json:"customer_zip,omitempty"`
 }
 
 // CreateTokenResponse is returned after processing a CreateTokenRequest and depending on the Result may be an error response or not
 type CreateTokenResponse struct {
-	XMLName xml.Name `xml:"API3G"`
+	XMLName xml.Name `xml:"API3G" json:"-"`
 
-	Result            string      `xml:"Result"`
-	ResultExplanation string      `xml:"ResultExplanation"`
-	TransToken        string      `xml:"TransToken,omitempty"`
-	TransRef          string      `xml:"TransRef,omitempty"`
-	Allocations       Allocations `xml:"Allocations,omitempty"`
+	Result            string      `xml:"Result" json:"result"`
+	ResultExplanation string      `xml:"ResultExplanation" json:"result_explanation"`
+	TransToken        string      `xml:"TransToken,omitempty" json:"trans_token,omitempty"`
+	TransRef          string      `xml:"TransRef,omitempty" json:"trans_ref,omitempty"`
+	Allocations       Allocations `xml:"Allocations,omitempty" json:"allocations,omitempty"`
 }
 
 // IsError determines whether the CreateTokenResponse is an error or not.
@@ -97,66 +136,113 @@ func (c *CreateTokenResponse) IsError() bool {
 
 // Allocations collection of allocations
 type Allocations struct {
-	Allocation Allocation `xml:"Allocation"`
+	Allocation Allocation `xml:"Allocation" json:"allocation"`
 }
 
 // Allocation an allocation as defined by DPO
 type Allocation struct {
-	AllocationID   string `xml:"AllocationID"`
-	AllocationCode string `xml:"AllocationCode"`
+	AllocationID   string `xml:"AllocationID" json:"allocation_id"`
+	AllocationCode string `xml:"AllocationCode" json:"allocation_code"`
 }
 
 // VerifyTokenRequest is a request to verify a token that was requested as a CreateTokenRequest
 type VerifyTokenRequest struct {
-	XMLName xml.Name `xml:"API3G"`
+	XMLName xml.Name `xml:"API3G" json:"-"`
 
-	CompanyToken     string `xml:"CompanyToken"`
-	TransactionToken string `xml:"TransactionToken"`
-	Request          string `xml:"Request"`
+	CompanyToken     string `xml:"CompanyToken" json:"-"`
+	TransactionToken string `xml:"TransactionToken" json:"trans_token"`
+	Request          string `xml:"Request" json:"request"`
 }
 
 // VerifyTokenResponse is returned after processing a VerifyTokenRequet and depending on the .Result may be an error response or not
 type VerifyTokenResponse struct {
-	XMLName xml.Name `xml:"API3G"`
-
-	Result            string `xml:"Result"`
-	ResultExplanation string `xml:"ResultExplanation"`
-}
+	XMLName xml.Name `xml:"API3G" json:"-"`
+
+	Result            string `xml:"Result" json:"result"`
+	ResultExplanation string `xml:"ResultExplanation" json:"result_explanation"`
+	TransactionDetails
+}
+
+// TransactionDetails holds the customer and payment information DPO reports for a transaction.
+// It is shared by the responses of verifyToken and the transaction lookup requests.
+type TransactionDetails struct {
+	CustomerName                    string `xml:"CustomerName,omitempty" json:"customer_name,omitempty"`
+	CustomerCredit                  string `xml:"CustomerCredit,omitempty" json:"customer_credit,omitempty"`          // CustomerCredit last 4 digits of the card or the paying account
+	CustomerCreditType              string `xml:"CustomerCreditType,omitempty" json:"customer_credit_type,omitempty"` // CustomerCreditType card brand or payment method
+	TransactionApproval             string `xml:"TransactionApproval,omitempty" json:"transaction_approval,omitempty"`
+	TransactionCurrency             string `xml:"TransactionCurrency,omitempty" json:"transaction_currency,omitempty"`
+	TransactionAmount               string `xml:"TransactionAmount,omitempty" json:"transaction_amount,omitempty" jsonschema:"amount"`
+	FraudAlert                      string `xml:"FraudAlert,omitempty" json:"fraud_alert,omitempty"`
+	FraudExplanation                string `xml:"FraudExplnation,omitempty" json:"fraud_explanation,omitempty"` // sic, DPO misspells the element name
+	TransactionNetAmount            string `xml:"TransactionNetAmount,omitempty" json:"transaction_net_amount,omitempty" jsonschema:"amount"`
+	TransactionSettlementDate       string `xml:"TransactionSettlementDate,omitempty" json:"transaction_settlement_date,omitempty" jsonschema:"date-time"`
+	TransactionRollingReserveAmount string `xml:"TransactionRollingReserveAmount,omitempty" json:"transaction_rolling_reserve_amount,omitempty" jsonschema:"amount"`
+	TransactionRollingReserveDate   string `xml:"TransactionRollingReserveDate,omitempty" json:"transaction_rolling_reserve_date,omitempty" jsonschema:"date-time"`
+	CustomerPhone                   string `xml:"CustomerPhone,omitempty" json:"customer_phone,omitempty"`
+	CustomerCountry                 string `xml:"CustomerCountry,omitempty" json:"customer_country,omitempty"`
+	CustomerAddress                 string `xml:"CustomerAddress,omitempty" json:"customer_address,omitempty"`
+	CustomerCity                    string `xml:"CustomerCity,omitempty" json:"customer_city,omitempty"`
+	CustomerZip                     string `xml:"CustomerZip,omitempty" json:"customer_zip,omitempty"`
+	MobilePaymentRequest            string `xml:"MobilePaymentRequest,omitempty" json:"mobile_payment_request,omitempty"`
+	AccRef                          string `xml:"AccRef,omitempty" json:"acc_ref,omitempty"`
+	TransactionFinalCurrency        string `xml:"TransactionFinalCurrency,omitempty" json:"transaction_final_currency,omitempty"`
+	TransactionFinalAmount          string `xml:"TransactionFinalAmount,omitempty" json:"transaction_final_amount,omitempty" jsonschema:"amount"`
+}
+
+// Result codes DPO reports for the status of a transaction, e.g. in VerifyTokenResponse.Result.
+const (
+	StatusPaid                = "000" // StatusPaid Transaction paid
+	StatusAuthorized          = "001" // StatusAuthorized Transaction authorized
+	StatusOverpaid            = "002" // StatusOverpaid Transaction overpaid or underpaid
+	StatusPendingBank         = "003" // StatusPendingBank Transaction pending at the bank
+	StatusQueuedAuthorization = "005" // StatusQueuedAuthorization Authorization queued
+	StatusPendingSplit        = "007" // StatusPendingSplit Split payment not fully paid
+	StatusNotPaid             = "900" // StatusNotPaid Transaction not paid yet
+	StatusDeclined            = "901" // StatusDeclined Transaction declined
+	StatusDataMismatch        = "902" // StatusDataMismatch Data mismatch in one of the fields
+	StatusExpired             = "903" // StatusExpired Transaction passed the Payment Time Limit
+	StatusCancelled           = "904" // StatusCancelled Transaction cancelled
+)
 
 // CancelTokenRequest represents a request to cancel a previously created token.
 type CancelTokenRequest struct {
-	XMLName xml.Name `xml:"API3G"`
+	XMLName xml.Name `xml:"API3G" json:"-"`
 
-	CompanyToken string `xml:"CompanyToken"`
-	Request      string `xml:"Request"`
-	Token        string `xml:"TransactionToken"`
+	CompanyToken string `xml:"CompanyToken" json:"-"`
+	Request      string `xml:"Request" json:"request"`
+	Token        string `xml:"TransactionToken" json:"trans_token"`
 }
 
 // CancelTokenResponse is the result of requesting a cancel token and depending on .Result may be an error or not.
 type CancelTokenResponse struct {
-	XMLName xml.Name `xml:"API3G"`
+	XMLName xml.Name `xml:"API3G" json:"-"`
 
-	Result            string `xml:"Result"`
-	ResultExplanation string `xml:"ResultExplanation"`
+	Result            string `xml:"Result" json:"result"`
+	ResultExplanation string `xml:"ResultExplanation" json:"result_explanation"`
 }
 
 // RefundTokenRequest represents a request to initiate a refund.
 type RefundTokenRequest struct {
-	XMLName xml.Name `xml:"API3G"`
+	XMLName xml.Name `xml:"API3G" json:"-"`
 
-	CompanyToken   string    `xml:"CompanyToken"`
-	Request        string    `xml:"Request"`
-	Token          string    `xml:"TransactionToken"`
-	RefundAmount   big.Float `xml:"refundAmount"`   // RefundAmount Requested refund amount. (Mandatory)
-	RefundDetails  string    `xml:"refundDetails"`  // RefundDetails Requested refund description. (Mandatory)
-	RefundRef      string    `xml:"refundRef"`      // refundRef Refund reference.	(Optional)
-	RefundApproval int8      `xml:"refundApproval"` // refundApproval In case it being sent, refund will be checked by a checker (Optional)
+	CompanyToken   string `xml:"CompanyToken" json:"-"`
+	Request        string `xml:"Request" json:"request"`
+	Token          string `xml:"TransactionToken" json:"trans_token"`
+	RefundAmount   string `xml:"refundAmount" json:"refund_amount"`                         // RefundAmount Requested refund amount with two decimal places. (Mandatory)
+	RefundDetails  string `xml:"refundDetails" json:"refund_details"`                       // RefundDetails Requested refund description. (Mandatory)
+	RefundRef      string `xml:"refundRef,omitempty" json:"refund_ref,omitempty"`           // refundRef Refund reference.	(Optional)
+	RefundApproval int8   `xml:"refundApproval,omitempty" json:"refund_approval,omitempty"` // refundApproval In case it being sent, refund will be checked by a checker (Optional)
 }
 
 // RefundTokenResponse represents response from initiating a refund request.
 type RefundTokenResponse struct {
-	XMLName xml.Name `xml:"API3G"`
+	XMLName xml.Name `xml:"API3G" json:"-"`
+
+	Result            string `xml:"Result" json:"result"`
+	ResultExplanation string `xml:"ResultExplanation" json:"result_explanation"`
+}
 
-	Result            string `xml:"Result"`
-	ResultExplanation string `xml:"ResultExplanation"`
+// IsError determines whether the RefundTokenResponse is an error or not.
+func (r *RefundTokenResponse) IsError() bool {
+	return r.Result != "000"
 }
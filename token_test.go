@@ -1,6 +1,7 @@
 package dpo_test
 
 import (
+	"math/big"
 	"testing"
 	"time"
 
@@ -17,3 +18,22 @@ func TestAddService(t *testing.T) {
 	assert.NotNil(token.Services)
 	assert.NotEmpty(token.Services)
 }
+
+func TestNewCreateTokenRequestAmount(t *testing.T) {
+	assert := assert.New(t)
+	client := dpo.NewClient("TOKEN", true)
+
+	tests := []struct {
+		amount *big.Float
+		want   string
+	}{
+		{big.NewFloat(10), "10.00"},
+		{big.NewFloat(10.5), "10.50"},
+		{big.NewFloat(1000000), "1000000.00"},
+		{big.NewFloat(0.1), "0.10"},
+	}
+	for _, tt := range tests {
+		request := client.NewCreateTokenRequest("TOKEN", "USD", tt.amount)
+		assert.Equal(tt.want, request.Transaction.PaymentAmount)
+	}
+}
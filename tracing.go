@@ -0,0 +1,110 @@
+package dpo
+
+import "context"
+
+// SpanAttributes describe the work traced by a span.
+// Fields which are unknown or do not apply are left empty.
+type SpanAttributes struct {
+	Op         string // Op the API3G request name, e.g. "verifyToken", or "worker.sweep" and "worker.check" for the Worker
+	CompanyRef string // CompanyRef the reference of the payment
+	TransToken string // TransToken the token of the payment
+	ResultCode string // ResultCode the DPO result code of the last response, only set when the span ends
+	Retries    int    // Retries number of attempts after the first one, only set when the span ends
+}
+
+// Tracer starts a span around every request a Client sends to DPO and around the work of a Worker.
+// The context passed to Start is the one given to the Client operation, the returned context is used for the
+// HTTP requests and nested spans, so it should carry the new span.
+type Tracer interface {
+	Start(ctx context.Context, attrs SpanAttributes) (context.Context, Span)
+}
+
+// Span is a unit of work started by a Tracer.
+type Span interface {
+	// End finishes the span, attrs has the attributes passed to Start completed with the outcome of the work
+	// and err is the error the work failed with, if any.
+	End(attrs SpanAttributes, err error)
+}
+
+// SetTracer makes the client trace its requests and those of its workers with tracer.
+// Passing nil disables tracing.
+func (c *Client) SetTracer(tracer Tracer) {
+	c.tracer = tracer
+}
+
+// clientSpan tracks the attributes of a span while the traced work runs.
+// A nil *clientSpan is valid and does nothing, it is used when the client has no tracer.
+type clientSpan struct {
+	span  Span
+	attrs SpanAttributes
+}
+
+// startSpan starts a span with attrs if the client has a tracer.
+func (c *Client) startSpan(ctx context.Context, attrs SpanAttributes) (context.Context, *clientSpan) {
+	if c.tracer == nil {
+		return ctx, nil
+	}
+	ctx, span := c.tracer.Start(ctx, attrs)
+	return ctx, &clientSpan{span: span, attrs: attrs}
+}
+
+// startRequestSpan starts a span for the API3G request op.
+func (c *Client) startRequestSpan(ctx context.Context, op string, request any) (context.Context, *clientSpan) {
+	if c.tracer == nil {
+		return ctx, nil
+	}
+	companyRef, transToken := requestRefs(request)
+	return c.startSpan(ctx, SpanAttributes{Op: op, CompanyRef: companyRef, TransToken: transToken})
+}
+
+// attempt records the outcome of an attempt of the request.
+func (s *clientSpan) attempt(retry int, body []byte) {
+	if s == nil {
+		return
+	}
+	s.attrs.Retries = retry
+	s.attrs.ResultCode = ""
+	if len(body) > 0 {
+		s.attrs.ResultCode = resultCode(body)
+	}
+}
+
+// result records the DPO result code of the traced work.
+func (s *clientSpan) result(code string) {
+	if s == nil {
+		return
+	}
+	s.attrs.ResultCode = code
+}
+
+// end ends the span, filling in the token of a created token from response.
+func (s *clientSpan) end(response any, err error) {
+	if s == nil {
+		return
+	}
+	if r, ok := response.(*CreateTokenResponse); ok && s.attrs.TransToken == "" {
+		s.attrs.TransToken = r.TransToken
+	}
+	s.span.End(s.attrs, err)
+}
+
+// requestRefs returns the CompanyRef and TransToken a request refers to.
+func requestRefs(request any) (companyRef, transToken string) {
+	switch r := request.(type) {
+	case *CreateTokenRequest:
+		return r.Transaction.CompanyRef, ""
+	case *VerifyTokenRequest:
+		return "", r.TransactionToken
+	case *CancelTokenRequest:
+		return "", r.Token
+	case *RefundTokenRequest:
+		return "", r.Token
+	case *ChargeCreditCardRequest:
+		return "", r.TransactionToken
+	case *ChargeTokenMobileRequest:
+		return "", r.TransactionToken
+	case *TransactionByRefRequest:
+		return r.CompanyRef, ""
+	}
+	return "", ""
+}
@@ -0,0 +1,115 @@
+package dpo_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-malawi/go-dpo"
+	"github.com/stretchr/testify/assert"
+)
+
+type spanKey struct{}
+
+type recordedSpan struct {
+	parent string
+	attrs  dpo.SpanAttributes
+	err    error
+}
+
+// recordingTracer records ended spans and puts the Op of the current span in the context.
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, attrs dpo.SpanAttributes) (context.Context, dpo.Span) {
+	parent, _ := ctx.Value(spanKey{}).(string)
+	return context.WithValue(ctx, spanKey{}, attrs.Op), &recordingSpan{tracer: t, parent: parent}
+}
+
+type recordingSpan struct {
+	tracer *recordingTracer
+	parent string
+}
+
+func (s *recordingSpan) End(attrs dpo.SpanAttributes, err error) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.tracer.spans = append(s.tracer.spans, recordedSpan{parent: s.parent, attrs: attrs, err: err})
+}
+
+func TestTracerPropagatesContext(t *testing.T) {
+	assert := assert.New(t)
+
+	var requestSpans []string
+	attempts := 0
+	client := dpo.NewClient("TOKEN", false)
+	client.SetHTTPClient(&http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			span, _ := req.Context().Value(spanKey{}).(string)
+			requestSpans = append(requestSpans, span)
+			attempts++
+			status, body := http.StatusOK, `<API3G><Result>900</Result><ResultExplanation>Transaction not paid yet</ResultExplanation></API3G>`
+			if attempts == 1 {
+				status, body = http.StatusServiceUnavailable, "unavailable"
+			}
+			return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(body)), Header: make(http.Header)}, nil
+		}),
+	})
+	tracer := &recordingTracer{}
+	client.SetTracer(tracer)
+
+	ctx := context.WithValue(context.Background(), spanKey{}, "checkout")
+	_, err := client.VerifyTokenContext(ctx, &dpo.CreateTokenResponse{TransToken: "T1"})
+	assert.Nil(err)
+	assert.Equal([]string{"verifyToken", "verifyToken"}, requestSpans)
+	assert.Len(tracer.spans, 1)
+	assert.Equal("checkout", tracer.spans[0].parent)
+	assert.Equal(dpo.SpanAttributes{Op: "verifyToken", TransToken: "T1", ResultCode: "900", Retries: 1}, tracer.spans[0].attrs)
+}
+
+func TestTracerCreateTokenAndErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	client := newStubClient(http.StatusOK, `<API3G><Result>000</Result><ResultExplanation>Created</ResultExplanation><TransToken>T1</TransToken></API3G>`, nil)
+	tracer := &recordingTracer{}
+	client.SetTracer(tracer)
+
+	request := &dpo.CreateTokenRequest{}
+	request.Transaction.CompanyRef = "REF1"
+	_, err := client.CreateToken(request)
+	assert.Nil(err)
+	assert.Equal(dpo.SpanAttributes{Op: "createToken", CompanyRef: "REF1", TransToken: "T1", ResultCode: "000"}, tracer.spans[0].attrs)
+
+	client = newStubClient(http.StatusBadRequest, "bad request", nil)
+	client.SetTracer(tracer)
+	_, err = client.CancelToken("T2")
+	assert.NotNil(err)
+	assert.Equal("cancelToken", tracer.spans[1].attrs.Op)
+	assert.Equal("T2", tracer.spans[1].attrs.TransToken)
+	assert.Equal(err, tracer.spans[1].err)
+}
+
+func TestTracerWorker(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := context.Background()
+	store := dpo.NewMemoryStore()
+	err := store.CreatePayment(ctx, &dpo.PaymentRecord{CompanyRef: "REF1", TransToken: "T1", Status: dpo.StatusNotPaid, CreatedAt: time.Now()})
+	assert.Nil(err)
+
+	client := newStubClient(http.StatusOK, `<API3G><Result>000</Result><ResultExplanation>Transaction paid</ResultExplanation></API3G>`, nil)
+	tracer := &recordingTracer{}
+	client.SetTracer(tracer)
+
+	assert.Nil(dpo.NewWorker(client, store).Sweep(ctx))
+	assert.Len(tracer.spans, 3)
+	assert.Equal(recordedSpan{parent: "worker.check", attrs: dpo.SpanAttributes{Op: "verifyToken", TransToken: "T1", ResultCode: "000"}}, tracer.spans[0])
+	assert.Equal(recordedSpan{parent: "worker.sweep", attrs: dpo.SpanAttributes{Op: "worker.check", CompanyRef: "REF1", TransToken: "T1", ResultCode: "000"}}, tracer.spans[1])
+	assert.Equal("worker.sweep", tracer.spans[2].attrs.Op)
+}
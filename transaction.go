@@ -0,0 +1,91 @@
+package dpo
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+)
+
+const (
+	opGetTransactionByRef = "getTransactionByRef"
+
+	// transactionByRefNotFound is the Result of getTransactionByRef when DPO knows no transaction for the CompanyRef.
+	transactionByRefNotFound = "999"
+)
+
+// TransactionByRefOptions controls which transactions are returned by client.TransactionByRef.
+type TransactionByRefOptions struct {
+	// LatestOnly returns only the latest token created with the CompanyRef instead of every one.
+	LatestOnly bool
+}
+
+// TransactionByRefRequest is a request to look up the transactions created with a CompanyRef.
+type TransactionByRefRequest struct {
+	XMLName xml.Name `xml:"API3G" json:"-"`
+
+	CompanyToken string `xml:"CompanyToken" json:"-"`
+	Request      string `xml:"Request" json:"request"`
+	CompanyRef   string `xml:"CompanyRef" json:"company_ref"`
+	AllTokens    int    `xml:"AllTokens" json:"all_tokens"` // AllTokens 1 - return all tokens, 0 - return latest token only
+}
+
+// TransactionByRefResponse is returned after processing a TransactionByRefRequest and depending on the Result may be an error response or not.
+type TransactionByRefResponse struct {
+	XMLName xml.Name `xml:"API3G" json:"-"`
+
+	Result            string        `xml:"Result" json:"result"`
+	ResultExplanation string        `xml:"ResultExplanation" json:"result_explanation"`
+	Transactions      []Transaction `xml:"Transactions>Transaction" json:"transactions"`
+}
+
+// IsError determines whether the TransactionByRefResponse is an error or not.
+func (t *TransactionByRefResponse) IsError() bool {
+	return t.Result != "000"
+}
+
+// Transaction is a single token/transaction known to DPO.
+// Result holds the status of the transaction, see the Status constants.
+type Transaction struct {
+	TransToken             string `xml:"TransactionToken" json:"trans_token"`
+	TransRef               string `xml:"TransactionRef,omitempty" json:"trans_ref,omitempty"`
+	CompanyRef             string `xml:"CompanyRef,omitempty" json:"company_ref,omitempty"`
+	Result                 string `xml:"Result" json:"result"`
+	ResultExplanation      string `xml:"ResultExplanation" json:"result_explanation"`
+	TransactionCreatedDate string `xml:"TransactionCreatedDate,omitempty" json:"transaction_created_date,omitempty" jsonschema:"date-time"`
+	TransactionPaymentDate string `xml:"TransactionPaymentDate,omitempty" json:"transaction_payment_date,omitempty" jsonschema:"date-time"`
+	TransactionDetails
+}
+
+// IsPaid determines whether DPO considers the transaction paid.
+func (t *Transaction) IsPaid() bool {
+	return t.Result == StatusPaid
+}
+
+// TransactionByRef looks up the tokens and transactions that were created with companyRef.
+// This allows recovering a TransToken when only the CompanyRef was saved, and detecting duplicate payments.
+// opts may be nil, in which case every token for companyRef is returned.
+// When DPO knows no transaction for companyRef the returned *Error has the code "999".
+func (c *Client) TransactionByRef(ctx context.Context, companyRef string, opts *TransactionByRefOptions) ([]Transaction, error) {
+	if companyRef == "" {
+		return nil, fmt.Errorf("companyRef must not be empty")
+	}
+
+	request := &TransactionByRefRequest{
+		CompanyToken: c.Token,
+		Request:      opGetTransactionByRef,
+		CompanyRef:   companyRef,
+	}
+	if opts == nil || !opts.LatestOnly {
+		request.AllTokens = 1
+	}
+
+	var response TransactionByRefResponse
+	if err := c.post(ctx, opGetTransactionByRef, request, &response); err != nil {
+		return nil, err
+	}
+	if response.IsError() {
+		return nil, &Error{Op: opGetTransactionByRef, Code: response.Result, Explanation: response.ResultExplanation}
+	}
+
+	return response.Transactions, nil
+}
@@ -0,0 +1,64 @@
+package dpo_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/golang-malawi/go-dpo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransactionByRef(t *testing.T) {
+	assert := assert.New(t)
+
+	var requests []string
+	client := newStubClient(http.StatusOK, `<?xml version="1.0" encoding="utf-8"?>
+<API3G>
+  <Result>000</Result>
+  <ResultExplanation>Transactions found</ResultExplanation>
+  <Transactions>
+    <Transaction>
+      <TransactionToken>TOKEN-1</TransactionToken>
+      <Result>000</Result>
+      <ResultExplanation>Transaction Paid</ResultExplanation>
+      <TransactionCurrency>USD</TransactionCurrency>
+      <TransactionAmount>10.00</TransactionAmount>
+      <TransactionCreatedDate>2024/01/02 15:04</TransactionCreatedDate>
+    </Transaction>
+    <Transaction>
+      <TransactionToken>TOKEN-2</TransactionToken>
+      <Result>900</Result>
+      <ResultExplanation>Transaction not paid yet</ResultExplanation>
+    </Transaction>
+  </Transactions>
+</API3G>`, &requests)
+
+	transactions, err := client.TransactionByRef(context.Background(), "REF-1", nil)
+	assert.Nil(err)
+	assert.Len(transactions, 2)
+	assert.Equal("TOKEN-1", transactions[0].TransToken)
+	assert.True(transactions[0].IsPaid())
+	assert.Equal("10.00", transactions[0].TransactionAmount)
+	assert.Equal(dpo.StatusNotPaid, transactions[1].Result)
+
+	assert.Len(requests, 1)
+	assert.Contains(requests[0], "<Request>getTransactionByRef</Request>")
+	assert.Contains(requests[0], "<CompanyRef>REF-1</CompanyRef>")
+	assert.Contains(requests[0], "<AllTokens>1</AllTokens>")
+
+	_, err = client.TransactionByRef(context.Background(), "REF-1", &dpo.TransactionByRefOptions{LatestOnly: true})
+	assert.Nil(err)
+	assert.Len(requests, 2)
+	assert.Contains(requests[1], "<AllTokens>0</AllTokens>")
+}
+
+func TestTransactionByRefError(t *testing.T) {
+	assert := assert.New(t)
+
+	client := newStubClient(http.StatusOK, `<API3G><Result>802</Result><ResultExplanation>Wrong CompanyToken</ResultExplanation></API3G>`, nil)
+
+	_, err := client.TransactionByRef(context.Background(), "REF-1", nil)
+	assert.NotNil(err)
+	assert.Equal("802", dpo.ErrorCode(err))
+}
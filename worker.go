@@ -0,0 +1,186 @@
+package dpo
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// PaymentStatusEvent is published by the Worker when the status of a payment changes.
+type PaymentStatusEvent struct {
+	Payment        PaymentRecord // Payment the record after the change
+	PreviousStatus string        // PreviousStatus the status before the change
+	Cancelled      bool          // Cancelled is true when the worker cancelled the token because its PTL expired
+}
+
+// Worker periodically verifies the unsettled payments in a Store and keeps their status up to date.
+// Tokens still unpaid after their payment time limit are cancelled with CancelToken.
+//
+//	worker := dpo.NewWorker(client, store)
+//	worker.OnStatusChange = func(ctx context.Context, e dpo.PaymentStatusEvent) { ... }
+//	go worker.Run(ctx)
+type Worker struct {
+	client *Client
+	store  Store
+
+	Interval         time.Duration // Interval between sweeps of the store, one minute by default
+	Concurrency      int           // Concurrency maximum number of requests in flight, 4 by default
+	RequestInterval  time.Duration // RequestInterval minimum time between two requests to DPO, 0 for no limit
+	PaymentTimeLimit time.Duration // PaymentTimeLimit after which unpaid tokens are cancelled, 5 hours like NewCreateTokenRequest
+
+	// OnStatusChange is called after a payment's status changed, from the worker's goroutines.
+	OnStatusChange func(ctx context.Context, event PaymentStatusEvent)
+	// OnError is called with errors for individual payments, which do not stop the worker.
+	OnError func(err error)
+}
+
+// NewWorker creates a Worker verifying the unsettled payments of store with client.
+func NewWorker(client *Client, store Store) *Worker {
+	return &Worker{
+		client:           client,
+		store:            store,
+		Interval:         time.Minute,
+		Concurrency:      4,
+		PaymentTimeLimit: 5 * time.Hour,
+	}
+}
+
+// Run sweeps the store every Interval until ctx is cancelled. A sweep in progress is stopped and Run waits
+// for the requests in flight before returning ctx.Err().
+func (w *Worker) Run(ctx context.Context) error {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.Sweep(ctx); err != nil && ctx.Err() == nil {
+			w.reportError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep verifies every unsettled payment in the store once and returns when all of them are done.
+func (w *Worker) Sweep(ctx context.Context) (err error) {
+	ctx, span := w.client.startSpan(ctx, SpanAttributes{Op: "worker.sweep"})
+	defer func() { span.end(nil, err) }()
+
+	payments, err := w.store.Payments(ctx, PaymentFilter{Unsettled: true})
+	if err != nil {
+		return fmt.Errorf("failed to load unsettled payments: %w", err)
+	}
+
+	concurrency := w.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var throttle <-chan time.Time
+	if w.RequestInterval > 0 {
+		ticker := time.NewTicker(w.RequestInterval)
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+
+	queue := make(chan PaymentRecord)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for payment := range queue {
+				if err := w.check(ctx, payment, throttle); err != nil && ctx.Err() == nil {
+					w.reportError(err)
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, payment := range payments {
+		select {
+		case queue <- payment:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+	return ctx.Err()
+}
+
+// check verifies a single payment and cancels it when its payment time limit has passed.
+func (w *Worker) check(ctx context.Context, payment PaymentRecord, throttle <-chan time.Time) (err error) {
+	ctx, span := w.client.startSpan(ctx, SpanAttributes{Op: "worker.check", CompanyRef: payment.CompanyRef, TransToken: payment.TransToken})
+	defer func() { span.end(nil, err) }()
+
+	if err := wait(ctx, throttle); err != nil {
+		return err
+	}
+	verifyResponse, err := w.client.verifyToken(ctx, payment.TransToken)
+	if err != nil && verifyResponse == nil {
+		return fmt.Errorf("failed to verify %s: %w", payment.TransToken, err)
+	}
+	span.result(verifyResponse.Result)
+	if isRequestError(verifyResponse.Result) {
+		return &Error{Op: "verifyToken", Code: verifyResponse.Result, Explanation: verifyResponse.ResultExplanation}
+	}
+
+	change := StatusChange{Status: verifyResponse.Result, Explanation: verifyResponse.ResultExplanation, At: time.Now()}
+	cancelled := false
+	if change.Status == StatusNotPaid && w.PaymentTimeLimit > 0 && change.At.Sub(payment.CreatedAt) > w.PaymentTimeLimit {
+		if err := wait(ctx, throttle); err != nil {
+			return err
+		}
+		cancelResponse, err := w.client.CancelTokenContext(ctx, payment.TransToken)
+		if err != nil && cancelResponse == nil {
+			return fmt.Errorf("failed to cancel %s: %w", payment.TransToken, err)
+		}
+		if err == nil {
+			change = StatusChange{Status: StatusCancelled, Explanation: cancelResponse.ResultExplanation, At: time.Now()}
+			cancelled = true
+			span.result(cancelResponse.Result)
+		} else {
+			w.reportError(err)
+		}
+	}
+
+	if change.Status == payment.Status {
+		return nil
+	}
+	if err := w.store.UpdateStatus(ctx, payment.TransToken, change); err != nil {
+		return fmt.Errorf("failed to store status of %s: %w", payment.TransToken, err)
+	}
+	if w.OnStatusChange != nil {
+		previous := payment.Status
+		applyStatusChange(&payment, change)
+		w.OnStatusChange(ctx, PaymentStatusEvent{Payment: payment, PreviousStatus: previous, Cancelled: cancelled})
+	}
+	return nil
+}
+
+func (w *Worker) reportError(err error) {
+	if w.OnError != nil {
+		w.OnError(err)
+	}
+}
+
+// wait blocks until throttle fires or ctx is done. A nil throttle does not block.
+func wait(ctx context.Context, throttle <-chan time.Time) error {
+	if throttle == nil {
+		return ctx.Err()
+	}
+	select {
+	case <-throttle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,110 @@
+package dpo_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-malawi/go-dpo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCancelTokenContext(t *testing.T) {
+	assert := assert.New(t)
+
+	var bodies []string
+	client := newStubClient(http.StatusOK, `<API3G><Result>000</Result><ResultExplanation>Transaction cancelled</ResultExplanation></API3G>`, &bodies)
+	response, err := client.CancelTokenContext(context.Background(), "TOKEN1")
+	assert.Nil(err)
+	assert.Equal("000", response.Result)
+	assert.Contains(bodies[0], "<Request>cancelToken</Request>")
+
+	client = newStubClient(http.StatusOK, `<API3G><Result>804</Result><ResultExplanation>Invalid token</ResultExplanation></API3G>`, nil)
+	_, err = client.CancelTokenContext(context.Background(), "TOKEN1")
+	assert.Equal("804", dpo.ErrorCode(err))
+}
+
+func TestWorkerSweep(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := context.Background()
+	store := dpo.NewMemoryStore()
+	now := time.Now()
+	for _, p := range []struct {
+		token   string
+		created time.Time
+	}{
+		{"PAID", now},
+		{"PENDING", now},
+		{"EXPIRED", now.Add(-6 * time.Hour)},
+	} {
+		err := store.CreatePayment(ctx, &dpo.PaymentRecord{
+			CompanyRef: "REF-" + p.token,
+			TransToken: p.token,
+			Amount:     dpo.Money{Cents: 100, Currency: "USD"},
+			Status:     dpo.StatusNotPaid,
+			CreatedAt:  p.created,
+			UpdatedAt:  p.created,
+		})
+		assert.Nil(err)
+	}
+
+	client := newStubClientFunc(func(requestBody string) (int, string) {
+		switch {
+		case strings.Contains(requestBody, "cancelToken"):
+			return http.StatusOK, `<API3G><Result>000</Result><ResultExplanation>Transaction cancelled</ResultExplanation></API3G>`
+		case strings.Contains(requestBody, ">PAID<"):
+			return http.StatusOK, `<API3G><Result>000</Result><ResultExplanation>Transaction paid</ResultExplanation></API3G>`
+		default:
+			return http.StatusOK, `<API3G><Result>900</Result><ResultExplanation>Transaction not paid yet</ResultExplanation></API3G>`
+		}
+	})
+
+	var mu sync.Mutex
+	events := map[string]dpo.PaymentStatusEvent{}
+	worker := dpo.NewWorker(client, store)
+	worker.OnStatusChange = func(ctx context.Context, e dpo.PaymentStatusEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events[e.Payment.TransToken] = e
+	}
+	worker.OnError = func(err error) { t.Error(err) }
+
+	assert.Nil(worker.Sweep(ctx))
+	assert.Len(events, 2)
+	assert.Equal(dpo.StatusPaid, events["PAID"].Payment.Status)
+	assert.Equal(dpo.StatusNotPaid, events["PAID"].PreviousStatus)
+	assert.True(events["EXPIRED"].Cancelled)
+
+	payment, err := store.Payment(ctx, "EXPIRED")
+	assert.Nil(err)
+	assert.Equal(dpo.StatusCancelled, payment.Status)
+
+	unsettled, err := store.Payments(ctx, dpo.PaymentFilter{Unsettled: true})
+	assert.Nil(err)
+	assert.Len(unsettled, 1)
+}
+
+func TestWorkerRunStopsOnCancel(t *testing.T) {
+	assert := assert.New(t)
+
+	client := newStubClient(http.StatusOK, `<API3G><Result>900</Result></API3G>`, nil)
+	worker := dpo.NewWorker(client, dpo.NewMemoryStore())
+	worker.Interval = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- worker.Run(ctx) }()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.Equal(context.Canceled, err)
+	case <-time.After(time.Second):
+		t.Fatal("worker did not stop")
+	}
+}